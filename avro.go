@@ -0,0 +1,399 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AvroTag of the Field tags, the logical type of an Avro field or of its
+// elements, e.g. "timestamp-millis" or "decimal(10,2)"
+const AvroTag = "avro"
+
+// Go types of Avro primitive types
+var avroPrimitives = map[string]string{
+	"boolean": "bool",
+	"int":     "int32",
+	"long":    "int64",
+	"float":   "float32",
+	"double":  "float64",
+	"bytes":   "[]byte",
+	"string":  "string",
+}
+
+// avroUUID pattern of the uuid logical type
+const avroUUID = `^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`
+
+// ImportAvro converts an Avro schema in JSON, a named type or an array of them,
+// to Schema definitions in the order for CreateSchema. Records are structs and
+// enums are of string. A union of null and one type is a pointer, or a nil
+// slice or map, other unions are named by the record and the field, with the
+// variants named by the types, and pointers if with null. Fixed is an array of
+// bytes. Logical types keep the values of the underlying types and are recorded
+// in AvroTag, except that decimal and uuid are strings checked by patterns
+func ImportAvro(data []byte) (ss []Schema, err error) {
+	jd := json.NewDecoder(bytes.NewReader(data))
+	jd.UseNumber()
+	v, err := readOrdered(jd)
+	if err != nil {
+		return
+	}
+	x := &avroImporter{names: make(map[string]Field), open: make(map[string]bool),
+		full: make(map[string]string), unions: make(map[string]bool)}
+	roots, ok := v.([]interface{})
+	if !ok {
+		roots = []interface{}{v}
+	}
+	for _, r := range roots {
+		if _, ok := r.(object); !ok {
+			return nil, fmt.Errorf("not a named type: %v", r)
+		}
+		if _, err = x.field("", "", "", r); err != nil {
+			return
+		}
+	}
+	if len(x.ss) == 0 {
+		return nil, fmt.Errorf("no record, enum or union")
+	}
+	return x.ss, nil
+}
+
+// AddAvro imports an Avro schema by ImportAvro and creates the schemas, with
+// the codecs of enums and unions registered
+func (ts *Types) AddAvro(data []byte) (ss []Schema, err error) {
+	if ss, err = ImportAvro(data); err != nil {
+		return
+	}
+	for _, s := range ss {
+		if _, err = ts.CreateSchema(s); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+type avroImporter struct {
+	names  map[string]Field  // of full names
+	open   map[string]bool   // full names of the records being imported
+	full   map[string]string // full names of schema names
+	unions map[string]bool   // of schema names
+	ss     []Schema
+}
+
+// field of an Avro schema in the namespace, a union is named of owner and name
+func (x *avroImporter) field(owner, name, ns string, v interface{}) (f Field, err error) {
+	switch s := v.(type) {
+	case string:
+		if t, ok := avroPrimitives[s]; ok {
+			return Field{Type: t}, nil
+		}
+		return x.ref(s, ns)
+	case []interface{}:
+		return x.union(owner, name, ns, s)
+	case object:
+		t, _ := s.get("type")
+		switch t {
+		case "record", "error":
+			f, err = x.record(s, ns)
+		case "enum":
+			f, err = x.enum(s, ns)
+		case "fixed":
+			f, err = x.fixed(s, ns)
+		case "array":
+			items, _ := s.get("items")
+			if f, err = x.field(owner, name, ns, items); err == nil {
+				f.Type = "[]" + f.Type
+				if f.Constraints != nil {
+					f.Constraints = &Constraints{Elem: f.Constraints}
+				}
+			}
+		case "map":
+			values, _ := s.get("values")
+			if f, err = x.field(owner, name, ns, values); err == nil {
+				f.Type = "map[string]" + f.Type
+				if f.Constraints != nil {
+					f.Constraints = &Constraints{Elem: f.Constraints}
+				}
+			}
+		default:
+			if f, err = x.field(owner, name, ns, t); err == nil {
+				f = avroLogical(f, s)
+			}
+		}
+		return
+	}
+	return f, fmt.Errorf("invalid Avro schema: %v", v)
+}
+
+// avroName of a named type, the full name, the schema name and the namespace
+func avroName(o object, ns string) (full, name, space string, err error) {
+	n, _ := o.get("name")
+	full, _ = n.(string)
+	if full == "" {
+		return "", "", "", fmt.Errorf("named type without name")
+	}
+	if s, ok := o.get("namespace"); ok {
+		ns, _ = s.(string)
+	}
+	if i := strings.LastIndexByte(full, '.'); i >= 0 {
+		ns, name = full[:i], full[i+1:]
+	} else if name = full; ns != "" {
+		full = ns + "." + full
+	}
+	if !ir.MatchString(name) {
+		name = mangle(name)
+	}
+	return full, name, ns, nil
+}
+
+// ref to a named type by the full name or the name in the namespace, which is
+// not a record being imported, as recursive types can not be created
+func (x *avroImporter) ref(name, ns string) (Field, error) {
+	full := name
+	if _, ok := x.names[full]; !ok && ns != "" && !strings.Contains(name, ".") {
+		full = ns + "." + name
+	}
+	f, ok := x.names[full]
+	if !ok {
+		return f, fmt.Errorf("unknown Avro type: %s", name)
+	}
+	if x.open[full] {
+		return f, fmt.Errorf("recursive Avro type: %s", full)
+	}
+	return f, nil
+}
+
+// declare a named type, a schema if name is not empty
+func (x *avroImporter) declare(full, name string, f Field) error {
+	if _, ok := x.names[full]; ok {
+		return fmt.Errorf("duplicate Avro type: %s", full)
+	}
+	if name != "" {
+		if o, ok := x.full[name]; ok {
+			return fmt.Errorf("Avro type %s and %s of the same name: %s", o, full, name)
+		}
+		x.full[name] = full
+	}
+	x.names[full] = f
+	return nil
+}
+
+// record of the fields
+func (x *avroImporter) record(o object, ns string) (f Field, err error) {
+	full, name, ns, err := avroName(o, ns)
+	if err != nil {
+		return
+	}
+	if err = x.declare(full, name, Field{Type: name}); err != nil {
+		return
+	}
+	x.open[full] = true
+	defer delete(x.open, full)
+	s := Schema{Name: name}
+	fs, _ := o.get("fields")
+	a, ok := fs.([]interface{})
+	if !ok {
+		return f, fmt.Errorf("%s: fields is not an array", full)
+	}
+	for _, e := range a {
+		fo, _ := e.(object)
+		n, _ := fo.get("name")
+		fn, _ := n.(string)
+		if fn == "" {
+			return f, fmt.Errorf("%s: field without name", full)
+		}
+		t, _ := fo.get("type")
+		ff, err := x.field(name, fn, ns, t)
+		if err != nil {
+			return f, fmt.Errorf("%s.%s: %v", full, fn, err)
+		}
+		ff.Name = fn
+		if d, ok := fo.get("default"); ok {
+			if ff.Default, err = x.defaultOf(ff, d); err != nil {
+				return f, fmt.Errorf("%s.%s: %v", full, fn, err)
+			}
+		}
+		s.Fields = append(s.Fields, ff)
+	}
+	x.ss = append(x.ss, s)
+	return Field{Type: name}, nil
+}
+
+// defaultOf a field from the default of Avro, omitted if null or of a union
+// or decimal, the bytes of a string are base64 or an array of numbers
+func (x *avroImporter) defaultOf(f Field, d interface{}) (json.RawMessage, error) {
+	if d == nil || x.unions[strings.TrimPrefix(f.Type, "*")] || strings.HasPrefix(f.Tags[AvroTag], "decimal") {
+		return nil, nil
+	}
+	if s, ok := d.(string); ok && (f.Type == "[]byte" || strings.HasPrefix(f.Type, "[") && strings.HasSuffix(f.Type, "]uint8")) {
+		b := make([]byte, 0, len(s))
+		for _, r := range s {
+			b = append(b, byte(r))
+		}
+		if f.Type == "[]byte" {
+			return json.Marshal(b)
+		}
+		ns := make([]int, len(b))
+		for i, c := range b {
+			ns[i] = int(c)
+		}
+		return json.Marshal(ns)
+	}
+	return json.Marshal(d)
+}
+
+// enum of the symbols as a string enum
+func (x *avroImporter) enum(o object, ns string) (f Field, err error) {
+	full, name, _, err := avroName(o, ns)
+	if err != nil {
+		return
+	}
+	f = Field{Type: name}
+	if err = x.declare(full, name, f); err != nil {
+		return
+	}
+	s := Schema{Name: name, Type: "string"}
+	ss, _ := o.get("symbols")
+	a, _ := ss.([]interface{})
+	for _, e := range a {
+		m, _ := e.(string)
+		if m == "" {
+			return f, fmt.Errorf("%s: invalid symbol: %v", full, e)
+		}
+		s.Members = append(s.Members, Member{Name: m})
+	}
+	if len(s.Members) == 0 {
+		return f, fmt.Errorf("%s: no symbols", full)
+	}
+	x.ss = append(x.ss, s)
+	return
+}
+
+// fixed of the size as an array of bytes, referred to by the full name
+func (x *avroImporter) fixed(o object, ns string) (f Field, err error) {
+	full, _, _, err := avroName(o, ns)
+	if err != nil {
+		return
+	}
+	sz, _ := o.get("size")
+	n, _ := sz.(json.Number)
+	l, err := strconv.Atoi(string(n))
+	if err != nil || l < 0 {
+		return f, fmt.Errorf("%s: invalid size: %v", full, sz)
+	}
+	f = avroLogical(Field{Type: fmt.Sprintf("[%d]uint8", l)}, o)
+	return f, x.declare(full, "", f)
+}
+
+// union of null and a type as a pointer, or a named union of the types
+func (x *avroImporter) union(owner, name, ns string, us []interface{}) (f Field, err error) {
+	var null bool
+	var bs []interface{}
+	for _, u := range us {
+		if u == "null" {
+			if null {
+				return f, fmt.Errorf("duplicate null of union")
+			}
+			null = true
+			continue
+		}
+		bs = append(bs, u)
+	}
+	switch {
+	case len(bs) == 0:
+		return f, fmt.Errorf("union of null only")
+	case len(bs) == 1:
+		if f, err = x.field(owner, name, ns, bs[0]); err != nil || !null {
+			return
+		}
+		if !strings.HasPrefix(f.Type, "[]") && !strings.HasPrefix(f.Type, "map[") {
+			f.Type = "*" + f.Type
+		}
+		return
+	}
+	un := owner + mangle(name)
+	if err = x.declare(un, un, Field{Type: un}); err != nil {
+		return
+	}
+	s := Schema{Name: un}
+	for _, b := range bs {
+		vn := avroVariant(b)
+		vf, err := x.field(un, vn, ns, b)
+		if err != nil {
+			return f, fmt.Errorf("%s: %v", vn, err)
+		}
+		s.Variants = append(s.Variants, Variant{Name: vn, Type: vf.Type})
+	}
+	x.unions[un] = true
+	x.ss = append(x.ss, s)
+	if null {
+		un = "*" + un
+	}
+	return Field{Type: un}, nil
+}
+
+// avroVariant name of a union branch by the name or the type
+func avroVariant(v interface{}) string {
+	if o, ok := v.(object); ok {
+		if v, ok = o.get("name"); !ok {
+			v, _ = o.get("type")
+		}
+	}
+	s, _ := v.(string)
+	return mangle(s[strings.LastIndexByte(s, '.')+1:])
+}
+
+// avroLogical type of a schema applied to the field of the underlying type,
+// ignored if unknown or invalid
+func avroLogical(f Field, o object) Field {
+	l, _ := o.get("logicalType")
+	lt, _ := l.(string)
+	ok := false
+	switch lt {
+	case "date", "time-millis":
+		ok = f.Type == "int32"
+	case "time-micros", "timestamp-millis", "timestamp-micros", "timestamp-nanos",
+		"local-timestamp-millis", "local-timestamp-micros", "local-timestamp-nanos":
+		ok = f.Type == "int64"
+	case "duration":
+		ok = f.Type == "[12]uint8"
+	case "uuid":
+		if ok = f.Type == "string"; ok {
+			f.Constraints = &Constraints{Pattern: avroUUID}
+		}
+	case "decimal":
+		if f.Type != "[]byte" && !strings.HasSuffix(f.Type, "]uint8") {
+			break
+		}
+		p, _ := o.get("precision")
+		s, _ := o.get("scale")
+		pn, _ := p.(json.Number)
+		sn, _ := s.(json.Number)
+		prec, err := strconv.Atoi(string(pn))
+		scale, _ := strconv.Atoi(string(sn))
+		if err != nil || prec < 1 || scale < 0 || scale > prec {
+			break
+		}
+		lt = fmt.Sprintf("decimal(%d,%d)", prec, scale)
+		f.Type, ok = "string", true
+		f.Constraints = &Constraints{Pattern: decimalPattern(prec, scale)}
+	}
+	if ok {
+		f.Tags = map[string]string{AvroTag: lt}
+	}
+	return f
+}
+
+// decimalPattern of the precision and scale
+func decimalPattern(prec, scale int) string {
+	i := `[0-9]{1,` + strconv.Itoa(prec-scale) + `}`
+	if prec == scale {
+		i = `0`
+	}
+	if scale == 0 {
+		return `^-?` + i + `$`
+	}
+	return `^-?` + i + `(\.[0-9]{1,` + strconv.Itoa(scale) + `})?$`
+}
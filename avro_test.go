@@ -0,0 +1,106 @@
+package schema_test
+
+import (
+	"github.com/fengyoulin/schema"
+	"reflect"
+	"testing"
+)
+
+const testAvroSchema = `[{"type":"fixed","name":"com.example.MD5","size":16},
+{"type":"record","name":"User","namespace":"com.example","doc":"a user","fields":[
+{"name":"id","type":{"type":"string","logicalType":"uuid"}},
+{"name":"user_name","type":"string","default":"anon"},
+{"name":"age","type":["null","int"],"default":null},
+{"name":"status","type":{"type":"enum","name":"Status","symbols":["ACTIVE","BANNED"]},"default":"ACTIVE"},
+{"name":"created","type":{"type":"long","logicalType":"timestamp-millis"}},
+{"name":"balance","type":{"type":"bytes","logicalType":"decimal","precision":10,"scale":2}},
+{"name":"tags","type":{"type":"array","items":"string"},"default":[]},
+{"name":"scores","type":{"type":"map","values":"double"}},
+{"name":"hash","type":["null","MD5"]},
+{"name":"contact","type":["null","string",{"type":"record","name":"Phone","fields":[{"name":"number","type":"string"}]}]},
+{"name":"data","type":"bytes","default":"ÿ"},
+{"name":"ratio","type":{"type":"bytes","logicalType":"decimal","precision":2,"scale":3}},
+{"name":"extra","type":["string","int","null"],"default":"x"},
+{"name":"key","type":["string","long"]}]}]`
+
+func TestImportAvro(t *testing.T) {
+	ss, err := schema.ImportAvro([]byte(testAvroSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := marshalSchemas(t, ss)
+	exp := `[{"name":"Status","type":"string","members":[{"name":"ACTIVE"},{"name":"BANNED"}]},` +
+		`{"name":"Phone","fields":[{"name":"number","type":"string"}]},` +
+		`{"name":"UserContact","variants":[{"name":"String","type":"string"},{"name":"Phone","type":"Phone"}]},` +
+		`{"name":"UserExtra","variants":[{"name":"String","type":"string"},{"name":"Int","type":"int32"}]},` +
+		`{"name":"UserKey","variants":[{"name":"String","type":"string"},{"name":"Long","type":"int64"}]},` +
+		`{"name":"User","fields":[{"name":"id","type":"string","tags":{"avro":"uuid"},` +
+		`"constraints":{"pattern":"^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$"}},` +
+		`{"name":"user_name","type":"string","default":"anon"},{"name":"age","type":"*int32"},` +
+		`{"name":"status","type":"Status","default":"ACTIVE"},{"name":"created","type":"int64","tags":{"avro":"timestamp-millis"}},` +
+		`{"name":"balance","type":"string","tags":{"avro":"decimal(10,2)"},"constraints":{"pattern":"^-?[0-9]{1,8}(\\.[0-9]{1,2})?$"}},` +
+		`{"name":"tags","type":"[]string","default":[]},{"name":"scores","type":"map[string]float64"},` +
+		`{"name":"hash","type":"*[16]uint8"},{"name":"contact","type":"*UserContact"},` +
+		`{"name":"data","type":"[]byte","default":"/w=="},{"name":"ratio","type":"[]byte"},` +
+		`{"name":"extra","type":"*UserExtra"},{"name":"key","type":"UserKey"}]}]`
+	if string(b) != exp {
+		t.Errorf("%s\n!=\n%s", b, exp)
+	}
+	for _, src := range []string{
+		`"string"`,
+		`{"type":"record","name":"A","fields":[{"name":"b","type":"B"}]}`,
+		`{"type":"record","name":"A","fields":[{"name":"b","type":["null"]}]}`,
+		`{"type":"record","name":"A","fields":[{"name":"b","type":["null","int","null"]}]}`,
+		`[{"type":"enum","name":"A","symbols":["X"]},{"type":"record","name":"x.A","fields":[]}]`,
+		`{"type":"fixed","name":"F","size":-1}`,
+		`{"type":"fixed","name":"F","size":4}`,
+		`{"type":"record","name":"A"}`,
+		`{"type":"record","name":"A","fields":[{"name":"next","type":["null","A"]}]}`,
+		`{"type":"enum","name":"E","symbols":[]}`,
+	} {
+		if _, err = schema.ImportAvro([]byte(src)); err == nil {
+			t.Errorf("%s: expected error", src)
+		}
+	}
+}
+
+func TestTypes_AddAvro(t *testing.T) {
+	ts := schema.New()
+	if _, err := ts.AddAvro([]byte(testAvroSchema)); err != nil {
+		t.Fatal(err)
+	}
+	p, err := ts.NewValue("User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := p.Elem()
+	if s, ok := ts.Member(v.FieldByName("Status")); !ok || s != "ACTIVE" {
+		t.Errorf("unexpected status: %s", s)
+	}
+	if n := v.FieldByName("UserName").String(); n != "anon" {
+		t.Errorf("unexpected user name: %s", n)
+	}
+	if d := v.FieldByName("Data").Bytes(); !reflect.DeepEqual(d, []byte{0xff}) {
+		t.Errorf("unexpected data: % x", d)
+	}
+	data := `{"id":"123e4567-e89b-12d3-a456-426614174000","balance":"-12.34","contact":{"$type":"Phone","value":{"number":"1"}}}`
+	if err = schema.JSONUnmarshal(ts, []byte(data), p.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	if err = ts.Validate(p.Interface()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if c := v.FieldByName("Contact").Elem(); c.Field(0).String() != "Phone" || c.Field(1).Elem().Field(0).String() != "1" {
+		t.Errorf("unexpected contact: %+v", c.Interface())
+	}
+	if e := v.FieldByName("Extra"); !e.IsNil() {
+		t.Errorf("unexpected extra: %+v", e.Elem().Interface())
+	}
+	v.FieldByName("ID").SetString("x")
+	v.FieldByName("Balance").SetString("1.234")
+	exp := `id: "x" does not match pattern ^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$; ` +
+		`balance: "1.234" does not match pattern ^-?[0-9]{1,8}(\.[0-9]{1,2})?$`
+	if err = ts.Validate(p.Interface()); err == nil || err.Error() != exp {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,358 @@
+// Command schema encodes, decodes and inspects data of Schema definitions
+//
+// Usage:
+//
+//	schema <command> [flags]
+//
+// The commands are:
+//
+//	decode    binary to JSON or text
+//	encode    JSON or text to binary
+//	inspect   annotated text dump with offsets, marking where decoding diverged
+//	validate  check a binary value decodes fully, with no trailing bytes
+//	types     list the registered names and their definitions
+//	lint      report problems of the definitions before they are created
+//	gen       generate Go types of the definitions, for go:generate
+//
+// For example, in a source file of the package:
+//
+//	//go:generate schema gen -s order.json -o order_gen.go
+//
+// Schema definitions are loaded from JSON files by -s, each a Schema or an
+// array of them, and may refer to each other in any order.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/fengyoulin/schema"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const usage = `usage: schema <command> [flags]
+
+commands:
+  decode    binary to JSON or text
+  encode    JSON or text to binary
+  inspect   annotated text dump with offsets
+  validate  check a binary value decodes fully
+  types     list the registered names and definitions
+  lint      report problems of the definitions
+  gen       generate Go types of the definitions
+
+run schema <command> -h for the flags of a command
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "schema:", err)
+		os.Exit(1)
+	}
+}
+
+// files of repeated flags
+type files []string
+
+func (f *files) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *files) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+type command struct {
+	fs      *flag.FlagSet
+	schemas files
+	typ     string
+	in      string
+	out     string
+	format  string
+	lint    schema.Linter
+	roots   files
+	opts    []schema.Option
+	gen     schema.Generator
+	stdin   io.Reader
+	stdout  io.Writer
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) (err error) {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", usage)
+	}
+	c := &command{fs: flag.NewFlagSet(args[0], flag.ContinueOnError), stdin: stdin, stdout: stdout}
+	c.fs.Var(&c.schemas, "s", "schema definition file, repeated")
+	if args[0] != "types" && args[0] != "lint" && args[0] != "gen" {
+		c.fs.StringVar(&c.typ, "t", "", "name of the root type")
+		c.fs.StringVar(&c.in, "i", "-", "input file")
+	}
+	switch args[0] {
+	case "decode", "encode":
+		c.fs.StringVar(&c.out, "o", "-", "output file")
+		c.fs.StringVar(&c.format, "f", "json", "format of JSON or text")
+	case "lint":
+		c.fs.Var(&c.roots, "r", "root type, repeated, by default the types no other refers to")
+		c.fs.IntVar(&c.lint.MaxArrayLen, "a", 1024, "max length of fixed arrays")
+		c.fs.Var(option{&c.opts, schema.DisablePointer()}, "nopointer", "check as DisablePointer")
+		c.fs.Var(option{&c.opts, schema.StringKeyOnly()}, "stringkey", "check as StringKeyOnly")
+	case "gen":
+		c.fs.Var(&c.roots, "r", "type to generate with its dependencies, repeated, by default all")
+		c.fs.StringVar(&c.gen.Package, "p", os.Getenv("GOPACKAGE"), "package name, $GOPACKAGE by go generate")
+		c.fs.StringVar(&c.gen.Var, "v", "Types", "name of the *schema.Types variable")
+		c.fs.BoolVar(&c.gen.Methods, "m", false, "generate MarshalSchema and UnmarshalSchema methods")
+		c.fs.StringVar(&c.out, "o", "-", "output file")
+	case "inspect", "validate", "types":
+	default:
+		return fmt.Errorf("unknown command: %s\n%s", args[0], usage)
+	}
+	if err = c.fs.Parse(args[1:]); err != nil {
+		return
+	}
+	ss, err := read(c.schemas)
+	if err != nil {
+		return
+	}
+	if args[0] == "lint" {
+		return c.check(ss)
+	}
+	ts, err := load(ss)
+	if err != nil {
+		return
+	}
+	switch args[0] {
+	case "types":
+		return c.types(ts)
+	case "gen":
+		return c.generate(ts)
+	}
+	if c.typ == "" {
+		return fmt.Errorf("missing root type by -t")
+	}
+	if _, ok := ts.TypeByName(c.typ); !ok {
+		return fmt.Errorf("unknown type: %s", c.typ)
+	}
+	r, err := c.input()
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	switch args[0] {
+	case "decode", "encode":
+		return c.code(ts, r, args[0] == "decode")
+	case "inspect":
+		return (&schema.Dumper{Types: ts, Annotate: true}).Dump(c.stdout, r, c.typ)
+	}
+	return c.validate(ts, r)
+}
+
+// option of a bool flag
+type option struct {
+	opts *[]schema.Option
+	o    schema.Option
+}
+
+func (o option) String() string {
+	return "false"
+}
+
+func (o option) Set(s string) error {
+	if b, err := strconv.ParseBool(s); err != nil || b {
+		*o.opts = append(*o.opts, o.o)
+		return err
+	}
+	return nil
+}
+
+func (o option) IsBoolFlag() bool {
+	return true
+}
+
+// read the definitions of the files
+func read(fs files) (ss []schema.Schema, err error) {
+	for _, f := range fs {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var fss []schema.Schema
+		if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '[' {
+			err = json.Unmarshal(b, &fss)
+		} else {
+			fss = make([]schema.Schema, 1)
+			err = json.Unmarshal(b, &fss[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f, err)
+		}
+		ss = append(ss, fss...)
+	}
+	return
+}
+
+// load the definitions, the types are created in their order
+func load(ss []schema.Schema) (ts *schema.Types, err error) {
+	defs := make(map[string]schema.Schema, len(ss))
+	for _, s := range ss {
+		if _, ok := defs[s.Name]; ok {
+			return nil, fmt.Errorf("duplicate schema: %s", s.Name)
+		}
+		defs[s.Name] = s
+	}
+	ts = schema.New(schema.UseResolver(func(name string) (s schema.Schema, err error) {
+		s, ok := defs[name]
+		if !ok {
+			err = fmt.Errorf("unknown type: %s", name)
+		}
+		return
+	}))
+	for _, s := range ss {
+		if _, err = ts.CreateType(s.Name); err != nil {
+			return nil, fmt.Errorf("%s: %v", s.Name, err)
+		}
+	}
+	return
+}
+
+func (c *command) input() (io.ReadCloser, error) {
+	if c.in == "-" {
+		return ioutil.NopCloser(c.stdin), nil
+	}
+	return os.Open(c.in)
+}
+
+// output to the file, or stdout
+func (c *command) output(fn func(w io.Writer) error) (err error) {
+	if c.out == "-" {
+		return fn(c.stdout)
+	}
+	f, err := os.Create(c.out)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if e := f.Close(); err == nil {
+			err = e
+		}
+	}()
+	return fn(f)
+}
+
+// code between binary and the format
+func (c *command) code(ts *schema.Types, r io.Reader, decode bool) error {
+	return c.output(func(w io.Writer) error {
+		return c.transcode(ts, w, r, decode)
+	})
+}
+
+func (c *command) transcode(ts *schema.Types, w io.Writer, r io.Reader, decode bool) (err error) {
+	switch c.format {
+	case "json":
+		tc := &schema.Transcoder{Types: ts}
+		if !decode {
+			return tc.FromJSON(w, r, c.typ)
+		}
+		if err = tc.ToJSON(w, r, c.typ); err == nil {
+			_, err = io.WriteString(w, "\n")
+		}
+		return
+	case "text":
+		dp := &schema.Dumper{Types: ts}
+		if decode {
+			return dp.Dump(w, r, c.typ)
+		}
+		return dp.Parse(w, r, c.typ)
+	}
+	return fmt.Errorf("unknown format: %s", c.format)
+}
+
+// validate the value decodes fully and satisfies the constraints of the types
+func (c *command) validate(ts *schema.Types, r io.Reader) (err error) {
+	v, err := ts.NewValue(c.typ)
+	if err != nil {
+		return
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	br := bytes.NewReader(b)
+	if err = (&schema.Decoder{Reader: br, Types: ts, Validate: true}).Decode(v.Interface()); err != nil {
+		return fmt.Errorf("offset %d: %v", len(b)-br.Len(), err)
+	}
+	if br.Len() > 0 {
+		return fmt.Errorf("offset %d: %d trailing bytes", len(b)-br.Len(), br.Len())
+	}
+	_, err = fmt.Fprintf(c.stdout, "ok: %s, %d bytes\n", c.typ, len(b))
+	return
+}
+
+// generate Go source of the types
+func (c *command) generate(ts *schema.Types) (err error) {
+	if c.gen.Package == "" {
+		return fmt.Errorf("missing package name by -p")
+	}
+	c.gen.Types = ts
+	var b bytes.Buffer
+	if err = c.gen.Generate(&b, c.roots...); err != nil {
+		return
+	}
+	return c.output(func(w io.Writer) (err error) {
+		_, err = w.Write(b.Bytes())
+		return
+	})
+}
+
+// check the definitions by the linter, it fails if any issue is found
+func (c *command) check(ss []schema.Schema) (err error) {
+	c.lint.Types = schema.New(c.opts...)
+	c.lint.Roots = c.roots
+	issues := c.lint.Lint(ss)
+	for _, i := range issues {
+		if _, err = fmt.Fprintln(c.stdout, i); err != nil {
+			return
+		}
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("%d issues", len(issues))
+	}
+	return
+}
+
+// types lists the names and definitions
+func (c *command) types(ts *schema.Types) (err error) {
+	for _, nm := range ts.Names() {
+		def, err := ts.Definition(nm)
+		if err != nil {
+			def = "?"
+		}
+		if s, err := ts.SchemaOf(nm); err == nil && (len(s.Members) > 0 || len(s.Variants) > 0) {
+			def = describe(s)
+		}
+		if _, err = fmt.Fprintf(c.stdout, "%s\t%s\n", nm, def); err != nil {
+			return err
+		}
+	}
+	return
+}
+
+// describe an enum or a union
+func describe(s schema.Schema) string {
+	var ds []string
+	if len(s.Members) > 0 {
+		for _, m := range s.Members {
+			ds = append(ds, m.Name)
+		}
+		return "enum " + s.Type + " {" + strings.Join(ds, ", ") + "}"
+	}
+	for _, v := range s.Variants {
+		ds = append(ds, v.Name+" "+v.Type)
+	}
+	return "union {" + strings.Join(ds, "; ") + "}"
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testDefs = `[
+{"name":"Order","fields":[
+{"name":"ID","type":"uint","tags":{"json":"id"}},
+{"name":"Status","type":"Status","tags":{"json":"status"}},
+{"name":"Lines","type":"[]Line","tags":{"json":"lines"}}
+]},
+{"name":"Line","fields":[
+{"name":"SKU","type":"string","tags":{"json":"sku"}},
+{"name":"Qty","type":"int","tags":{"json":"qty"},"constraints":{"min":1}}
+]},
+{"name":"Status","type":"uint8","members":[{"name":"New"},{"name":"Paid"}]}
+]`
+
+func testSchema(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	f := filepath.Join(dir, "order.json")
+	if err = ioutil.WriteFile(f, []byte(testDefs), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func testRun(t *testing.T, in []byte, args ...string) ([]byte, error) {
+	out := &bytes.Buffer{}
+	err := run(args, bytes.NewReader(in), out)
+	return out.Bytes(), err
+}
+
+func TestRun(t *testing.T) {
+	f := testSchema(t)
+	doc := `{"id":7,"status":"Paid","lines":[{"sku":"a","qty":2}]}`
+	bin, err := testRun(t, []byte(doc), "encode", "-s", f, "-t", "Order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, err := testRun(t, bin, "decode", "-s", f, "-t", "Order")
+	if err != nil || string(js) != doc+"\n" {
+		t.Errorf("%s != %s, error: %v", js, doc, err)
+	}
+	text, err := testRun(t, bin, "decode", "-s", f, "-t", "Order", "-f", "text")
+	if err != nil || !strings.Contains(string(text), "Status: Paid\n") {
+		t.Errorf("unexpected text: %s, error: %v", text, err)
+	}
+	if back, err := testRun(t, text, "encode", "-s", f, "-t", "Order", "-f", "text"); err != nil || !bytes.Equal(back, bin) {
+		t.Errorf("%x != %x, error: %v", back, bin, err)
+	}
+	if out, err := testRun(t, bin, "inspect", "-s", f, "-t", "Order"); err != nil || !strings.Contains(string(out), "ID: 7  # @1 uint\n") {
+		t.Errorf("unexpected dump: %s, error: %v", out, err)
+	}
+	if out, err := testRun(t, bin, "validate", "-s", f, "-t", "Order"); err != nil || !strings.HasPrefix(string(out), "ok: Order") {
+		t.Errorf("unexpected validate: %s, error: %v", out, err)
+	}
+	if _, err = testRun(t, append(bin, 0), "validate", "-s", f, "-t", "Order"); err == nil || !strings.Contains(err.Error(), "1 trailing bytes") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	bad, err := testRun(t, []byte(`{"lines":[{"qty":0}]}`), "encode", "-s", f, "-t", "Order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = testRun(t, bad, "validate", "-s", f, "-t", "Order"); err == nil {
+		t.Error("expected constraint error")
+	}
+	out, err := testRun(t, nil, "types", "-s", f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"Status\tenum uint8 {New, Paid}\n", "Line\tstruct{SKU string \"json:\\\"sku\\\"\"; Qty int \"json:\\\"qty\\\"\"}\n", "int\tint\n"} {
+		if !strings.Contains(string(out), s) {
+			t.Errorf("missing %q in:\n%s", s, out)
+		}
+	}
+	if out, err = testRun(t, nil, "lint", "-s", f); err != nil || len(out) != 0 {
+		t.Errorf("unexpected lint: %s, error: %v", out, err)
+	}
+	if out, err = testRun(t, nil, "lint", "-s", f, "-r", "Line", "-stringkey"); err == nil || !strings.Contains(string(out), "Order: not reachable from Line (unused)\n") {
+		t.Errorf("unexpected lint: %s, error: %v", out, err)
+	}
+	if out, err = testRun(t, nil, "gen", "-s", f, "-p", "orders", "-r", "Line"); err != nil || !strings.Contains(string(out), "package orders\n") || !strings.Contains(string(out), "func NewLine() *Line {") || strings.Contains(string(out), "Order") {
+		t.Errorf("unexpected gen: %s, error: %v", out, err)
+	}
+	for _, args := range [][]string{{}, {"unknown"}, {"gen", "-s", f, "-p", ""}, {"decode", "-s", f}, {"decode", "-s", f, "-t", "Nothing"}, {"decode", "-s", f, "-t", "Order", "-f", "xml"}} {
+		if _, err = testRun(t, bin, args...); err == nil {
+			t.Errorf("%v: expected error", args)
+		}
+	}
+}
@@ -0,0 +1,459 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Codec of the values of T, the same data as Encoder and Decoder of a *T, by
+// the plan of T compiled once and cached by Types, Extend is not supported
+type Codec[T any] struct {
+	// Defaults of Field are applied to structs before decoding, as Decoder
+	Defaults bool
+	// Validate each decoded value by Types
+	Validate bool
+
+	ts *Types
+}
+
+// NewCodec of T by ts, New() if nil, the types of T must be encodable
+func NewCodec[T any](ts *Types) (c *Codec[T], err error) {
+	if ts == nil {
+		ts = New()
+	}
+	if _, err = ts.planOf(reflect.TypeOf((*T)(nil)).Elem()); err != nil {
+		return
+	}
+	return &Codec[T]{ts: ts}, nil
+}
+
+// Types of the Codec
+func (c *Codec[T]) Types() *Types {
+	return c.ts
+}
+
+// plan of T, compiled again if discarded by AddType
+func (c *Codec[T]) plan() (p *plan, err error) {
+	return c.ts.planOf(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// Marshal v as Encoder.Encode(&v)
+func (c *Codec[T]) Marshal(v T) (b []byte, err error) {
+	buf := &bytes.Buffer{}
+	if err = c.encode(&Encoder{Writer: buf, Types: c.ts}, &v); err != nil {
+		return
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal a value of T written by Marshal, the whole b is expected
+func (c *Codec[T]) Unmarshal(b []byte) (v T, err error) {
+	r := bytes.NewReader(b)
+	if err = c.decode(c.decoder(r), &v); err != nil {
+		return
+	}
+	if r.Len() > 0 {
+		err = fmt.Errorf("%d trailing bytes", r.Len())
+	}
+	return
+}
+
+// NewEncoder of the values of T to w
+func (c *Codec[T]) NewEncoder(w io.Writer) *CodecEncoder[T] {
+	return &CodecEncoder[T]{c: c, e: &Encoder{Writer: w, Types: c.ts}}
+}
+
+// NewDecoder of the values of T from r, which is buffered
+func (c *Codec[T]) NewDecoder(r io.Reader) *CodecDecoder[T] {
+	return &CodecDecoder[T]{c: c, d: c.decoder(newStreamReader(r))}
+}
+
+func (c *Codec[T]) decoder(r io.Reader) *Decoder {
+	return &Decoder{Reader: r, Types: c.ts, Defaults: c.Defaults}
+}
+
+func (c *Codec[T]) encode(e *Encoder, v *T) (err error) {
+	p, err := c.plan()
+	if err != nil {
+		return
+	}
+	if err = e.EncodeBool(true); err != nil {
+		return
+	}
+	return p.enc(e, reflect.ValueOf(v).Elem())
+}
+
+func (c *Codec[T]) decode(d *Decoder, v *T) (err error) {
+	p, err := c.plan()
+	if err != nil {
+		return
+	}
+	ok, err := d.DecodeBool()
+	if err != nil || !ok {
+		return
+	}
+	if err = p.dec(d, reflect.ValueOf(v).Elem()); err != nil {
+		return
+	}
+	if c.Validate {
+		return c.ts.Validate(v)
+	}
+	return
+}
+
+// CodecEncoder writes the values of T to a stream
+type CodecEncoder[T any] struct {
+	c *Codec[T]
+	e *Encoder
+}
+
+// Encode v as Codec.Marshal
+func (ce *CodecEncoder[T]) Encode(v T) error {
+	return ce.c.encode(ce.e, &v)
+}
+
+// CodecDecoder reads the values of T from a stream
+type CodecDecoder[T any] struct {
+	c *Codec[T]
+	d *Decoder
+}
+
+// Decode the next value, io.EOF at the end of the stream
+func (cd *CodecDecoder[T]) Decode() (v T, err error) {
+	err = cd.c.decode(cd.d, &v)
+	return
+}
+
+// Offset in the stream after the decoded values
+func (cd *CodecDecoder[T]) Offset() int64 {
+	return cd.d.Reader.(*streamReader).off
+}
+
+// plan of a type, as InternalEncode and InternalDecode without looking up the
+// methods and codecs of each value
+type plan struct {
+	enc func(e *Encoder, rv reflect.Value) error
+	dec func(d *Decoder, rv reflect.Value) error
+}
+
+// planOf a type, compiled with the plans of its element and field types
+func (ts *Types) planOf(t reflect.Type) (p *plan, err error) {
+	ts.lk.RLock()
+	p, ok := ts.pl[t]
+	ts.lk.RUnlock()
+	if ok {
+		return
+	}
+	ts.lk.Lock()
+	defer ts.lk.Unlock()
+	ps := make(map[reflect.Type]*plan)
+	if p, err = ts.compile(t, ps); err != nil {
+		return nil, err
+	}
+	for t, p := range ps {
+		ts.pl[t] = p
+	}
+	return
+}
+
+// compile a plan, ps of the plans being compiled for recursive types
+func (ts *Types) compile(t reflect.Type, ps map[reflect.Type]*plan) (p *plan, err error) {
+	if p, ok := ts.pl[t]; ok {
+		return p, nil
+	}
+	if p, ok := ps[t]; ok {
+		return p, nil
+	}
+	p = &plan{}
+	ps[t] = p
+	switch t.Kind() {
+	case reflect.Bool:
+		p.enc = func(e *Encoder, rv reflect.Value) error { return e.EncodeBool(rv.Bool()) }
+		p.dec = func(d *Decoder, rv reflect.Value) error {
+			v, err := d.DecodeBool()
+			if err == nil {
+				rv.SetBool(v)
+			}
+			return err
+		}
+	case reflect.Int8:
+		p.enc = func(e *Encoder, rv reflect.Value) error { return e.EncodeInt8(int8(rv.Int())) }
+		p.dec = func(d *Decoder, rv reflect.Value) error {
+			v, err := d.DecodeInt8()
+			if err == nil {
+				rv.SetInt(int64(v))
+			}
+			return err
+		}
+	case reflect.Uint8:
+		p.enc = func(e *Encoder, rv reflect.Value) error { return e.EncodeUint8(uint8(rv.Uint())) }
+		p.dec = func(d *Decoder, rv reflect.Value) error {
+			v, err := d.DecodeUint8()
+			if err == nil {
+				rv.SetUint(uint64(v))
+			}
+			return err
+		}
+	case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64:
+		p.enc = func(e *Encoder, rv reflect.Value) error { return e.EncodeInt(rv.Int()) }
+		p.dec = func(d *Decoder, rv reflect.Value) error {
+			v, err := d.DecodeInt()
+			if err == nil {
+				rv.SetInt(v)
+			}
+			return err
+		}
+	case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		p.enc = func(e *Encoder, rv reflect.Value) error { return e.EncodeUint(rv.Uint()) }
+		p.dec = func(d *Decoder, rv reflect.Value) error {
+			v, err := d.DecodeUint()
+			if err == nil {
+				rv.SetUint(v)
+			}
+			return err
+		}
+	case reflect.Float32:
+		p.enc = func(e *Encoder, rv reflect.Value) error { return e.EncodeFloat32(float32(rv.Float())) }
+		p.dec = func(d *Decoder, rv reflect.Value) error {
+			v, err := d.DecodeFloat32()
+			if err == nil {
+				rv.SetFloat(float64(v))
+			}
+			return err
+		}
+	case reflect.Float64:
+		p.enc = func(e *Encoder, rv reflect.Value) error { return e.EncodeFloat64(rv.Float()) }
+		p.dec = func(d *Decoder, rv reflect.Value) error {
+			v, err := d.DecodeFloat64()
+			if err == nil {
+				rv.SetFloat(v)
+			}
+			return err
+		}
+	case reflect.Complex64:
+		p.enc = func(e *Encoder, rv reflect.Value) error { return e.EncodeComplex64(complex64(rv.Complex())) }
+		p.dec = func(d *Decoder, rv reflect.Value) error {
+			v, err := d.DecodeComplex64()
+			if err == nil {
+				rv.SetComplex(complex128(v))
+			}
+			return err
+		}
+	case reflect.Complex128:
+		p.enc = func(e *Encoder, rv reflect.Value) error { return e.EncodeComplex128(rv.Complex()) }
+		p.dec = func(d *Decoder, rv reflect.Value) error {
+			v, err := d.DecodeComplex128()
+			if err == nil {
+				rv.SetComplex(v)
+			}
+			return err
+		}
+	case reflect.String:
+		p.enc = func(e *Encoder, rv reflect.Value) error { return e.EncodeString(rv.String()) }
+		p.dec = func(d *Decoder, rv reflect.Value) error {
+			v, err := d.DecodeString()
+			if err == nil && v != "" {
+				rv.SetString(v)
+			}
+			return err
+		}
+	case reflect.Slice:
+		switch t.Elem().Kind() {
+		case reflect.Int8, reflect.Uint8, reflect.Bool: // copied as bytes
+			p.enc, p.dec = (*Encoder).InternalEncode, (*Decoder).InternalDecode
+			return
+		}
+		var el *plan
+		if el, err = ts.compile(t.Elem(), ps); err != nil {
+			return
+		}
+		p.enc = func(e *Encoder, rv reflect.Value) (err error) {
+			l := rv.Len()
+			if err = e.EncodeInt(int64(l)); err != nil {
+				return
+			}
+			for x := 0; x < l; x++ {
+				if err = el.enc(e, rv.Index(x)); err != nil {
+					return
+				}
+			}
+			return
+		}
+		p.dec = func(d *Decoder, rv reflect.Value) (err error) {
+			i, err := d.DecodeInt()
+			if err != nil || i <= 0 {
+				return
+			}
+			if rv.IsNil() || rv.Cap() < int(i) {
+				rv.Set(reflect.MakeSlice(rv.Type(), int(i), int(i)))
+			} else {
+				rv.SetLen(int(i))
+			}
+			for x := 0; x < int(i); x++ {
+				if err = el.dec(d, rv.Index(x)); err != nil {
+					return
+				}
+			}
+			return
+		}
+	case reflect.Array:
+		var el *plan
+		if el, err = ts.compile(t.Elem(), ps); err != nil {
+			return
+		}
+		n := t.Len()
+		p.enc = func(e *Encoder, rv reflect.Value) (err error) {
+			for x := 0; x < n; x++ {
+				if err = el.enc(e, rv.Index(x)); err != nil {
+					return
+				}
+			}
+			return
+		}
+		p.dec = func(d *Decoder, rv reflect.Value) (err error) {
+			for x := 0; x < n; x++ {
+				if err = el.dec(d, rv.Index(x)); err != nil {
+					return
+				}
+			}
+			return
+		}
+	case reflect.Map:
+		var kp, vp *plan
+		if kp, err = ts.compile(t.Key(), ps); err != nil {
+			return
+		}
+		if vp, err = ts.compile(t.Elem(), ps); err != nil {
+			return
+		}
+		p.enc = func(e *Encoder, rv reflect.Value) (err error) {
+			if err = e.EncodeInt(int64(rv.Len())); err != nil {
+				return
+			}
+			it := rv.MapRange()
+			for it.Next() {
+				if err = kp.enc(e, it.Key()); err != nil {
+					return
+				}
+				if err = vp.enc(e, it.Value()); err != nil {
+					return
+				}
+			}
+			return
+		}
+		p.dec = func(d *Decoder, rv reflect.Value) (err error) {
+			i, err := d.DecodeInt()
+			if err != nil || i <= 0 {
+				return
+			}
+			if rv.IsNil() {
+				rv.Set(reflect.MakeMap(rv.Type()))
+			}
+			for x := 0; x < int(i); x++ {
+				k := reflect.New(t.Key()).Elem()
+				v := reflect.New(t.Elem()).Elem()
+				if err = kp.dec(d, k); err != nil {
+					return
+				}
+				if err = vp.dec(d, v); err != nil {
+					return
+				}
+				rv.SetMapIndex(k, v)
+			}
+			return
+		}
+	case reflect.Ptr:
+		var el *plan
+		if el, err = ts.compile(t.Elem(), ps); err != nil {
+			return
+		}
+		p.enc = func(e *Encoder, rv reflect.Value) (err error) {
+			if err = e.EncodeBool(!rv.IsNil()); err != nil || rv.IsNil() {
+				return
+			}
+			return el.enc(e, rv.Elem())
+		}
+		p.dec = func(d *Decoder, rv reflect.Value) (err error) {
+			c, err := d.DecodeUint8()
+			if err != nil || c <= 0 {
+				return
+			}
+			if rv.IsNil() {
+				rv.Set(reflect.New(t.Elem()))
+			}
+			return el.dec(d, rv.Elem())
+		}
+	case reflect.Interface: // of the registered types
+		p.enc, p.dec = (*Encoder).InternalEncode, (*Decoder).InternalDecode
+	case reflect.Struct:
+		err = ts.compileStruct(p, t, ps)
+	default:
+		err = fmt.Errorf("unexpected kind: %v", t.Kind())
+	}
+	return
+}
+
+// compileStruct of the methods, the codec or the fields, in the order of InternalEncode
+func (ts *Types) compileStruct(p *plan, t reflect.Type, ps map[reflect.Type]*plan) (err error) {
+	pt := reflect.PtrTo(t)
+	if pt.Implements(marshalerType) {
+		p.enc = func(e *Encoder, rv reflect.Value) error {
+			if !e.noMethods && rv.CanAddr() && rv.CanInterface() {
+				return rv.Addr().Interface().(Marshaler).MarshalSchema(e)
+			}
+			return e.InternalEncode(rv)
+		}
+	}
+	if pt.Implements(unmarshalerType) {
+		p.dec = func(d *Decoder, rv reflect.Value) error {
+			if !d.noMethods && !d.Defaults && rv.CanAddr() && rv.CanInterface() {
+				return rv.Addr().Interface().(Unmarshaler).UnmarshalSchema(d)
+			}
+			return d.InternalDecode(rv)
+		}
+	}
+	if p.enc != nil && p.dec != nil {
+		return
+	}
+	if c := ts.cd[t]; c != nil {
+		if p.enc == nil {
+			p.enc = func(e *Encoder, rv reflect.Value) error { return c.encode(rv, e) }
+		}
+		if p.dec == nil {
+			p.dec = func(d *Decoder, rv reflect.Value) error { return c.decode(rv, d) }
+		}
+		return
+	}
+	fs := make([]*plan, t.NumField())
+	for x := range fs {
+		if fs[x], err = ts.compile(t.Field(x).Type, ps); err != nil {
+			return fmt.Errorf("%s.%s: %v", t, t.Field(x).Name, err)
+		}
+	}
+	if p.enc == nil {
+		p.enc = func(e *Encoder, rv reflect.Value) (err error) {
+			for x, f := range fs {
+				if err = f.enc(e, rv.Field(x)); err != nil {
+					return
+				}
+			}
+			return
+		}
+	}
+	if p.dec == nil {
+		p.dec = func(d *Decoder, rv reflect.Value) (err error) {
+			if d.Defaults { // applied and tolerating a short stream
+				return d.InternalDecode(rv)
+			}
+			for x, f := range fs {
+				if err = f.dec(d, rv.Field(x)); err != nil {
+					return
+				}
+			}
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,135 @@
+package schema_test
+
+import (
+	"bytes"
+	"github.com/fengyoulin/schema"
+	"io"
+	"reflect"
+	"testing"
+)
+
+type codecNode struct {
+	ID    uint
+	Name  string
+	Tags  []string
+	Score map[string]float32
+	Grid  [2]int8
+	Data  []byte
+	Fixed Fixed
+	Any   interface{}
+	Next  *codecNode
+}
+
+func TestCodec(t *testing.T) {
+	ts := schema.New()
+	if err := ts.AddType(reflect.TypeOf(Fixed{})); err != nil {
+		t.Fatal(err)
+	}
+	c, err := schema.NewCodec[codecNode](ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := codecNode{ID: 1, Name: "a", Tags: []string{"x", ""}, Score: map[string]float32{"s": 1.5}, Grid: [2]int8{-1, 2},
+		Data: []byte{3}, Fixed: Fixed{0x1200}, Any: Fixed{0x3400}, Next: &codecNode{ID: 2, Next: &codecNode{ID: 3}}}
+	b, err := c.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := &bytes.Buffer{}
+	if err = (&schema.Encoder{Writer: exp, Types: ts}).Encode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, exp.Bytes()) {
+		t.Errorf("% x != % x", b, exp.Bytes())
+	}
+	r, err := c.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r, v) {
+		t.Errorf("%+v != %+v", r, v)
+	}
+	if _, err = c.Unmarshal(append(b, 0)); err == nil || err.Error() != "1 trailing bytes" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err = c.Unmarshal(b[:len(b)-1]); err == nil {
+		t.Error("expected error")
+	}
+	if r, err = c.Unmarshal([]byte{0}); err != nil || !reflect.DeepEqual(r, codecNode{}) {
+		t.Errorf("unexpected value: %+v, error: %v", r, err)
+	}
+	if _, err = schema.NewCodec[struct{ C chan int }](ts); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestCodec_Stream(t *testing.T) {
+	c, err := schema.NewCodec[*Fixed](nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &bytes.Buffer{}
+	e := c.NewEncoder(b)
+	vs := []*Fixed{{0x100}, nil, {0x200}}
+	for _, v := range vs {
+		if err = e.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if exp := []byte{1, 1, 1, 1, 0, 1, 1, 2}; !bytes.Equal(b.Bytes(), exp) {
+		t.Errorf("% x != % x", b.Bytes(), exp)
+	}
+	d := c.NewDecoder(bytes.NewReader(b.Bytes()))
+	for i, exp := range vs {
+		v, err := d.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(v, exp) {
+			t.Errorf("%d: %v != %v", i, v, exp)
+		}
+	}
+	if _, err = d.Decode(); err != io.EOF {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if d.Offset() != int64(b.Len()) {
+		t.Errorf("offset %d != %d", d.Offset(), b.Len())
+	}
+}
+
+func TestCodec_AddType(t *testing.T) {
+	ts := newTypes(t, testMapDef, testMapAdded...)
+	type Color struct {
+		Value uint8 `enum:"Color"`
+	}
+	c, err := schema.NewCodec[Color](ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := c.Marshal(Color{Value: 2}); err != nil || !bytes.Equal(b, []byte{1, 2}) {
+		t.Errorf("unexpected bytes: % x, error: %v", b, err)
+	}
+	if err = ts.AddType(reflect.TypeOf(Color{})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Marshal(Color{Value: 2}); err == nil {
+		t.Error("expected error of the enum codec")
+	}
+	c.Validate = true
+	if v, err := c.Unmarshal([]byte{1, 1}); err != nil || v.Value != 1 {
+		t.Errorf("unexpected value: %+v, error: %v", v, err)
+	}
+}
+
+func BenchmarkCodec_Marshal(b *testing.B) {
+	c, err := schema.NewCodec[codecNode](nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	v := codecNode{ID: 1, Name: "a", Tags: []string{"x", "y"}, Grid: [2]int8{-1, 2}, Next: &codecNode{ID: 2}}
+	for i := 0; i < b.N; i++ {
+		if _, err = c.Marshal(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
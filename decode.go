@@ -1,6 +1,7 @@
 package schema
 
 import (
+	"bufio"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -13,6 +14,24 @@ type Decoder struct {
 	io.Reader
 	Extend map[reflect.Type]func(reflect.Value, *Decoder) error
 	Types  *Types
+	// Defaults of Field are applied to structs before decoding, and a stream
+	// ending before the trailing fields, as written by an older schema, is
+	// accepted with those fields left at their defaults
+	Defaults bool
+	// Validate each decoded value by Types
+	Validate bool
+	// Proto reads the rest of Reader as a message in the protobuf wire format
+	// into the struct of Decode, by the field numbers of ProtoTag. Defaults
+	// is ignored, as the zero values are omitted by proto3
+	Proto bool
+
+	noMethods bool // Unmarshaler is ignored
+}
+
+// Unmarshaler is implemented by the pointers of types with generated methods,
+// called by Decoder instead of reflection unless Defaults is set
+type Unmarshaler interface {
+	UnmarshalSchema(d *Decoder) error
 }
 
 // Decode the data
@@ -21,100 +40,74 @@ func (d *Decoder) Decode(a interface{}) (err error) {
 	if rv.Kind() != reflect.Ptr {
 		return fmt.Errorf("%T is not pointer", a)
 	}
-	return d.InternalDecode(rv)
+	if d.Proto {
+		err = d.decodeProto(rv.Elem())
+	} else {
+		err = d.InternalDecode(rv)
+	}
+	if err != nil {
+		return
+	}
+	if d.Validate && d.Types != nil {
+		return d.Types.Validate(a)
+	}
+	return
 }
 
 // InternalDecode should be used to extend only
 func (d *Decoder) InternalDecode(rv reflect.Value) (err error) {
-	br, ok := d.Reader.(io.ByteReader)
-	if !ok {
-		br = &byteReader{d.Reader}
-	}
+	br := d.byteReader()
 	switch rv.Kind() {
 	case reflect.Bool:
-		var c byte
-		if c, err = br.ReadByte(); err != nil {
-			return
+		var v bool
+		if v, err = d.DecodeBool(); err == nil {
+			rv.SetBool(v)
 		}
-		rv.SetBool(c != 0)
 	case reflect.Int8:
-		var i int8
-		if *(*byte)(unsafe.Pointer(&i)), err = br.ReadByte(); err != nil {
-			return
+		var v int8
+		if v, err = d.DecodeInt8(); err == nil {
+			rv.SetInt(int64(v))
 		}
-		rv.SetInt(int64(i))
 	case reflect.Uint8:
-		var u uint8
-		if u, err = br.ReadByte(); err != nil {
-			return
+		var v uint8
+		if v, err = d.DecodeUint8(); err == nil {
+			rv.SetUint(uint64(v))
 		}
-		rv.SetUint(uint64(u))
 	case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64:
-		var i int64
-		if i, err = binary.ReadVarint(br); err != nil {
-			return
+		var v int64
+		if v, err = d.DecodeInt(); err == nil {
+			rv.SetInt(v)
 		}
-		rv.SetInt(i)
 	case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		var u uint64
-		if u, err = binary.ReadUvarint(br); err != nil {
-			return
+		var v uint64
+		if v, err = d.DecodeUint(); err == nil {
+			rv.SetUint(v)
 		}
-		rv.SetUint(u)
 	case reflect.Float32:
 		var v float32
-		var n int
-		if n, err = d.Reader.Read((*(*[4]byte)(unsafe.Pointer(&v)))[:]); err != nil {
-			return
-		}
-		if n != 4 {
-			return io.EOF
+		if v, err = d.DecodeFloat32(); err == nil {
+			rv.SetFloat(float64(v))
 		}
-		rv.SetFloat(float64(v))
 	case reflect.Float64:
 		var v float64
-		var n int
-		if n, err = d.Reader.Read((*(*[8]byte)(unsafe.Pointer(&v)))[:]); err != nil {
-			return
-		}
-		if n != 8 {
-			return io.EOF
+		if v, err = d.DecodeFloat64(); err == nil {
+			rv.SetFloat(v)
 		}
-		rv.SetFloat(v)
 	case reflect.Complex64:
 		var v complex64
-		var n int
-		if n, err = d.Reader.Read((*(*[8]byte)(unsafe.Pointer(&v)))[:]); err != nil {
-			return
-		}
-		if n != 8 {
-			return io.EOF
+		if v, err = d.DecodeComplex64(); err == nil {
+			rv.SetComplex(complex128(v))
 		}
-		rv.SetComplex(complex128(v))
 	case reflect.Complex128:
 		var v complex128
-		var n int
-		if n, err = d.Reader.Read((*(*[16]byte)(unsafe.Pointer(&v)))[:]); err != nil {
-			return
-		}
-		if n != 16 {
-			return io.EOF
+		if v, err = d.DecodeComplex128(); err == nil {
+			rv.SetComplex(v)
 		}
-		rv.SetComplex(v)
 	case reflect.String:
-		var i int64
-		if i, err = binary.ReadVarint(br); err != nil || i <= 0 {
-			return
-		}
-		slc := make([]byte, i)
-		var n int
-		if n, err = d.Reader.Read(slc); err != nil {
-			return
+		var v string
+		if v, err = d.DecodeString(); err == nil && v != "" {
+			rv.SetString(v)
 		}
-		if n != len(slc) {
-			return io.EOF
-		}
-		rv.SetString(*(*string)(unsafe.Pointer(&slc)))
 	case reflect.Slice:
 		var i int64
 		if i, err = binary.ReadVarint(br); err != nil || i <= 0 {
@@ -175,7 +168,31 @@ func (d *Decoder) InternalDecode(rv reflect.Value) (err error) {
 		if fn, ok := d.Extend[rv.Type()]; ok {
 			return fn(rv, d)
 		}
+		if !d.noMethods && !d.Defaults && rv.CanAddr() && rv.CanInterface() {
+			if u, ok := rv.Addr().Interface().(Unmarshaler); ok {
+				return u.UnmarshalSchema(d)
+			}
+		}
+		if d.Types != nil {
+			if c := d.Types.codecOf(rv.Type()); c != nil {
+				return c.decode(rv, d)
+			}
+		}
+		if d.Defaults && d.Types != nil {
+			if err = d.Types.applyDefaults(rv, false); err != nil {
+				return
+			}
+		}
+		if d.Defaults && rv.NumField() > 1 {
+			defer d.scanning()()
+		}
 		for x := 0; x < rv.NumField(); x++ {
+			if x > 0 && d.Defaults {
+				var end bool
+				if end, err = d.atEOF(); err != nil || end {
+					return
+				}
+			}
 			if err = d.InternalDecode(rv.Field(x)); err != nil {
 				return
 			}
@@ -220,6 +237,156 @@ func (d *Decoder) InternalDecode(rv reflect.Value) (err error) {
 	return
 }
 
+// DecodeBool of a byte
+func (d *Decoder) DecodeBool() (v bool, err error) {
+	c, err := d.byteReader().ReadByte()
+	return c != 0, err
+}
+
+// DecodeInt8 of a byte
+func (d *Decoder) DecodeInt8() (v int8, err error) {
+	*(*byte)(unsafe.Pointer(&v)), err = d.byteReader().ReadByte()
+	return
+}
+
+// DecodeUint8 of a byte
+func (d *Decoder) DecodeUint8() (v uint8, err error) {
+	return d.byteReader().ReadByte()
+}
+
+// DecodeInt of a varint, also the length of a string, slice or map
+func (d *Decoder) DecodeInt() (v int64, err error) {
+	return binary.ReadVarint(d.byteReader())
+}
+
+// DecodeUint of an uvarint
+func (d *Decoder) DecodeUint() (v uint64, err error) {
+	return binary.ReadUvarint(d.byteReader())
+}
+
+// DecodeFloat32 of the memory layout
+func (d *Decoder) DecodeFloat32() (v float32, err error) {
+	err = d.read((*(*[4]byte)(unsafe.Pointer(&v)))[:])
+	return
+}
+
+// DecodeFloat64 of the memory layout
+func (d *Decoder) DecodeFloat64() (v float64, err error) {
+	err = d.read((*(*[8]byte)(unsafe.Pointer(&v)))[:])
+	return
+}
+
+// DecodeComplex64 of the memory layout
+func (d *Decoder) DecodeComplex64() (v complex64, err error) {
+	err = d.read((*(*[8]byte)(unsafe.Pointer(&v)))[:])
+	return
+}
+
+// DecodeComplex128 of the memory layout
+func (d *Decoder) DecodeComplex128() (v complex128, err error) {
+	err = d.read((*(*[16]byte)(unsafe.Pointer(&v)))[:])
+	return
+}
+
+// DecodeString of the length and bytes, empty if the length is not positive
+func (d *Decoder) DecodeString() (v string, err error) {
+	b, err := d.DecodeBytes()
+	if len(b) > 0 {
+		v = *(*string)(unsafe.Pointer(&b))
+	}
+	return
+}
+
+// DecodeBytes of the length and bytes, nil if the length is not positive
+func (d *Decoder) DecodeBytes() (v []byte, err error) {
+	i, err := d.DecodeInt()
+	if err != nil || i <= 0 {
+		return
+	}
+	v = make([]byte, i)
+	if err = d.read(v); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// read b fully, io.EOF if short
+func (d *Decoder) read(b []byte) (err error) {
+	n, err := d.Reader.Read(b)
+	if err == nil && n != len(b) {
+		err = io.EOF
+	}
+	return
+}
+
+func (d *Decoder) byteReader() io.ByteReader {
+	if br, ok := d.Reader.(io.ByteReader); ok {
+		return br
+	}
+	return &byteReader{d.Reader}
+}
+
+// scanning makes Reader an io.ByteScanner for atEOF, until the returned
+// func restores it
+func (d *Decoder) scanning() func() {
+	if _, ok := d.Reader.(io.ByteScanner); ok {
+		return func() {}
+	}
+	r := d.Reader
+	d.Reader = &scanReader{Reader: r}
+	return func() { d.Reader = r }
+}
+
+// atEOF reports whether the stream ends before the next value, without
+// consuming a byte of it, in scanning
+func (d *Decoder) atEOF() (bool, error) {
+	bs := d.Reader.(io.ByteScanner)
+	if _, err := bs.ReadByte(); err != nil {
+		if err == io.EOF {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, bs.UnreadByte()
+}
+
+// scanReader of a Reader with the last byte read by ReadByte unread
+type scanReader struct {
+	io.Reader
+	c    byte
+	back bool
+}
+
+// Read the unread byte with the rest of p from the Reader
+func (r *scanReader) Read(p []byte) (n int, err error) {
+	if !r.back || len(p) == 0 {
+		return r.Reader.Read(p)
+	}
+	p[0], r.back = r.c, false
+	if len(p) > 1 {
+		n, err = r.Reader.Read(p[1:])
+	}
+	return n + 1, err
+}
+
+func (r *scanReader) ReadByte() (b byte, err error) {
+	if r.back {
+		r.back = false
+		return r.c, nil
+	}
+	var buf [1]byte
+	if _, err = io.ReadFull(r.Reader, buf[:]); err != nil {
+		return
+	}
+	r.c = buf[0]
+	return r.c, nil
+}
+
+func (r *scanReader) UnreadByte() error {
+	r.back = true
+	return nil
+}
+
 type byteReader struct {
 	io.Reader
 }
@@ -235,3 +402,36 @@ func (r *byteReader) ReadByte() (b byte, err error) {
 	}
 	return buf[0], nil
 }
+
+// streamReader reads fully as the Decoder expects, and counts the offset
+type streamReader struct {
+	br  *bufio.Reader
+	off int64
+}
+
+func newStreamReader(r io.Reader) *streamReader {
+	return &streamReader{br: bufio.NewReader(r)}
+}
+
+func (r *streamReader) Read(p []byte) (n int, err error) {
+	n, err = io.ReadFull(r.br, p)
+	r.off += int64(n)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return
+}
+
+func (r *streamReader) ReadByte() (b byte, err error) {
+	if b, err = r.br.ReadByte(); err == nil {
+		r.off++
+	}
+	return
+}
+
+func (r *streamReader) UnreadByte() (err error) {
+	if err = r.br.UnreadByte(); err == nil {
+		r.off--
+	}
+	return
+}
@@ -0,0 +1,66 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+type defaultValue struct {
+	index int
+	value json.RawMessage // nil for a nested struct with defaults
+}
+
+// NewValue creates a pointer to a new value of the named type, with defaults applied
+func (ts *Types) NewValue(name string) (v reflect.Value, err error) {
+	t, ok := ts.TypeByName(name)
+	if !ok {
+		return v, fmt.Errorf("unknown type: %s", name)
+	}
+	v = reflect.New(t)
+	if err = ts.applyDefaults(v.Elem(), true); err != nil {
+		return reflect.Value{}, err
+	}
+	return
+}
+
+// applyDefaults of a struct value, nested structs are visited if deep
+func (ts *Types) applyDefaults(rv reflect.Value, deep bool) (err error) {
+	ts.lk.RLock()
+	dv, ok := ts.df[rv.Type()]
+	ts.lk.RUnlock()
+	if !ok {
+		return
+	}
+	for _, d := range dv {
+		fv := rv.Field(d.index)
+		if d.value == nil {
+			if deep {
+				if err = ts.applyDefaults(fv, deep); err != nil {
+					return
+				}
+			}
+			continue
+		}
+		fv.Set(reflect.Zero(fv.Type()))
+		if err = json.Unmarshal(d.value, fv.Addr().Interface()); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// defaultOf a type, as a missing field is decoded: the first member of an
+// enum, or a struct with the defaults of its fields
+func (ts *Types) defaultOf(t reflect.Type) (v reflect.Value, err error) {
+	v = reflect.New(t).Elem()
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	if c, ok := ts.codecOf(t).(*enumCodec); ok {
+		v.Field(0).Set(c.values[0])
+		return
+	}
+	err = ts.applyDefaults(v, true)
+	return
+}
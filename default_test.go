@@ -0,0 +1,114 @@
+package schema_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/fengyoulin/schema"
+	"io"
+	"reflect"
+	"testing"
+)
+
+const testDefaultDef = `
+[{"name":"Option","fields":[
+{"name":"Key","type":"string","default":"k"},
+{"name":"Value","type":"int","default":7}
+]},
+{"name":"Config","fields":[
+{"name":"Name","type":"string","default":"cfg"},
+{"name":"Size","type":"uint"},
+{"name":"Option","type":"Option"},
+{"name":"Ratio","type":"float64","default":0.5},
+{"name":"Tags","type":"[]string","default":["a","b"]}
+]}]
+`
+
+func TestTypes_NewValue(t *testing.T) {
+	ts := newTypes(t, testDefaultDef)
+	v, err := ts.NewValue("Config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := `{"Name":"cfg","Size":0,"Option":{"Key":"k","Value":7},"Ratio":0.5,"Tags":["a","b"]}`
+	if string(b) != exp {
+		t.Errorf("%s != %s", b, exp)
+	}
+}
+
+func TestTypes_CreateSchemaInvalidDefault(t *testing.T) {
+	s := schema.Schema{Name: "Bad", Fields: []schema.Field{
+		{Name: "Count", Type: "uint8", Default: json.RawMessage(`"many"`)},
+	}}
+	if _, err := schema.New().CreateSchema(s); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestDecoder_DecodeDefaults(t *testing.T) {
+	ts := newTypes(t, testDefaultDef)
+	// Name: "x", Size: 3, Option.Key: "y", the rest absent
+	buf := []byte{1, 2, 'x', 3, 2, 'y'}
+	v, err := ts.NewValue("Config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &schema.Decoder{
+		Reader:   bytes.NewReader(buf),
+		Types:    ts,
+		Defaults: true,
+	}
+	if err = d.Decode(v.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := `{"Name":"x","Size":3,"Option":{"Key":"y","Value":7},"Ratio":0.5,"Tags":["a","b"]}`
+	if string(b) != exp {
+		t.Errorf("%s != %s", b, exp)
+	}
+	d = &schema.Decoder{
+		Reader: bytes.NewReader(buf),
+		Types:  ts,
+	}
+	if err = d.Decode(v.Interface()); err == nil {
+		t.Error("expected error without defaults")
+	}
+	// cut in the middle of Option.Key, with and without io.ByteScanner
+	for _, r := range []io.Reader{bytes.NewReader(buf[:5]), struct{ io.Reader }{bytes.NewReader(buf[:5])}} {
+		d = &schema.Decoder{Reader: r, Types: ts, Defaults: true}
+		if err = d.Decode(v.Interface()); err == nil {
+			t.Error("expected error of a stream cut in a field")
+		}
+	}
+	d = &schema.Decoder{Reader: struct{ io.Reader }{bytes.NewReader(buf)}, Types: ts, Defaults: true}
+	if err = d.Decode(v.Interface()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// a float after a peek, without io.ByteScanner
+	v.Elem().FieldByName("Ratio").SetFloat(1.5)
+	w := &bytes.Buffer{}
+	if err = (&schema.Encoder{Writer: w, Types: ts}).Encode(v.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	r, err := ts.NewValue("Config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr := struct{ io.Reader }{w}
+	d = &schema.Decoder{Reader: sr, Types: ts, Defaults: true}
+	if err = d.Decode(r.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r.Interface(), v.Interface()) {
+		t.Errorf("%+v != %+v", r.Elem().Interface(), v.Elem().Interface())
+	}
+	if d.Reader != sr {
+		t.Error("reader not restored")
+	}
+}
@@ -0,0 +1,178 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Converter copies the fields shared by two struct values, dst must be settable
+type Converter func(dst, src reflect.Value)
+
+type derivation struct {
+	src   string
+	index []int  // index of the source field for each field
+	ptr   []bool // field is a pointer to the source field
+}
+
+// Pick creates schema dst with the named fields of src
+func (ts *Types) Pick(src, dst string, names ...string) (t reflect.Type, err error) {
+	set := nameSet(names)
+	return ts.derive(src, dst, func(f *Field) (keep bool, err error) {
+		_, keep = set[fieldName(f)]
+		delete(set, fieldName(f))
+		return
+	}, set)
+}
+
+// Omit creates schema dst with the fields of src except the named
+func (ts *Types) Omit(src, dst string, names ...string) (t reflect.Type, err error) {
+	set := nameSet(names)
+	return ts.derive(src, dst, func(f *Field) (keep bool, err error) {
+		_, ok := set[fieldName(f)]
+		delete(set, fieldName(f))
+		return !ok, nil
+	}, set)
+}
+
+// Rename creates schema dst with the fields of src renamed by names, from old to new,
+// a json tag naming the old field follows the new name
+func (ts *Types) Rename(src, dst string, names map[string]string) (t reflect.Type, err error) {
+	set := make(map[string]struct{}, len(names))
+	for k := range names {
+		set[k] = struct{}{}
+	}
+	return ts.derive(src, dst, func(f *Field) (keep bool, err error) {
+		old := fieldName(f)
+		nm, ok := names[old]
+		if !ok {
+			return true, nil
+		}
+		delete(set, old)
+		if f.Embedded {
+			return false, fmt.Errorf("rename embedded field: %s", old)
+		}
+		f.Name, f.Ident = nm, ""
+		if js, ok := f.Tags["json"]; ok && (js == old || strings.HasPrefix(js, old+",")) {
+			tags := make(map[string]string, len(f.Tags))
+			for k, v := range f.Tags {
+				tags[k] = v
+			}
+			tags["json"] = nm + js[len(old):]
+			delete(tags, "schema")
+			f.Tags = tags
+		}
+		return true, nil
+	}, set)
+}
+
+// Optional creates schema dst with every field of src as a pointer
+func (ts *Types) Optional(src, dst string) (t reflect.Type, err error) {
+	return ts.derive(src, dst, func(f *Field) (keep bool, err error) {
+		if !strings.HasPrefix(f.Type, "*") {
+			if f.Type == "" && len(f.Fields) > 0 {
+				f.Type = "struct"
+			}
+			f.Type = "*" + f.Type
+		}
+		if f.Constraints != nil && f.Constraints.Required {
+			c := *f.Constraints
+			c.Required = false
+			f.Constraints = &c
+		}
+		return true, nil
+	}, nil)
+}
+
+// Converter between a schema and one derived from it, in either direction
+func (ts *Types) Converter(from, to string) (c Converter, err error) {
+	ts.lk.RLock()
+	defer ts.lk.RUnlock()
+	if d, ok := ts.dv[to]; ok && d.src == from {
+		return func(dst, src reflect.Value) {
+			for i, x := range d.index {
+				sv := src.Field(x)
+				if d.ptr[i] {
+					p := reflect.New(sv.Type())
+					p.Elem().Set(sv)
+					sv = p
+				}
+				dst.Field(i).Set(sv)
+			}
+		}, nil
+	}
+	if d, ok := ts.dv[from]; ok && d.src == to {
+		return func(dst, src reflect.Value) {
+			for i, x := range d.index {
+				sv := src.Field(i)
+				if d.ptr[i] {
+					if sv.IsNil() {
+						sv = reflect.Zero(sv.Type().Elem())
+					} else {
+						sv = sv.Elem()
+					}
+				}
+				dst.Field(x).Set(sv)
+			}
+		}, nil
+	}
+	return nil, fmt.Errorf("%s is not derived from %s", to, from)
+}
+
+// derive schema dst from the fields of src, fn filters and modifies each field,
+// names left in set are reported as unknown fields
+func (ts *Types) derive(src, dst string, fn func(f *Field) (bool, error), set map[string]struct{}) (t reflect.Type, err error) {
+	ts.lk.Lock()
+	defer ts.lk.Unlock()
+	if _, ok := ts.tm[dst]; ok {
+		return nil, fmt.Errorf("type already exists: %s", dst)
+	}
+	st, err := ts.createType(src)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := ts.fieldsOf(src)
+	if err != nil {
+		return nil, err
+	}
+	s := Schema{Name: dst}
+	d := derivation{src: src}
+	for i, f := range fields {
+		keep, err := fn(&f)
+		if err != nil {
+			return nil, err
+		}
+		if !keep {
+			continue
+		}
+		s.Fields = append(s.Fields, f)
+		d.index = append(d.index, i)
+	}
+	for n := range set {
+		return nil, fmt.Errorf("unknown field of %s: %s", src, n)
+	}
+	if t, err = ts.createSchema(s); err != nil {
+		return nil, err
+	}
+	for i, x := range d.index {
+		d.ptr = append(d.ptr, t.Field(i).Type != st.Field(x).Type)
+	}
+	ts.dv[dst] = d
+	return
+}
+
+// fieldName in the definition, which is the type name for an embedded field
+func fieldName(f *Field) string {
+	if f.Name == "" && f.Embedded {
+		return strings.TrimPrefix(f.Type, "*")
+	}
+	return f.Name
+}
+
+func nameSet(names []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(names))
+	for _, n := range names {
+		set[n] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,74 @@
+package schema_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const testDeriveDef = `
+[{"name":"Base","fields":[{"name":"ID","type":"uint","tags":{"json":"ID,omitempty"}}]},
+{"name":"Secret","extends":["Base"],"fields":[
+{"name":"Email","type":"string","tags":{"json":"email"}},
+{"name":"Password","type":"string","tags":{"json":"password"},"constraints":{"required":true}},
+{"name":"Token","type":"*string","tags":{"json":"token"}}
+]}]
+`
+
+func TestTypes_Derive(t *testing.T) {
+	ts := newTypes(t, testDeriveDef)
+	src, _ := ts.NewValue("Secret")
+	if err := json.Unmarshal([]byte(`{"ID":7,"email":"a@b","password":"x","token":"t"}`), src.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		fn   func() (reflect.Type, error)
+		exp  string
+	}{
+		{"Public", func() (reflect.Type, error) { return ts.Omit("Secret", "Public", "Password", "Token") }, `{"ID":7,"email":"a@b"}`},
+		{"Login", func() (reflect.Type, error) { return ts.Pick("Secret", "Login", "Email", "Password") }, `{"email":"a@b","password":"x"}`},
+		{"Renamed", func() (reflect.Type, error) {
+			return ts.Rename("Secret", "Renamed", map[string]string{"Email": "Mail", "ID": "Key"})
+		}, `{"Key":7,"email":"a@b","password":"x","token":"t"}`},
+		{"Patch", func() (reflect.Type, error) { return ts.Optional("Secret", "Patch") }, `{"ID":7,"email":"a@b","password":"x","token":"t"}`},
+	}
+	for _, c := range cases {
+		if _, err := c.fn(); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		cv, err := ts.Converter("Secret", c.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst, _ := ts.NewValue(c.name)
+		cv(dst.Elem(), src.Elem())
+		if b, _ := json.Marshal(dst.Interface()); string(b) != c.exp {
+			t.Errorf("%s: %s != %s", c.name, b, c.exp)
+		}
+		back, err := ts.Converter(c.name, "Secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		o, _ := ts.NewValue("Secret")
+		back(o.Elem(), dst.Elem())
+		if c.name == "Patch" && !reflect.DeepEqual(o.Interface(), src.Interface()) {
+			t.Errorf("%v != %v", o.Interface(), src.Interface())
+		}
+	}
+	if pt, _ := ts.TypeByName("Patch"); pt.Field(0).Type.Kind() != reflect.Ptr || pt.Field(3).Type.Elem().Kind() != reflect.String {
+		t.Errorf("unexpected type: %v", pt)
+	}
+	if p, _ := ts.NewValue("Patch"); ts.Validate(p.Interface()) != nil {
+		t.Error("unexpected required constraint")
+	}
+	if _, err := ts.Pick("Secret", "Bad", "Unknown"); err == nil {
+		t.Error("expected unknown field error")
+	}
+	if _, err := ts.Pick("Secret", "Public"); err == nil {
+		t.Error("expected existing type error")
+	}
+	if _, err := ts.Converter("Public", "Login"); err == nil {
+		t.Error("expected not derived error")
+	}
+}
@@ -0,0 +1,680 @@
+package schema
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Dumper between the binary format and a text format, driven by the types only
+//
+// The text format is a value per line: structs are { Name: value ... } by the
+// field names of the schema, slices and arrays are [ value ... ], maps are
+// { [key]: value ... }, enums are member names, unions are the variant name
+// followed by the value, interfaces are the type name followed by the value,
+// nil pointers, interfaces and empty unions are null, strings and byte slices
+// are Go quoted, and the types of Extend are JSON. A # starts a comment, and
+// commas are optional.
+type Dumper struct {
+	Types  *Types
+	Encode map[reflect.Type]func(reflect.Value, *Encoder) error // Extend of the Encoder
+	Decode map[reflect.Type]func(reflect.Value, *Decoder) error // Extend of the Decoder
+	// Annotate each line with the offset and the type of the value as a comment
+	Annotate bool
+}
+
+type dumpState struct {
+	w   *bufio.Writer
+	d   *Decoder
+	sr  *streamReader
+	err *divergence
+}
+
+// divergence of a stream from the schema
+type divergence struct {
+	at  int64 // offset of the value
+	typ string
+}
+
+// Dump a value of the named type read from r, as written by Encode with a
+// pointer to the type, to w in the text format. If decoding fails, the dump
+// ends with comments marked by !! of the offset, the value and the next bytes.
+func (dp *Dumper) Dump(w io.Writer, r io.Reader, name string) (err error) {
+	t, ok := dp.Types.TypeByName(name)
+	if !ok {
+		return fmt.Errorf("unknown type: %s", name)
+	}
+	sr := newStreamReader(r)
+	st := &dumpState{w: bufio.NewWriter(w), d: &Decoder{Reader: sr, Extend: dp.Decode, Types: dp.Types}, sr: sr}
+	if err = dp.dump(st, reflect.PtrTo(t), "", "", -1); err != nil {
+		fmt.Fprintf(st.w, "# !! %s at @%d diverged at @%d: %v\n", st.err.typ, st.err.at, sr.off, err)
+		if rest, _ := ioutil.ReadAll(io.LimitReader(sr.br, 32)); len(rest) > 0 {
+			fmt.Fprintf(st.w, "# !! next bytes: % x\n", rest)
+		}
+		st.w.Flush()
+		return fmt.Errorf("offset %d: %v", sr.off, err)
+	}
+	return st.w.Flush()
+}
+
+func (dp *Dumper) typeName(t reflect.Type) string {
+	if s, err := dp.Types.TypeString(t); err == nil {
+		return s
+	}
+	return t.String()
+}
+
+// typeWord of a type name in the text, quoted if it has spaces
+func typeWord(s string) string {
+	if strings.ContainsAny(s, " \t\"") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// structFieldName by the schema tag, or the Go name
+func structFieldName(sf reflect.StructField) string {
+	if nm := sf.Tag.Get("schema"); nm != "" {
+		return nm
+	}
+	return sf.Name
+}
+
+func (dp *Dumper) dump(st *dumpState, t reflect.Type, indent, label string, start int64) (err error) {
+	if start < 0 {
+		start = st.sr.off
+	}
+	typ := dp.typeName(t)
+	defer func() {
+		if err != nil && st.err == nil {
+			st.err = &divergence{start, typ}
+		}
+	}()
+	line := func(text string) {
+		st.w.WriteString(indent + label + text)
+		if dp.Annotate {
+			fmt.Fprintf(st.w, "  # @%d %s", start, typ)
+		}
+		st.w.WriteByte('\n')
+	}
+	d := st.d
+	br := d.byteReader()
+	if _, ok := d.Extend[t]; ok && t.Kind() == reflect.Struct {
+		v, err := leaf(d, t)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(v.Interface())
+		if err != nil {
+			return err
+		}
+		line(string(b))
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		switch c := dp.Types.codecOf(t).(type) {
+		case *enumCodec:
+			v, err := leaf(d, t)
+			if err != nil {
+				return err
+			}
+			nm, _ := dp.Types.Member(v)
+			line(nm)
+			return nil
+		case *unionCodec:
+			var u uint64
+			if u, err = binary.ReadUvarint(br); err != nil {
+				return
+			}
+			if u == 0 {
+				line("null")
+				return
+			}
+			if u > uint64(len(c.types)) {
+				return fmt.Errorf("variant %d out of range of union: %s", u-1, c.name)
+			}
+			return dp.dump(st, c.types[u-1], indent, label+c.names[u-1]+" ", start)
+		}
+		line("{")
+		for x := 0; x < t.NumField(); x++ {
+			sf := t.Field(x)
+			if err = dp.dump(st, sf.Type, indent+"  ", structFieldName(sf)+": ", -1); err != nil {
+				return
+			}
+		}
+		st.w.WriteString(indent + "}\n")
+	case reflect.Slice, reflect.Array, reflect.Map:
+		var n int64
+		if t.Kind() == reflect.Array {
+			n = int64(t.Len())
+		} else {
+			switch t.Elem().Kind() {
+			case reflect.Int8, reflect.Uint8, reflect.Bool:
+				if t.Kind() == reflect.Slice {
+					v, err := leaf(d, t)
+					if err != nil {
+						return err
+					}
+					line(dp.text(v))
+					return nil
+				}
+			}
+			if n, err = binary.ReadVarint(br); err != nil {
+				return
+			}
+		}
+		open, close := "[", "]"
+		if t.Kind() == reflect.Map {
+			open, close = "{", "}"
+		}
+		if n <= 0 {
+			line(open + close)
+			return
+		}
+		line(open)
+		for x := int64(0); x < n; x++ {
+			lb := ""
+			at := st.sr.off
+			if t.Kind() == reflect.Map {
+				k, err := leaf(d, t.Key())
+				if err != nil {
+					return err
+				}
+				lb = "[" + dp.text(k) + "]: "
+			}
+			if err = dp.dump(st, t.Elem(), indent+"  ", lb, at); err != nil {
+				return
+			}
+		}
+		st.w.WriteString(indent + close + "\n")
+	case reflect.Ptr:
+		var c byte
+		if c, err = br.ReadByte(); err != nil {
+			return
+		}
+		if c == 0 {
+			line("null")
+			return
+		}
+		return dp.dump(st, t.Elem(), indent, label, start)
+	case reflect.Interface:
+		var nm string
+		if err = d.InternalDecode(reflect.ValueOf(&nm).Elem()); err != nil {
+			return
+		}
+		if nm == "" {
+			line("null")
+			return
+		}
+		var tp reflect.Type
+		if tp, err = dp.Types.CreateType(nm); err != nil {
+			return
+		}
+		return dp.dump(st, tp, indent, label+typeWord(nm)+" ", start)
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return fmt.Errorf("unexpected kind: %v", t.Kind())
+	default:
+		v, err := leaf(d, t)
+		if err != nil {
+			return err
+		}
+		line(dp.text(v))
+	}
+	return
+}
+
+// text of a basic value, a byte slice, or an enum
+func (dp *Dumper) text(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return strconv.Quote(v.String())
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return strconv.Quote(string(v.Bytes()))
+		}
+		ss := make([]string, v.Len())
+		for i := range ss {
+			ss[i] = dp.text(v.Index(i))
+		}
+		return "[" + strings.Join(ss, ", ") + "]"
+	case reflect.Struct:
+		if nm, ok := dp.Types.Member(v); ok {
+			return nm
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// Parse a value of the named type in the text format from r, and write it to w
+// as Encode with a pointer to the type, missing fields are written with their defaults
+func (dp *Dumper) Parse(w io.Writer, r io.Reader, name string) (err error) {
+	t, ok := dp.Types.TypeByName(name)
+	if !ok {
+		return fmt.Errorf("unknown type: %s", name)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	bw := bufio.NewWriter(w)
+	p := &textParser{s: string(b), ts: dp.Types}
+	if err = p.value(&Encoder{Writer: bw, Extend: dp.Encode, Types: dp.Types}, reflect.PtrTo(t)); err == nil {
+		if p.skip(); p.i < len(p.s) {
+			err = fmt.Errorf("unexpected %q", p.s[p.i])
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("line %d: %v", strings.Count(p.s[:p.i], "\n")+1, err)
+	}
+	return bw.Flush()
+}
+
+type textParser struct {
+	s  string
+	i  int
+	ts *Types
+}
+
+func isTextDelim(c byte) bool {
+	return c <= ' ' || strings.IndexByte("{}[]:,#\"", c) >= 0
+}
+
+// skip spaces, commas and comments
+func (p *textParser) skip() {
+	for p.i < len(p.s) {
+		switch c := p.s[p.i]; {
+		case c == '#':
+			for p.i < len(p.s) && p.s[p.i] != '\n' {
+				p.i++
+			}
+		case c <= ' ' || c == ',':
+			p.i++
+		default:
+			return
+		}
+	}
+}
+
+func (p *textParser) peek() byte {
+	if p.skip(); p.i < len(p.s) {
+		return p.s[p.i]
+	}
+	return 0
+}
+
+func (p *textParser) expect(c byte) error {
+	if p.peek() != c {
+		if p.i >= len(p.s) {
+			return fmt.Errorf("expected %q, found end", c)
+		}
+		return fmt.Errorf("expected %q, found %q", c, p.s[p.i])
+	}
+	p.i++
+	return nil
+}
+
+// null consumes the word null if it is next
+func (p *textParser) null() bool {
+	p.skip()
+	if strings.HasPrefix(p.s[p.i:], "null") && (p.i+4 == len(p.s) || isTextDelim(p.s[p.i+4])) {
+		p.i += 4
+		return true
+	}
+	return false
+}
+
+func (p *textParser) word() (string, error) {
+	p.skip()
+	j := p.i
+	for j < len(p.s) && !isTextDelim(p.s[j]) {
+		j++
+	}
+	if j == p.i {
+		return "", fmt.Errorf("expected word")
+	}
+	w := p.s[p.i:j]
+	p.i = j
+	return w, nil
+}
+
+// typeWord of a type name, which may have brackets, or be quoted
+func (p *textParser) typeWord() (string, error) {
+	if p.peek() == '"' {
+		return p.quoted()
+	}
+	j := p.i
+	for j < len(p.s) && p.s[j] > ' ' {
+		j++
+	}
+	if j == p.i {
+		return "", fmt.Errorf("expected type")
+	}
+	w := p.s[p.i:j]
+	p.i = j
+	return w, nil
+}
+
+// scanQuoted returns the end of the quoted string next
+func (p *textParser) scanQuoted() (int, error) {
+	if p.peek() != '"' {
+		return 0, fmt.Errorf("expected string")
+	}
+	for j := p.i + 1; j < len(p.s); j++ {
+		switch p.s[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated string")
+}
+
+func (p *textParser) quoted() (s string, err error) {
+	j, err := p.scanQuoted()
+	if err != nil {
+		return
+	}
+	if s, err = strconv.Unquote(p.s[p.i:j]); err != nil {
+		return
+	}
+	p.i = j
+	return
+}
+
+// rawJSON value, of the types of Extend
+func (p *textParser) rawJSON() (raw string, err error) {
+	start := p.i
+	switch p.peek() {
+	case '"':
+		var j int
+		if j, err = p.scanQuoted(); err != nil {
+			return
+		}
+		p.i = j
+	case '{', '[':
+		start = p.i
+		depth := 0
+		for p.i < len(p.s) {
+			switch p.s[p.i] {
+			case '"':
+				var j int
+				if j, err = p.scanQuoted(); err != nil {
+					return
+				}
+				p.i = j
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+			}
+			p.i++
+			if depth == 0 {
+				break
+			}
+		}
+		if depth != 0 {
+			return "", fmt.Errorf("unterminated JSON")
+		}
+	default:
+		if _, err = p.word(); err != nil {
+			return
+		}
+	}
+	return p.s[start:p.i], nil
+}
+
+func (p *textParser) value(e *Encoder, t reflect.Type) (err error) {
+	var buf [16]byte
+	if _, ok := e.Extend[t]; ok && t.Kind() == reflect.Struct {
+		p.skip()
+		raw, err := p.rawJSON()
+		if err != nil {
+			return err
+		}
+		v := reflect.New(t)
+		if err = json.Unmarshal([]byte(raw), v.Interface()); err != nil {
+			return err
+		}
+		return e.InternalEncode(v.Elem())
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		switch c := p.ts.codecOf(t).(type) {
+		case *enumCodec:
+			nm, err := p.word()
+			if err != nil {
+				return err
+			}
+			v := reflect.New(t).Elem()
+			if err = p.ts.SetMember(v, nm); err != nil {
+				return err
+			}
+			return e.InternalEncode(v)
+		case *unionCodec:
+			if p.null() {
+				_, err = e.Writer.Write([]byte{0})
+				return
+			}
+			nm, err := p.word()
+			if err != nil {
+				return err
+			}
+			for i, n := range c.names {
+				if n == nm {
+					l := binary.PutUvarint(buf[:], uint64(i+1))
+					if _, err = e.Writer.Write(buf[:l]); err != nil {
+						return err
+					}
+					return p.value(e, c.types[i])
+				}
+			}
+			return fmt.Errorf("unknown variant of union %s: %s", c.name, nm)
+		}
+		if err = p.expect('{'); err != nil {
+			return
+		}
+		index := make(map[string]int, t.NumField())
+		for x := 0; x < t.NumField(); x++ {
+			index[structFieldName(t.Field(x))] = x
+		}
+		fo := newFieldOrder(e)
+		for p.peek() != '}' {
+			nm, err := p.word()
+			if err != nil {
+				return err
+			}
+			if err = p.expect(':'); err != nil {
+				return err
+			}
+			x, ok := index[nm]
+			if !ok {
+				return fmt.Errorf("unknown field: %s", nm)
+			}
+			if err = fo.write(x, func(e *Encoder) error { return p.value(e, t.Field(x).Type) }); err != nil {
+				return fmt.Errorf("%s: %v", nm, err)
+			}
+		}
+		p.i++
+		return fo.finish(t.NumField(), func(e *Encoder, x int) error { return e.encodeDefault(t.Field(x).Type) })
+	case reflect.Slice, reflect.Map:
+		if p.null() {
+			_, err = e.Writer.Write([]byte{0})
+			return
+		}
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 && p.peek() == '"' {
+			s, err := p.quoted()
+			if err != nil {
+				return err
+			}
+			v := reflect.New(t).Elem()
+			v.SetBytes([]byte(s))
+			return e.InternalEncode(v)
+		}
+		open, close := byte('['), byte(']')
+		if t.Kind() == reflect.Map {
+			open, close = '{', '}'
+		}
+		if err = p.expect(open); err != nil {
+			return
+		}
+		b := &bytes.Buffer{}
+		be := &Encoder{Writer: b, Extend: e.Extend, Types: e.Types}
+		var n int64
+		for ; p.peek() != close; n++ {
+			if p.i >= len(p.s) {
+				return fmt.Errorf("expected %q, found end", close)
+			}
+			if t.Kind() == reflect.Map {
+				if err = p.key(be, t.Key()); err != nil {
+					return
+				}
+			}
+			if err = p.value(be, t.Elem()); err != nil {
+				return
+			}
+		}
+		p.i++
+		l := binary.PutVarint(buf[:], n)
+		if _, err = e.Writer.Write(buf[:l]); err != nil {
+			return
+		}
+		_, err = b.WriteTo(e.Writer)
+		return
+	case reflect.Array:
+		if err = p.expect('['); err != nil {
+			return
+		}
+		x := 0
+		for ; p.peek() != ']'; x++ {
+			if x >= t.Len() {
+				return fmt.Errorf("too many elements for %s", t)
+			}
+			if err = p.value(e, t.Elem()); err != nil {
+				return
+			}
+		}
+		p.i++
+		for ; x < t.Len(); x++ {
+			if err = e.encodeDefault(t.Elem()); err != nil {
+				return
+			}
+		}
+		return
+	case reflect.Ptr:
+		if p.null() {
+			_, err = e.Writer.Write([]byte{0})
+			return
+		}
+		if _, err = e.Writer.Write([]byte{1}); err != nil {
+			return
+		}
+		return p.value(e, t.Elem())
+	case reflect.Interface:
+		nm := ""
+		if !p.null() {
+			if nm, err = p.typeWord(); err != nil {
+				return
+			}
+		}
+		if err = e.InternalEncode(reflect.ValueOf(&nm).Elem()); err != nil || nm == "" {
+			return
+		}
+		var tp reflect.Type
+		if tp, err = p.ts.CreateType(nm); err != nil {
+			return
+		}
+		return p.value(e, tp)
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return fmt.Errorf("unexpected kind: %v", t.Kind())
+	}
+	v := reflect.New(t).Elem()
+	if err = p.scalar(v); err != nil {
+		return
+	}
+	return e.InternalEncode(v)
+}
+
+// key of a map entry, [key]:
+func (p *textParser) key(e *Encoder, t reflect.Type) (err error) {
+	if err = p.expect('['); err != nil {
+		return
+	}
+	var s string
+	if p.peek() == '"' {
+		s, err = p.quoted()
+	} else {
+		s, err = p.word()
+	}
+	if err != nil {
+		return
+	}
+	if err = p.expect(']'); err != nil {
+		return
+	}
+	if err = p.expect(':'); err != nil {
+		return
+	}
+	k, err := p.ts.parseKey(strconv.Quote(s), t)
+	if err != nil {
+		return
+	}
+	return e.InternalEncode(k)
+}
+
+// scalar of a basic kind
+func (p *textParser) scalar(v reflect.Value) (err error) {
+	if v.Kind() == reflect.String {
+		s, err := p.quoted()
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+		return nil
+	}
+	w, err := p.word()
+	if err != nil {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(w); err == nil {
+			v.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		if i, err = strconv.ParseInt(w, 10, 64); err == nil {
+			err = p.ts.convert(v, reflect.ValueOf(i))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		if u, err = strconv.ParseUint(w, 10, 64); err == nil {
+			err = p.ts.convert(v, reflect.ValueOf(u))
+		}
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(w, v.Type().Bits()); err == nil {
+			v.SetFloat(f)
+		}
+	case reflect.Complex64, reflect.Complex128:
+		var c complex128
+		if _, err = fmt.Sscan(w, &c); err == nil {
+			v.SetComplex(c)
+		}
+	default:
+		err = fmt.Errorf("unexpected kind: %v", v.Kind())
+	}
+	return
+}
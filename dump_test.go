@@ -0,0 +1,105 @@
+package schema_test
+
+import (
+	"bytes"
+	"github.com/fengyoulin/schema"
+	"strings"
+	"testing"
+)
+
+func TestDumper(t *testing.T) {
+	ts := newTypes(t, testMapDef, testMapAdded...)
+	v, err := schema.FromMap(ts, "Canvas", map[string]interface{}{
+		"title":  "t\n",
+		"color":  "Blue",
+		"origin": map[string]interface{}{"x": 1, "y": -2},
+		"points": []interface{}{map[string]interface{}{"x": 2}, map[string]interface{}{"y": 3}},
+		"scale":  map[string]interface{}{"1": 0.5, "2": 1.5, "3": 2.5},
+		"data":   "AP8=",
+		"any":    map[string]interface{}{"$type": "[]string", "value": []interface{}{"a"}},
+		"shape":  map[string]interface{}{"$type": "Point", "value": map[string]interface{}{"x": 4}},
+		"at":     "2021-05-09T11:39:05Z",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &bytes.Buffer{}
+	if err = (&schema.Encoder{Writer: b, Extend: testEnc, Types: ts}).Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	src := append([]byte(nil), b.Bytes()...)
+	dp := &schema.Dumper{Types: ts, Encode: testEnc, Decode: testDec, Annotate: true}
+	text := &bytes.Buffer{}
+	if err = dp.Dump(text, b, "Canvas"); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"{  # @0 Canvas\n",
+		"  Title: \"t\\n\"  # @1 string\n",
+		"  Color: Blue  # @5 Color\n",
+		"  Data: \"\\x00\\xff\"",
+		"  Any: []string [  # @",
+		"  Shape: Point {  # @",
+		"      X: 2  # @",
+	} {
+		if !strings.Contains(text.String(), s) {
+			t.Errorf("missing %q in:\n%s", s, text)
+		}
+	}
+	out := &bytes.Buffer{}
+	if err = dp.Parse(out, text, "Canvas"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), src) {
+		t.Errorf("%x != %x", out.Bytes(), src)
+	}
+	bad := append([]byte(nil), src...)
+	bad[5] = 9 // ordinal of Color
+	text.Reset()
+	if err = dp.Dump(text, bytes.NewReader(bad), "Canvas"); err == nil {
+		t.Error("expected error")
+	}
+	if s := text.String(); !strings.Contains(s, "# !! Color at @5 diverged at @6: ordinal 9 out of range of enum: Color\n# !! next bytes: ") {
+		t.Errorf("missing divergence in:\n%s", s)
+	}
+}
+
+func TestDumper_Parse(t *testing.T) {
+	ts := newTypes(t, testMapDef, testMapAdded...)
+	dp := &schema.Dumper{Types: ts, Encode: testEnc, Decode: testDec}
+	text := `# fixture
+{
+  Shape: Label "s"
+  Title: "x"
+  Scale: { [7]: 1, [8]: 2 }
+  Points: [{ Y: 5 }, { X: 1 }]
+  Any: Point { X: 3 }
+  At: "2021-05-09T11:39:05Z"
+}`
+	b := &bytes.Buffer{}
+	if err := dp.Parse(b, strings.NewReader(text), "Canvas"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := ts.New("Canvas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = (&schema.Decoder{Reader: b, Extend: testDec, Types: ts}).Decode(r.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	for p, exp := range map[string]string{"Title": "x", "Color": "Red", "Shape.Value": "s"} {
+		if s, err := r.String(p); err != nil || s != exp {
+			t.Errorf("%s: %q != %q, error: %v", p, s, exp, err)
+		}
+	}
+	for p, exp := range map[string]int64{"Scale[8]": 2, "Points[0].Y": 5, "Points[1].X": 1, "Any.X": 3} {
+		if f, err := r.Float(p); err != nil || int64(f) != exp {
+			t.Errorf("%s: %v != %d, error: %v", p, f, exp, err)
+		}
+	}
+	for _, s := range []string{"{ Title: 1 }", "{ Color: Green }", "{ Points: [{ X: 70000 }] }", "{ Title: \"a\" Title: \"b\" }", "{ Unknown: 1 }", "{"} {
+		if err := dp.Parse(&bytes.Buffer{}, strings.NewReader(s), "Canvas"); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
@@ -13,6 +13,17 @@ type Encoder struct {
 	io.Writer
 	Extend map[reflect.Type]func(reflect.Value, *Encoder) error
 	Types  *Types
+	// Proto writes the struct of Encode as a message in the protobuf wire
+	// format, by the field numbers of ProtoTag, instead of binary mode
+	Proto bool
+
+	noMethods bool // Marshaler is ignored
+}
+
+// Marshaler is implemented by the pointers of types with generated methods,
+// called by Encoder instead of reflection
+type Marshaler interface {
+	MarshalSchema(e *Encoder) error
 }
 
 // Encode the data
@@ -21,6 +32,9 @@ func (e *Encoder) Encode(a interface{}) (err error) {
 	if rv.Kind() != reflect.Ptr {
 		return fmt.Errorf("%T is not pointer", a)
 	}
+	if e.Proto {
+		return e.encodeProto(rv.Elem())
+	}
 	return e.InternalEncode(rv)
 }
 
@@ -28,68 +42,25 @@ func (e *Encoder) Encode(a interface{}) (err error) {
 func (e *Encoder) InternalEncode(rv reflect.Value) (err error) {
 	switch rv.Kind() {
 	case reflect.Bool:
-		var b [1]byte
-		*(*bool)(unsafe.Pointer(&b[0])) = rv.Bool()
-		if _, err = e.Writer.Write(b[:]); err != nil {
-			return
-		}
+		return e.EncodeBool(rv.Bool())
 	case reflect.Int8:
-		var b [1]byte
-		*(*int8)(unsafe.Pointer(&b[0])) = int8(rv.Int())
-		if _, err = e.Writer.Write(b[:]); err != nil {
-			return
-		}
+		return e.EncodeInt8(int8(rv.Int()))
 	case reflect.Uint8:
-		var b [1]byte
-		b[0] = uint8(rv.Uint())
-		if _, err = e.Writer.Write(b[:]); err != nil {
-			return
-		}
+		return e.EncodeUint8(uint8(rv.Uint()))
 	case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64:
-		var buf [32]byte
-		l := binary.PutVarint(buf[:], rv.Int())
-		if _, err = e.Writer.Write(buf[:l]); err != nil {
-			return
-		}
+		return e.EncodeInt(rv.Int())
 	case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		var buf [32]byte
-		l := binary.PutUvarint(buf[:], rv.Uint())
-		if _, err = e.Writer.Write(buf[:l]); err != nil {
-			return
-		}
+		return e.EncodeUint(rv.Uint())
 	case reflect.Float32:
-		v := float32(rv.Float())
-		if _, err = e.Writer.Write((*(*[4]byte)(unsafe.Pointer(&v)))[:]); err != nil {
-			return
-		}
+		return e.EncodeFloat32(float32(rv.Float()))
 	case reflect.Float64:
-		v := rv.Float()
-		if _, err = e.Writer.Write((*(*[8]byte)(unsafe.Pointer(&v)))[:]); err != nil {
-			return
-		}
+		return e.EncodeFloat64(rv.Float())
 	case reflect.Complex64:
-		v := complex64(rv.Complex())
-		if _, err = e.Writer.Write((*(*[8]byte)(unsafe.Pointer(&v)))[:]); err != nil {
-			return
-		}
+		return e.EncodeComplex64(complex64(rv.Complex()))
 	case reflect.Complex128:
-		v := rv.Complex()
-		if _, err = e.Writer.Write((*(*[16]byte)(unsafe.Pointer(&v)))[:]); err != nil {
-			return
-		}
+		return e.EncodeComplex128(rv.Complex())
 	case reflect.String:
-		var slc []byte
-		str := rv.String()
-		*(*string)(unsafe.Pointer(&slc)) = str
-		(*reflect.SliceHeader)(unsafe.Pointer(&slc)).Cap = len(str)
-		var buf [32]byte
-		n := binary.PutVarint(buf[:], int64(len(slc)))
-		if _, err = e.Writer.Write(buf[:n]); err != nil {
-			return
-		}
-		if _, err = e.Writer.Write(slc); err != nil {
-			return
-		}
+		return e.EncodeString(rv.String())
 	case reflect.Slice:
 		l := int64(rv.Len())
 		var buf [32]byte
@@ -139,6 +110,22 @@ func (e *Encoder) InternalEncode(rv reflect.Value) (err error) {
 		if fn, ok := e.Extend[rv.Type()]; ok {
 			return fn(rv, e)
 		}
+		if !e.noMethods && rv.CanInterface() {
+			if rv.CanAddr() {
+				if m, ok := rv.Addr().Interface().(Marshaler); ok {
+					return m.MarshalSchema(e)
+				}
+			} else if reflect.PtrTo(rv.Type()).Implements(marshalerType) { // e.g. values of maps
+				p := reflect.New(rv.Type())
+				p.Elem().Set(rv)
+				return p.Interface().(Marshaler).MarshalSchema(e)
+			}
+		}
+		if e.Types != nil {
+			if c := e.Types.codecOf(rv.Type()); c != nil {
+				return c.encode(rv, e)
+			}
+		}
 		n := rv.NumField()
 		for x := 0; x < n; x++ {
 			if err = e.InternalEncode(rv.Field(x)); err != nil {
@@ -182,3 +169,95 @@ func (e *Encoder) InternalEncode(rv reflect.Value) (err error) {
 	}
 	return
 }
+
+// encodeDefault of a type, as defaultOf
+func (e *Encoder) encodeDefault(t reflect.Type) (err error) {
+	if e.Types == nil {
+		return e.InternalEncode(reflect.New(t).Elem())
+	}
+	v, err := e.Types.defaultOf(t)
+	if err != nil {
+		return
+	}
+	return e.InternalEncode(v)
+}
+
+// EncodeBool as a byte of 0 or 1
+func (e *Encoder) EncodeBool(v bool) (err error) {
+	var b [1]byte
+	*(*bool)(unsafe.Pointer(&b[0])) = v
+	_, err = e.Writer.Write(b[:])
+	return
+}
+
+// EncodeInt8 as a byte
+func (e *Encoder) EncodeInt8(v int8) (err error) {
+	var b [1]byte
+	*(*int8)(unsafe.Pointer(&b[0])) = v
+	_, err = e.Writer.Write(b[:])
+	return
+}
+
+// EncodeUint8 as a byte
+func (e *Encoder) EncodeUint8(v uint8) (err error) {
+	b := [1]byte{v}
+	_, err = e.Writer.Write(b[:])
+	return
+}
+
+// EncodeInt as a varint, also the length of a string, slice or map
+func (e *Encoder) EncodeInt(v int64) (err error) {
+	var buf [32]byte
+	l := binary.PutVarint(buf[:], v)
+	_, err = e.Writer.Write(buf[:l])
+	return
+}
+
+// EncodeUint as an uvarint
+func (e *Encoder) EncodeUint(v uint64) (err error) {
+	var buf [32]byte
+	l := binary.PutUvarint(buf[:], v)
+	_, err = e.Writer.Write(buf[:l])
+	return
+}
+
+// EncodeFloat32 in the memory layout
+func (e *Encoder) EncodeFloat32(v float32) (err error) {
+	_, err = e.Writer.Write((*(*[4]byte)(unsafe.Pointer(&v)))[:])
+	return
+}
+
+// EncodeFloat64 in the memory layout
+func (e *Encoder) EncodeFloat64(v float64) (err error) {
+	_, err = e.Writer.Write((*(*[8]byte)(unsafe.Pointer(&v)))[:])
+	return
+}
+
+// EncodeComplex64 in the memory layout
+func (e *Encoder) EncodeComplex64(v complex64) (err error) {
+	_, err = e.Writer.Write((*(*[8]byte)(unsafe.Pointer(&v)))[:])
+	return
+}
+
+// EncodeComplex128 in the memory layout
+func (e *Encoder) EncodeComplex128(v complex128) (err error) {
+	_, err = e.Writer.Write((*(*[16]byte)(unsafe.Pointer(&v)))[:])
+	return
+}
+
+// EncodeString as the length and bytes
+func (e *Encoder) EncodeString(v string) (err error) {
+	var slc []byte
+	*(*string)(unsafe.Pointer(&slc)) = v
+	(*reflect.SliceHeader)(unsafe.Pointer(&slc)).Cap = len(v)
+	return e.EncodeBytes(slc)
+}
+
+// EncodeBytes as the length and bytes
+func (e *Encoder) EncodeBytes(v []byte) (err error) {
+	if err = e.EncodeInt(int64(len(v))); err != nil {
+		return
+	}
+	_, err = e.Writer.Write(v)
+	return
+}
@@ -0,0 +1,176 @@
+package schema
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Member of an enum schema. The zero value of an enum without a member of it
+// is taken as the first member, and so decoded as the value of that member
+type Member struct {
+	Name  string          `json:"name,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"` // defaults to ordinal for integer, name for string
+}
+
+// codec of a type created from a special schema, used by Encoder and Decoder
+type codec interface {
+	encode(rv reflect.Value, e *Encoder) error
+	decode(rv reflect.Value, d *Decoder) error
+}
+
+type enumCodec struct {
+	name   string
+	names  []string
+	values []reflect.Value
+	index  map[interface{}]int
+}
+
+// ordinal of an enum value, the zero value is the first member if it is not a
+// member value, as the value of a new struct
+func (c *enumCodec) ordinal(rv reflect.Value) (i int, ok bool) {
+	if i, ok = c.index[rv.Field(0).Interface()]; !ok && rv.Field(0).IsZero() {
+		return 0, true
+	}
+	return
+}
+
+func (c *enumCodec) encode(rv reflect.Value, e *Encoder) (err error) {
+	i, ok := c.ordinal(rv)
+	if !ok {
+		return fmt.Errorf("invalid value of enum %s: %v", c.name, rv.Field(0).Interface())
+	}
+	var buf [16]byte
+	n := binary.PutUvarint(buf[:], uint64(i))
+	_, err = e.Writer.Write(buf[:n])
+	return
+}
+
+func (c *enumCodec) decode(rv reflect.Value, d *Decoder) (err error) {
+	u, err := binary.ReadUvarint(d.byteReader())
+	if err != nil {
+		return
+	}
+	if u >= uint64(len(c.values)) {
+		return fmt.Errorf("ordinal %d out of range of enum: %s", u, c.name)
+	}
+	rv.Field(0).Set(c.values[u])
+	return
+}
+
+// Member name of an enum value, ok is false if v is not an enum or a member
+func (ts *Types) Member(v reflect.Value) (name string, ok bool) {
+	c, _ := ts.codecOf(v.Type()).(*enumCodec)
+	if c == nil {
+		return
+	}
+	i, ok := c.ordinal(v)
+	if !ok {
+		return
+	}
+	return c.names[i], true
+}
+
+// SetMember of an enum value by name
+func (ts *Types) SetMember(v reflect.Value, name string) error {
+	c, _ := ts.codecOf(v.Type()).(*enumCodec)
+	if c == nil {
+		return fmt.Errorf("%s is not enum", v.Type())
+	}
+	for i, n := range c.names {
+		if n == name {
+			v.Field(0).Set(c.values[i])
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown member of enum %s: %s", c.name, name)
+}
+
+// enumDefault of a field type, a member name of an enum to the value, and the
+// first member if def is empty, other defaults are returned as they are
+func (ts *Types) enumDefault(t reflect.Type, def json.RawMessage) (json.RawMessage, error) {
+	c, ok := ts.cd[t].(*enumCodec)
+	if !ok {
+		return def, nil
+	}
+	i := 0
+	if len(def) > 0 {
+		var nm string
+		if err := json.Unmarshal(def, &nm); err != nil {
+			return nil, err
+		}
+		for i = 0; i < len(c.names) && c.names[i] != nm; i++ {
+		}
+		if i == len(c.names) {
+			return nil, fmt.Errorf("unknown member of enum %s: %s", c.name, nm)
+		}
+	}
+	return json.Marshal(map[string]interface{}{"Value": c.values[i].Interface()})
+}
+
+func (ts *Types) codecOf(t reflect.Type) codec {
+	ts.lk.RLock()
+	c := ts.cd[t]
+	ts.lk.RUnlock()
+	return c
+}
+
+func (ts *Types) createEnum(s Schema) (t reflect.Type, err error) {
+	if len(s.Fields) > 0 || len(s.Variants) > 0 {
+		return nil, fmt.Errorf("enum with fields or variants: %s", s.Name)
+	}
+	u, ok := ts.tm[s.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown underlying type of enum %s: %s", s.Name, s.Type)
+	}
+	if _, ok = ts.cd[u]; ok {
+		return nil, fmt.Errorf("invalid underlying type of enum %s: %s", s.Name, s.Type)
+	}
+	c := &enumCodec{
+		name:  s.Name,
+		index: make(map[interface{}]int, len(s.Members)),
+	}
+	for i, m := range s.Members {
+		if m.Name == "" {
+			return nil, fmt.Errorf("empty member name of enum: %s", s.Name)
+		}
+		for _, n := range c.names {
+			if n == m.Name {
+				return nil, fmt.Errorf("duplicate member of enum %s: %s", s.Name, m.Name)
+			}
+		}
+		v := reflect.New(u).Elem()
+		switch u.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			v.SetInt(int64(i))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			v.SetUint(uint64(i))
+		case reflect.String:
+			v.SetString(m.Name)
+		default:
+			return nil, fmt.Errorf("invalid underlying type of enum %s: %s", s.Name, s.Type)
+		}
+		if len(m.Value) > 0 {
+			if err = json.Unmarshal(m.Value, v.Addr().Interface()); err != nil {
+				return nil, fmt.Errorf("invalid value of member %s, error: %v", m.Name, err)
+			}
+		}
+		if _, ok = c.index[v.Interface()]; ok {
+			return nil, fmt.Errorf("duplicate value of enum %s: %v", s.Name, v.Interface())
+		}
+		c.names = append(c.names, m.Name)
+		c.values = append(c.values, v)
+		c.index[v.Interface()] = i
+	}
+	t = reflect.StructOf([]reflect.StructField{{
+		Name: "Value",
+		Type: u,
+		Tag:  reflect.StructTag(`enum:"` + s.Name + `"`),
+	}})
+	ts.tm[s.Name] = t
+	ts.tn[t] = s.Name
+	ts.sm[s.Name] = s
+	ts.cd[t] = c
+	return
+}
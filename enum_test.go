@@ -0,0 +1,165 @@
+package schema_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/fengyoulin/schema"
+	"reflect"
+	"testing"
+)
+
+const testEnumDef = `
+[{"name":"Status","type":"int","members":[{"name":"Active","value":10},{"name":"Blocked","value":20},{"name":"Deleted","value":30}]},
+{"name":"Color","type":"string","members":[{"name":"Red"},{"name":"Green"}]},
+{"name":"Account","fields":[
+{"name":"ID","type":"uint"},
+{"name":"Status","type":"Status"},
+{"name":"Colors","type":"[]Color"}
+]}]
+`
+
+func TestTypes_CreateEnum(t *testing.T) {
+	ts := newTypes(t, testEnumDef)
+	v, err := ts.NewValue("Account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rv := v.Elem()
+	rv.Field(0).SetUint(5)
+	if err = ts.SetMember(rv.Field(1), "Blocked"); err != nil {
+		t.Fatal(err)
+	}
+	if n := rv.Field(1).Field(0).Int(); n != 20 {
+		t.Errorf("unexpected value: %d", n)
+	}
+	ct, _ := ts.TypeByName("Color")
+	cs := reflect.MakeSlice(reflect.SliceOf(ct), 2, 2)
+	for i, n := range []string{"Green", "Red"} {
+		if err = ts.SetMember(cs.Index(i), n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rv.Field(2).Set(cs)
+	b := &bytes.Buffer{}
+	if err = (&schema.Encoder{Writer: b, Types: ts}).Encode(v.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	exp := []byte{1, 5, 1, 4, 1, 0}
+	if !bytes.Equal(b.Bytes(), exp) {
+		t.Errorf("%v != %v", b.Bytes(), exp)
+	}
+	o, _ := ts.NewValue("Account")
+	if err = (&schema.Decoder{Reader: bytes.NewReader(exp), Types: ts}).Decode(o.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(o.Interface(), v.Interface()) {
+		t.Errorf("%v != %v", o.Interface(), v.Interface())
+	}
+	if nm, ok := ts.Member(o.Elem().Field(2).Index(0)); !ok || nm != "Green" {
+		t.Errorf("unexpected member: %s", nm)
+	}
+	bad := []byte{1, 5, 3, 0}
+	if err = (&schema.Decoder{Reader: bytes.NewReader(bad), Types: ts}).Decode(o.Interface()); err == nil {
+		t.Error("expected out of range error")
+	}
+	o.Elem().Field(1).Field(0).SetInt(11)
+	if err = (&schema.Encoder{Writer: b, Types: ts}).Encode(o.Interface()); err == nil {
+		t.Error("expected invalid value error")
+	}
+	if err = ts.Validate(o.Interface()); err == nil {
+		t.Error("expected validation error")
+	}
+}
+
+func TestTypes_CreateEnumInvalid(t *testing.T) {
+	bad := []schema.Schema{
+		{Name: "Float", Type: "float64", Members: []schema.Member{{Name: "A"}}},
+		{Name: "Dup", Type: "int", Members: []schema.Member{{Name: "A"}, {Name: "A"}}},
+		{Name: "Same", Type: "int", Members: []schema.Member{{Name: "A"}, {Name: "B", Value: json.RawMessage("0")}}},
+		{Name: "Empty", Type: "int"},
+	}
+	for _, s := range bad {
+		if _, err := schema.New().CreateSchema(s); err == nil {
+			t.Errorf("%s: expected error", s.Name)
+		}
+	}
+}
+
+func TestTypes_SchemaOf(t *testing.T) {
+	ts := newTypes(t, testEnumDef)
+	s, err := ts.SchemaOf("Status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Members) != 3 || s.Members[2].Name != "Deleted" {
+		t.Errorf("unexpected schema: %v", s)
+	}
+	type Point struct {
+		X      int32    `json:"x"`
+		Y      int64    `json:"y"`
+		Labels []string `json:"labels,omitempty" db:"labels"`
+	}
+	if err = ts.AddType(reflect.TypeOf(Point{})); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = ts.SchemaOf("Point"); err != nil {
+		t.Fatal(err)
+	}
+	exp := schema.Schema{Name: "Point", Fields: []schema.Field{
+		{Name: "X", Type: "int32", Tags: map[string]string{"json": "x"}},
+		{Name: "Y", Type: "int64", Tags: map[string]string{"json": "y"}},
+		{Name: "Labels", Type: "[]string", Tags: map[string]string{"json": "labels,omitempty", "db": "labels"}},
+	}}
+	if !reflect.DeepEqual(s, exp) {
+		t.Errorf("%v != %v", s, exp)
+	}
+}
+
+func TestTypes_EnumDefault(t *testing.T) {
+	ts := newTypes(t, testEnumDef)
+	s := schema.Schema{Name: "Item", Fields: []schema.Field{
+		{Name: "Color", Type: "Color", Default: json.RawMessage(`"Green"`)},
+		{Name: "Status", Type: "Status"},
+	}}
+	if _, err := ts.CreateSchema(s); err != nil {
+		t.Fatal(err)
+	}
+	v, err := ts.NewValue("Item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nm, _ := ts.Member(v.Elem().Field(0)); nm != "Green" {
+		t.Errorf("unexpected color: %s", nm)
+	}
+	if n := v.Elem().Field(1).Field(0).Int(); n != 10 {
+		t.Errorf("unexpected status: %d", n)
+	}
+	s = schema.Schema{Name: "Bad", Fields: []schema.Field{{Name: "Color", Type: "Color", Default: json.RawMessage(`"Blue"`)}}}
+	if _, err = ts.CreateSchema(s); err == nil {
+		t.Error("expected unknown member error")
+	}
+	// the zero value of Status, which has no member of 0, is the first member
+	tp, _ := ts.TypeByName("Account")
+	z := reflect.New(tp)
+	if nm, ok := ts.Member(z.Elem().Field(1)); !ok || nm != "Active" {
+		t.Errorf("unexpected member: %s", nm)
+	}
+	if err = ts.Validate(z.Interface()); err != nil {
+		t.Error(err)
+	}
+	b := &bytes.Buffer{}
+	if err = (&schema.Encoder{Writer: b, Types: ts}).Encode(z.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	if exp := []byte{1, 0, 0, 0}; !bytes.Equal(b.Bytes(), exp) {
+		t.Errorf("% x != % x", b.Bytes(), exp)
+	}
+	// and decoded as the value of the first member
+	r := reflect.New(tp)
+	if err = (&schema.Decoder{Reader: b, Types: ts}).Decode(r.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	if n := r.Elem().Field(1).Field(0).Int(); n != 10 {
+		t.Errorf("unexpected status: %d", n)
+	}
+}
@@ -0,0 +1,624 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expr compiled against a struct type, e.g. UpdatedAt >= CreatedAt
+//
+// Operands are numbers, "strings", true, false, field paths as in Query,
+// and len(path) of a string, slice, array or map. Fields of integer and float
+// types are numbers, enums are strings of member names, and time.Time can be
+// compared. Operators by precedence from low to high are: A if C (A is
+// checked only if C is true), ||, &&, !, == != < <= > >=, + -, * / %, and
+// unary -.
+type Expr struct {
+	src  string
+	root reflect.Type // struct type compiled against
+	typ  exprType
+	fn   exprFunc
+}
+
+type exprType int
+
+const (
+	exprAny exprType = iota // known at run time, below an interface
+	exprNum
+	exprString
+	exprBool
+	exprTime
+)
+
+func (t exprType) String() string {
+	return [...]string{"any", "number", "string", "bool", "time"}[t]
+}
+
+type exprFunc func(rv reflect.Value) (interface{}, error)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Compile an expression against the named struct type
+func (ts *Types) Compile(name, src string) (e *Expr, err error) {
+	ts.lk.RLock()
+	defer ts.lk.RUnlock()
+	t, ok := ts.tm[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown type: %s", name)
+	}
+	return ts.compileExpr(t, src)
+}
+
+// AddRule to a struct schema, a bool expression checked by Validate
+func (ts *Types) AddRule(name, src string) (err error) {
+	ts.lk.Lock()
+	defer ts.lk.Unlock()
+	s, ok := ts.sm[name]
+	if !ok || len(s.Members) > 0 || len(s.Variants) > 0 {
+		return fmt.Errorf("unknown struct schema: %s", name)
+	}
+	t := ts.tm[name]
+	e, err := ts.compileExpr(t, src)
+	if err != nil {
+		return
+	}
+	if e.typ != exprBool && e.typ != exprAny {
+		return fmt.Errorf("rule of %s type: %s", e.typ, src)
+	}
+	s.Rules = append(s.Rules[:len(s.Rules):len(s.Rules)], src)
+	ts.sm[name] = s
+	ts.xr[t] = append(ts.xr[t], e)
+	return
+}
+
+// String returns the source of the expression
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval the expression on a value of its type, or a pointer to it
+func (e *Expr) Eval(v interface{}) (r interface{}, err error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() || rv.Type() != e.root {
+		return nil, fmt.Errorf("%T is not %s", v, e.root)
+	}
+	return e.fn(rv)
+}
+
+// compileExpr parses and type checks src against t, ts must be locked
+func (ts *Types) compileExpr(t reflect.Type, src string) (e *Expr, err error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("not a struct type: %s", t)
+	}
+	toks, err := lexExpr(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", src, err)
+	}
+	p := &exprParser{ts: ts, t: t, toks: toks}
+	e = &Expr{src: src, root: t}
+	if e.typ, e.fn, err = p.implication(); err == nil && p.pos < len(p.toks) {
+		err = fmt.Errorf("unexpected %s", p.toks[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", src, err)
+	}
+	return
+}
+
+// lexExpr splits src into tokens of operators, numbers, strings and paths
+func lexExpr(src string) (toks []string, err error) {
+	s := src
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if s == "" {
+			return
+		}
+		c := s[0]
+		n := 0
+		switch {
+		case c == '"' || c == '`':
+			q, err := strconv.QuotedPrefix(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string: %s", s)
+			}
+			n = len(q)
+		case c >= '0' && c <= '9' || c == '.':
+			for n < len(s) && (s[n] >= '0' && s[n] <= '9' || s[n] == '.' || s[n] == 'e' || s[n] == 'E' ||
+				(s[n] == '-' || s[n] == '+') && (s[n-1] == 'e' || s[n-1] == 'E')) {
+				n++
+			}
+		case c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z':
+			for n < len(s) {
+				d := s[n]
+				if d == '[' {
+					i := indexTop(s[n+1:], ']')
+					if i < 0 {
+						return nil, fmt.Errorf("unclosed bracket: %s", s)
+					}
+					n += i + 2
+				} else if d == '_' || d == '.' || d >= 'A' && d <= 'Z' || d >= 'a' && d <= 'z' || d >= '0' && d <= '9' {
+					n++
+				} else {
+					break
+				}
+			}
+		default:
+			for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||"} {
+				if strings.HasPrefix(s, op) {
+					n = 2
+				}
+			}
+			if n == 0 {
+				if !strings.ContainsRune("<>!+-*/%(),", rune(c)) {
+					return nil, fmt.Errorf("unexpected character: %c", c)
+				}
+				n = 1
+			}
+		}
+		toks = append(toks, s[:n])
+		s = s[n:]
+	}
+}
+
+type exprParser struct {
+	ts   *Types
+	t    reflect.Type
+	toks []string
+	pos  int
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) accept(tok string) bool {
+	if p.peek() == tok {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) implication() (t exprType, fn exprFunc, err error) {
+	if t, fn, err = p.or(); err != nil || !p.accept("if") {
+		return
+	}
+	ct, cf, err := p.or()
+	if err != nil {
+		return
+	}
+	if err = wantBool(t, "if"); err == nil {
+		err = wantBool(ct, "if")
+	}
+	then := fn
+	return exprBool, func(rv reflect.Value) (interface{}, error) {
+		c, err := cf(rv)
+		if err != nil || c != true {
+			return true, err
+		}
+		return then(rv)
+	}, err
+}
+
+func (p *exprParser) or() (t exprType, fn exprFunc, err error) {
+	return p.logical("||", p.and)
+}
+
+func (p *exprParser) and() (t exprType, fn exprFunc, err error) {
+	return p.logical("&&", p.not)
+}
+
+func (p *exprParser) logical(op string, next func() (exprType, exprFunc, error)) (t exprType, fn exprFunc, err error) {
+	if t, fn, err = next(); err != nil {
+		return
+	}
+	for p.accept(op) {
+		rt, rf, err := next()
+		if err != nil {
+			return t, nil, err
+		}
+		if err = wantBool(t, op); err == nil {
+			err = wantBool(rt, op)
+		}
+		if err != nil {
+			return t, nil, err
+		}
+		lf, short := fn, op == "||"
+		t, fn = exprBool, func(rv reflect.Value) (interface{}, error) {
+			l, err := lf(rv)
+			if err != nil || l == short {
+				return l, err
+			}
+			r, err := rf(rv)
+			if _, ok := r.(bool); !ok && err == nil {
+				err = fmt.Errorf("%v is not bool", r)
+			}
+			return r, err
+		}
+	}
+	return
+}
+
+func (p *exprParser) not() (t exprType, fn exprFunc, err error) {
+	if !p.accept("!") {
+		return p.compare()
+	}
+	if t, fn, err = p.not(); err != nil {
+		return
+	}
+	if err = wantBool(t, "!"); err != nil {
+		return
+	}
+	f := fn
+	return exprBool, func(rv reflect.Value) (interface{}, error) {
+		v, err := f(rv)
+		if err != nil {
+			return nil, err
+		}
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%v is not bool", v)
+		}
+		return !b, nil
+	}, nil
+}
+
+func (p *exprParser) compare() (t exprType, fn exprFunc, err error) {
+	if t, fn, err = p.additive(); err != nil {
+		return
+	}
+	op := p.peek()
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		p.pos++
+	default:
+		return
+	}
+	rt, rf, err := p.additive()
+	if err != nil {
+		return
+	}
+	if t != rt && t != exprAny && rt != exprAny {
+		return t, nil, fmt.Errorf("mismatched types of %s: %s and %s", op, t, rt)
+	}
+	if (t == exprBool || rt == exprBool) && op != "==" && op != "!=" {
+		return t, nil, fmt.Errorf("invalid operator of bool: %s", op)
+	}
+	lf := fn
+	return exprBool, func(rv reflect.Value) (interface{}, error) {
+		l, err := lf(rv)
+		if err != nil {
+			return nil, err
+		}
+		r, err := rf(rv)
+		if err != nil {
+			return nil, err
+		}
+		c, err := compareExpr(l, r, op)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "==":
+			return c == 0, nil
+		case "!=":
+			return c != 0, nil
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	}, nil
+}
+
+func (p *exprParser) additive() (t exprType, fn exprFunc, err error) {
+	return p.arith([]string{"+", "-"}, p.multiplicative)
+}
+
+func (p *exprParser) multiplicative() (t exprType, fn exprFunc, err error) {
+	return p.arith([]string{"*", "/", "%"}, p.unary)
+}
+
+func (p *exprParser) arith(ops []string, next func() (exprType, exprFunc, error)) (t exprType, fn exprFunc, err error) {
+	if t, fn, err = next(); err != nil {
+		return
+	}
+	for {
+		op := ""
+		for _, o := range ops {
+			if p.accept(o) {
+				op = o
+			}
+		}
+		if op == "" {
+			return
+		}
+		rt, rf, err := next()
+		if err != nil {
+			return t, nil, err
+		}
+		switch {
+		case op == "+" && t == exprString && (rt == exprString || rt == exprAny):
+		case (t == exprNum || t == exprAny) && (rt == exprNum || rt == exprAny):
+			if t == exprAny {
+				t = rt
+			}
+		default:
+			return t, nil, fmt.Errorf("invalid types of %s: %s and %s", op, t, rt)
+		}
+		lf := fn
+		fn = func(rv reflect.Value) (interface{}, error) {
+			l, err := lf(rv)
+			if err != nil {
+				return nil, err
+			}
+			r, err := rf(rv)
+			if err != nil {
+				return nil, err
+			}
+			return arithExpr(l, r, op)
+		}
+	}
+}
+
+func (p *exprParser) unary() (t exprType, fn exprFunc, err error) {
+	if !p.accept("-") {
+		return p.primary()
+	}
+	if t, fn, err = p.unary(); err != nil {
+		return
+	}
+	if t != exprNum && t != exprAny {
+		return t, nil, fmt.Errorf("invalid type of -: %s", t)
+	}
+	f := fn
+	return exprNum, func(rv reflect.Value) (interface{}, error) {
+		v, err := f(rv)
+		if err != nil {
+			return nil, err
+		}
+		return arithExpr(0.0, v, "-")
+	}, nil
+}
+
+func (p *exprParser) primary() (t exprType, fn exprFunc, err error) {
+	tok := p.peek()
+	if tok == "" {
+		return t, nil, fmt.Errorf("unexpected end")
+	}
+	p.pos++
+	switch {
+	case tok == "(":
+		if t, fn, err = p.implication(); err == nil && !p.accept(")") {
+			err = fmt.Errorf("missing )")
+		}
+		return
+	case tok[0] == '"' || tok[0] == '`':
+		s, err := strconv.Unquote(tok)
+		return exprString, constExpr(s), err
+	case tok[0] >= '0' && tok[0] <= '9' || tok[0] == '.':
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return t, nil, fmt.Errorf("invalid number: %s", tok)
+		}
+		return exprNum, constExpr(f), nil
+	case tok == "true" || tok == "false":
+		return exprBool, constExpr(tok == "true"), nil
+	case tok == "len" && p.accept("("):
+		return p.length()
+	case ir.MatchString(strings.SplitN(strings.SplitN(tok, ".", 2)[0], "[", 2)[0]):
+		return p.path(tok)
+	}
+	return t, nil, fmt.Errorf("unexpected %s", tok)
+}
+
+func (p *exprParser) length() (t exprType, fn exprFunc, err error) {
+	tok := p.peek()
+	p.pos++
+	ss, pt, err := p.resolve(tok)
+	if err != nil {
+		return
+	}
+	if !p.accept(")") {
+		return t, nil, fmt.Errorf("missing ) of len")
+	}
+	if pt != nil {
+		switch pt.Kind() {
+		case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		default:
+			return t, nil, fmt.Errorf("invalid type of len: %s", pt)
+		}
+	}
+	ts := p.ts
+	return exprNum, func(rv reflect.Value) (interface{}, error) {
+		v, err := ts.get(rv, ss)
+		if err != nil {
+			return nil, err
+		}
+		switch v.Kind() {
+		case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+			return float64(v.Len()), nil
+		}
+		return nil, fmt.Errorf("invalid type of len: %s", v.Type())
+	}, nil
+}
+
+func (p *exprParser) path(tok string) (t exprType, fn exprFunc, err error) {
+	ss, pt, err := p.resolve(tok)
+	if err != nil {
+		return
+	}
+	if pt != nil {
+		if t = p.typeOf(pt); t == exprAny {
+			return t, nil, fmt.Errorf("unsupported type of %s: %s", tok, pt)
+		}
+	}
+	ts := p.ts
+	return t, func(rv reflect.Value) (interface{}, error) {
+		v, err := ts.get(rv, ss)
+		if err != nil {
+			return nil, err
+		}
+		return ts.exprValue(v)
+	}, nil
+}
+
+// resolve a path to its steps and static type, nil below an interface
+func (p *exprParser) resolve(tok string) (ss []step, t reflect.Type, err error) {
+	if ss, err = parsePath(tok); err != nil {
+		return
+	}
+	t = p.t
+	for _, s := range ss {
+		if t, err = checkStep(t, s, false); err != nil || t == nil {
+			return
+		}
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return
+}
+
+// typeOf values of a Go type in expressions, ts must be locked
+func (p *exprParser) typeOf(t reflect.Type) exprType {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return exprNum
+	case reflect.String:
+		return exprString
+	case reflect.Bool:
+		return exprBool
+	case reflect.Interface:
+		return exprAny
+	case reflect.Struct:
+		if t == timeType {
+			return exprTime
+		}
+		if _, ok := p.ts.cd[t].(*enumCodec); ok {
+			return exprString
+		}
+	}
+	return exprAny
+}
+
+// exprValue of a Go value
+func (ts *Types) exprValue(v reflect.Value) (interface{}, error) {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, fmt.Errorf("nil %s", v.Type())
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return v.Interface(), nil
+		}
+		if nm, ok := ts.Member(v); ok {
+			return nm, nil
+		}
+	}
+	return toFloat(v)
+}
+
+func constExpr(v interface{}) exprFunc {
+	return func(reflect.Value) (interface{}, error) {
+		return v, nil
+	}
+}
+
+func wantBool(t exprType, op string) error {
+	if t != exprBool && t != exprAny {
+		return fmt.Errorf("invalid type of %s: %s", op, t)
+	}
+	return nil
+}
+
+func compareExpr(l, r interface{}, op string) (c int, err error) {
+	switch a := l.(type) {
+	case float64:
+		if b, ok := r.(float64); ok {
+			switch {
+			case a < b:
+				return -1, nil
+			case a > b:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case string:
+		if b, ok := r.(string); ok {
+			return strings.Compare(a, b), nil
+		}
+	case bool:
+		if b, ok := r.(bool); ok && (op == "==" || op == "!=") {
+			if a == b {
+				return 0, nil
+			}
+			return 1, nil
+		}
+	case time.Time:
+		if b, ok := r.(time.Time); ok {
+			switch {
+			case a.Before(b):
+				return -1, nil
+			case a.After(b):
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %v %s %v", l, op, r)
+}
+
+func arithExpr(l, r interface{}, op string) (interface{}, error) {
+	if a, ok := l.(string); ok && op == "+" {
+		if b, ok := r.(string); ok {
+			return a + b, nil
+		}
+	}
+	a, ok := l.(float64)
+	b, ok2 := r.(float64)
+	if !ok || !ok2 {
+		return nil, fmt.Errorf("invalid operands of %s: %v and %v", op, l, r)
+	}
+	switch op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return a / b, nil
+	}
+	if b == 0 || a != float64(int64(a)) || b != float64(int64(b)) {
+		return nil, fmt.Errorf("invalid operands of %%: %v and %v", a, b)
+	}
+	return float64(int64(a) % int64(b)), nil
+}
@@ -0,0 +1,131 @@
+package schema_test
+
+import (
+	"github.com/fengyoulin/schema"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testExprDef = `
+[{"name":"Grade","type":"string","members":[{"name":"Basic"},{"name":"Gold"}]},
+{"name":"Member","fields":[
+{"name":"Name","type":"string"},
+{"name":"Level","type":"int8"},
+{"name":"Grade","type":"Grade"},
+{"name":"Score","type":"*float64"},
+{"name":"CreatedAt","type":"Time"},
+{"name":"UpdatedAt","type":"Time"},
+{"name":"Extra","type":"[]byte"},
+{"name":"Props","type":"map[string]int"}
+],"rules":["UpdatedAt >= CreatedAt","len(Extra) < 4 if Level > 2"]}]
+`
+
+func TestTypes_Compile(t *testing.T) {
+	ts := newTypes(t, testExprDef, reflect.TypeOf(time.Time{}))
+	r, err := ts.New("Member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sets := map[string]interface{}{
+		"Name":      "ann",
+		"Level":     3,
+		"Grade":     "Gold",
+		"Score":     2.5,
+		"CreatedAt": time.Unix(100, 0),
+		"UpdatedAt": time.Unix(200, 0),
+		"Extra":     []byte{1, 2},
+		"Props[a]":  7,
+	}
+	for p, v := range sets {
+		if err = r.Set(p, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cases := []struct {
+		src string
+		exp interface{}
+	}{
+		{"Level * 2 + 1", 7.0},
+		{"-Level % 2", -1.0},
+		{`Name + "!" == "ann!"`, true},
+		{`Grade == "Gold" && Score > 2`, true},
+		{"!(Level >= 3) || Props[a] == 7", true},
+		{"len(Props) + len(Name)", 4.0},
+		{"UpdatedAt < CreatedAt", false},
+		{"Level > 5 if Name == \"bob\"", true},
+		{"Score / 0.5", 5.0},
+	}
+	for _, c := range cases {
+		e, err := ts.Compile("Member", c.src)
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if v, err := e.Eval(r.Interface()); err != nil || v != c.exp {
+			t.Errorf("%s: %v != %v, error: %v", c.src, v, c.exp, err)
+		}
+	}
+	bad := []string{
+		"Level + Name",
+		"Unknown > 1",
+		"len(Level)",
+		"Name < 1",
+		"Level > 1 if Name",
+		"Grade >",
+		"Extra == 1",
+		"(Level",
+		"true < false",
+	}
+	for _, src := range bad {
+		if _, err := ts.Compile("Member", src); err == nil {
+			t.Errorf("%s: expected error", src)
+		}
+	}
+	e, err := ts.Compile("Member", "Level > 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []interface{}{nil, reflect.Zero(reflect.TypeOf(r.Interface())).Interface(), 1} {
+		if _, err = e.Eval(v); err == nil {
+			t.Errorf("%#v: expected error", v)
+		}
+	}
+}
+
+func TestTypes_AddRule(t *testing.T) {
+	ts := newTypes(t, testExprDef, reflect.TypeOf(time.Time{}))
+	r, err := ts.New("Member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ts.Validate(r.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Set("CreatedAt", time.Unix(300, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Set("Level", 3); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Set("Extra", []byte("12345")); err != nil {
+		t.Fatal(err)
+	}
+	es, _ := ts.Validate(r.Interface()).(schema.FieldErrors)
+	if len(es) != 2 {
+		t.Errorf("unexpected errors: %v", es)
+	}
+	if err = ts.AddRule("Member", "Score > 1"); err != nil {
+		t.Fatal(err)
+	}
+	es, _ = ts.Validate(r.Interface()).(schema.FieldErrors)
+	if len(es) != 3 || es[2].Message != "rule Score > 1: nil *float64" {
+		t.Errorf("unexpected errors: %v", es)
+	}
+	if err = ts.AddRule("Member", "Level + 1"); err == nil {
+		t.Error("expected non-bool rule error")
+	}
+	if s, _ := ts.SchemaOf("Member"); len(s.Rules) != 3 {
+		t.Errorf("unexpected rules: %v", s.Rules)
+	}
+}
@@ -0,0 +1,338 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Generator of Go source for schema types, the generated types replace the
+// created ones by AddType at init, with typed constructors
+type Generator struct {
+	Types   *Types // with the schemas created
+	Package string // name of the generated package
+	Var     string // name of the generated *Types variable, "Types" if empty
+	// Methods MarshalSchema and UnmarshalSchema are generated for the types,
+	// called by Encoder and Decoder instead of reflection
+	Methods bool
+}
+
+type generator struct {
+	Generator
+	order   []string                // schemas, after their dependencies
+	extern  []reflect.Type          // types defined by source code
+	imports map[string]string       // of package paths to names
+	seen    map[string]bool         // schemas visited
+	added   map[reflect.Type]bool   // extern types
+	local   map[reflect.Type]string // types of generated methods
+	pkgPath string                  // of the generated package, if known
+	buf     bytes.Buffer
+}
+
+var selfPath = reflect.TypeOf(Types{}).PkgPath()
+
+func (g *Generator) generator() *generator {
+	gn := &generator{
+		Generator: *g,
+		imports:   make(map[string]string),
+		seen:      make(map[string]bool),
+		added:     make(map[reflect.Type]bool),
+		local:     make(map[reflect.Type]string),
+	}
+	if gn.Var == "" {
+		gn.Var = "Types"
+	}
+	return gn
+}
+
+// use a package by the generated source
+func (gn *generator) use(p string) {
+	if p != gn.pkgPath {
+		gn.imports[p] = path.Base(p)
+	}
+}
+
+// header of the source, with the used packages
+func (gn *generator) header() {
+	b := &gn.buf
+	fmt.Fprintf(b, "// Code generated by schema gen. DO NOT EDIT.\n\npackage %s\n", gn.Package)
+	if len(gn.imports) == 0 {
+		return
+	}
+	b.WriteString("\nimport (\n")
+	ps := make([]string, 0, len(gn.imports))
+	for p := range gn.imports {
+		ps = append(ps, p)
+	}
+	sort.Strings(ps)
+	for _, p := range ps {
+		fmt.Fprintf(b, "\t%q\n", p)
+	}
+	b.WriteString(")\n")
+}
+
+// write the formatted source
+func (gn *generator) write(w io.Writer) (err error) {
+	src, err := format.Source(gn.buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("format: %v", err)
+	}
+	_, err = w.Write(src)
+	return
+}
+
+// Generate the schemas of the names and their dependencies, all schemas if empty
+func (g *Generator) Generate(w io.Writer, names ...string) (err error) {
+	gn := g.generator()
+	gn.use("encoding/json")
+	gn.use("reflect")
+	gn.use(selfPath)
+	ts := g.Types
+	ts.lk.RLock()
+	defer ts.lk.RUnlock()
+	if len(names) == 0 {
+		for nm := range ts.sm {
+			names = append(names, nm)
+		}
+		sort.Strings(names)
+	}
+	for _, nm := range names {
+		if err = gn.visit(nm); err != nil {
+			return
+		}
+	}
+	if gn.Methods {
+		for _, nm := range gn.order {
+			gn.local[ts.tm[nm]] = nm
+		}
+	}
+	var ds []string
+	for _, nm := range gn.order {
+		d := gn.decl(nm)
+		if gn.Methods {
+			m, err := gn.methods(nm, ts.tm[nm])
+			if err != nil {
+				return fmt.Errorf("%s: %v", nm, err)
+			}
+			d += "\n" + m
+		}
+		ds = append(ds, d)
+	}
+	gn.header()
+	b := &gn.buf
+	fmt.Fprintf(b, "\n// %s of the generated types\nvar %s = schema.New()\n", gn.Var, gn.Var)
+	for _, d := range ds {
+		b.WriteString("\n" + d)
+	}
+	if err = gn.init(); err != nil {
+		return
+	}
+	return gn.write(w)
+}
+
+// visit a schema after its dependencies
+func (gn *generator) visit(name string) (err error) {
+	if gn.seen[name] {
+		return
+	}
+	gn.seen[name] = true
+	s, ok := gn.Types.sm[name]
+	if !ok {
+		return fmt.Errorf("not a schema: %s", name)
+	}
+	for _, e := range s.Extends {
+		if err = gn.visit(e); err != nil {
+			return
+		}
+	}
+	t := gn.Types.tm[name]
+	if c, ok := gn.Types.cd[t].(*unionCodec); ok {
+		for _, vt := range c.types {
+			if err = gn.deps(vt); err != nil {
+				return
+			}
+		}
+	} else {
+		for i := 0; i < t.NumField(); i++ {
+			if err = gn.deps(t.Field(i).Type); err != nil {
+				return
+			}
+		}
+	}
+	gn.order = append(gn.order, name)
+	return
+}
+
+// deps of a type, the schemas are visited and the others defined by source code are added
+func (gn *generator) deps(t reflect.Type) error {
+	if nm, ok := gn.Types.tn[t]; ok {
+		if _, ok = gn.Types.sm[nm]; ok {
+			return gn.visit(nm)
+		}
+		if t.PkgPath() != "" {
+			if nm != t.Name() {
+				return fmt.Errorf("%s is registered as %s", t, nm)
+			}
+			if !gn.added[t] {
+				gn.added[t] = true
+				gn.extern = append(gn.extern, t)
+				gn.use(t.PkgPath())
+			}
+			return nil
+		}
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Ptr:
+		return gn.deps(t.Elem())
+	case reflect.Map:
+		if err := gn.deps(t.Key()); err != nil {
+			return err
+		}
+		return gn.deps(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if err := gn.deps(t.Field(i).Type); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// goType of a type in the generated source
+func (gn *generator) goType(t reflect.Type) string {
+	if nm, ok := gn.local[t]; ok {
+		return nm
+	}
+	if nm, ok := gn.Types.tn[t]; ok {
+		if _, ok = gn.Types.sm[nm]; ok {
+			return nm
+		}
+	}
+	if t.Name() != "" {
+		if t.PkgPath() == "" || t.PkgPath() == gn.pkgPath {
+			return t.Name()
+		}
+		gn.use(t.PkgPath())
+		return path.Base(t.PkgPath()) + "." + t.Name()
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		return "[]" + gn.goType(t.Elem())
+	case reflect.Array:
+		return "[" + strconv.Itoa(t.Len()) + "]" + gn.goType(t.Elem())
+	case reflect.Ptr:
+		return "*" + gn.goType(t.Elem())
+	case reflect.Map:
+		return "map[" + gn.goType(t.Key()) + "]" + gn.goType(t.Elem())
+	case reflect.Struct:
+		return gn.structType(t)
+	}
+	return t.String()
+}
+
+// structType of the fields of t
+func (gn *generator) structType(t reflect.Type) string {
+	b := &strings.Builder{}
+	b.WriteString("struct {\n")
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		typ := gn.goType(sf.Type)
+		if sf.Anonymous {
+			b.WriteString(typ)
+		} else {
+			b.WriteString(sf.Name + " " + typ)
+		}
+		if tag := string(sf.Tag); tag != "" {
+			if strings.Contains(tag, "`") {
+				b.WriteString(" " + strconv.Quote(tag))
+			} else {
+				b.WriteString(" `" + tag + "`")
+			}
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// decl of a schema type and its constructors
+func (gn *generator) decl(name string) string {
+	t := gn.Types.tm[name]
+	b := &strings.Builder{}
+	switch c := gn.Types.cd[t].(type) {
+	case *enumCodec:
+		fmt.Fprintf(b, "// %s enum\ntype %s %s\n\n// Members of %s\nvar (\n", name, name, gn.structType(t), name)
+		for i, nm := range c.names {
+			v := c.values[i]
+			lit := fmt.Sprint(v.Interface())
+			if v.Kind() == reflect.String {
+				lit = strconv.Quote(v.String())
+			}
+			fmt.Fprintf(b, "%s%s = %s{Value: %s}\n", name, nm, name, lit)
+		}
+		b.WriteString(")\n")
+	case *unionCodec:
+		fmt.Fprintf(b, "// %s union\ntype %s %s\n", name, name, gn.structType(t))
+		for i, nm := range c.names {
+			fmt.Fprintf(b, "\n// New%s%s of the %s variant\nfunc New%s%s(v %s) %s {\n\treturn %s{Variant: %q, Value: v}\n}\n",
+				name, nm, nm, name, nm, gn.goType(c.types[i]), name, name, nm)
+		}
+	default:
+		fmt.Fprintf(b, "// %s schema\ntype %s %s\n", name, name, gn.structType(t))
+		fmt.Fprintf(b, "\n// New%s with the defaults applied\nfunc New%s() *%s {\n\treturn %s(%q).(*%s)\n}\n",
+			name, name, name, gn.lower("New"), name, name)
+	}
+	return b.String()
+}
+
+// lower name of an unexported declaration, prefixed by Var
+func (gn *generator) lower(s string) string {
+	return strings.ToLower(gn.Var[:1]) + gn.Var[1:] + s
+}
+
+// init registers the types defined by source code, then creates the schemas
+// and replaces them by the generated types
+func (gn *generator) init() error {
+	ss := make([]string, len(gn.order))
+	for i, nm := range gn.order {
+		b := &bytes.Buffer{}
+		je := json.NewEncoder(b)
+		je.SetEscapeHTML(false)
+		if err := je.Encode(gn.Types.sm[nm]); err != nil {
+			return err
+		}
+		ss[i] = strings.TrimSuffix(b.String(), "\n")
+	}
+	defs := "[\n" + strings.Join(ss, ",\n") + "\n]"
+	if strings.Contains(defs, "`") {
+		defs = strconv.Quote(defs)
+	} else {
+		defs = "`" + defs + "`"
+	}
+	b := &gn.buf
+	fmt.Fprintf(b, "\nconst %s = %s\n", gn.lower("Defs"), defs)
+	fmt.Fprintf(b, "\n// %s value of a name, with the defaults applied\nfunc %s(name string) interface{} {\n", gn.lower("New"), gn.lower("New"))
+	fmt.Fprintf(b, "\tv, err := %s.NewValue(name)\n\tif err != nil {\n\t\tpanic(err)\n\t}\n\treturn v.Interface()\n}\n", gn.Var)
+	b.WriteString("\nfunc init() {\n")
+	for _, t := range gn.extern {
+		fmt.Fprintf(b, "\tif err := %s.AddType(reflect.TypeOf((*%s)(nil)).Elem()); err != nil {\n\t\tpanic(err)\n\t}\n", gn.Var, gn.goType(t))
+	}
+	fmt.Fprintf(b, "\tvar ss []schema.Schema\n\tif err := json.Unmarshal([]byte(%s), &ss); err != nil {\n\t\tpanic(err)\n\t}\n", gn.lower("Defs"))
+	b.WriteString("\tgs := []reflect.Type{\n")
+	for _, nm := range gn.order {
+		fmt.Fprintf(b, "\t\treflect.TypeOf(%s{}),\n", nm)
+	}
+	b.WriteString("\t}\n\tfor i, s := range ss {\n")
+	fmt.Fprintf(b, "\t\tif _, err := %s.CreateSchema(s); err != nil {\n\t\t\tpanic(err)\n\t\t}\n", gn.Var)
+	fmt.Fprintf(b, "\t\tif err := %s.AddType(gs[i]); err != nil {\n\t\t\tpanic(err)\n\t\t}\n", gn.Var)
+	fmt.Fprintf(b, "\t\tif t, _ := %s.TypeByName(s.Name); t != gs[i] {\n\t\t\tpanic(\"schema: generated type of \" + s.Name + \" differs from the schema\")\n\t\t}\n\t}\n}\n", gn.Var)
+	return nil
+}
@@ -0,0 +1,69 @@
+package schema_test
+
+import (
+	"bytes"
+	"github.com/fengyoulin/schema"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGenerator_Generate(t *testing.T) {
+	ts := newTypes(t, testMapDef, testMapAdded...)
+	b := &bytes.Buffer{}
+	if err := (&schema.Generator{Types: ts, Package: "canvas", Var: "Schemas"}).Generate(b, "Canvas"); err != nil {
+		t.Fatal(err)
+	}
+	src := b.String()
+	for _, s := range []string{
+		"package canvas\n",
+		"var Schemas = schema.New()\n",
+		"type Color struct {\n\tValue uint8 `enum:\"Color\"`\n}\n",
+		"\tColorBlue = Color{Value: 1}\n",
+		"func NewShapeLabel(v string) Shape {\n\treturn Shape{Variant: \"Label\", Value: v}\n}\n",
+		"\tOrigin *Point            `json:\"origin,omitempty\"`\n",
+		"\tAt     time.Time         `json:\"at\"`\n",
+		"func NewCanvas() *Canvas {\n\treturn schemasNew(\"Canvas\").(*Canvas)\n}\n",
+		"Schemas.AddType(reflect.TypeOf((*time.Time)(nil)).Elem())",
+		"\t\treflect.TypeOf(Shape{}),\n\t\treflect.TypeOf(Canvas{}),\n",
+	} {
+		if !strings.Contains(src, s) {
+			t.Errorf("missing %q in:\n%s", s, src)
+		}
+	}
+	if err := (&schema.Generator{Types: ts, Package: "canvas"}).Generate(b, "Time"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestTypes_AddType_generated(t *testing.T) {
+	ts := newTypes(t, testMapDef, testMapAdded...)
+	type Point struct {
+		X int16 `json:"x"`
+		Y int16 `json:"y,omitempty"`
+	}
+	type Color struct {
+		Value uint8 `enum:"Color"`
+	}
+	for _, v := range []interface{}{Point{}, Color{}} {
+		if err := ts.AddType(reflect.TypeOf(v)); err != nil {
+			t.Fatal(err)
+		}
+		if tp, _ := ts.TypeByName(reflect.TypeOf(v).Name()); tp != reflect.TypeOf(v) {
+			t.Errorf("%v is not replaced", tp)
+		}
+	}
+	if nm, ok := ts.Member(reflect.ValueOf(Color{Value: 1})); !ok || nm != "Blue" {
+		t.Errorf("unexpected member: %s", nm)
+	}
+	type Shape struct {
+		Variant string
+		Value   interface{}
+	}
+	if err := ts.AddType(reflect.TypeOf(Shape{})); err != nil {
+		t.Fatal(err)
+	}
+	if tp, _ := ts.TypeByName("Shape"); tp == reflect.TypeOf(Shape{}) {
+		t.Error("replaced by a different type")
+	}
+}
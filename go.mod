@@ -1,3 +1,3 @@
 module github.com/fengyoulin/schema
 
-go 1.10
+go 1.18
@@ -0,0 +1,4 @@
+// Package gentest has the types generated from order.json, tested against the types created from it
+package gentest
+
+//go:generate go run ../../cmd/schema gen -m -s order.json -o order_gen.go
@@ -0,0 +1,206 @@
+package gentest_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"github.com/fengyoulin/schema"
+	"github.com/fengyoulin/schema/internal/gentest"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func loadTypes(t testing.TB) *schema.Types {
+	b, err := ioutil.ReadFile("order.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ss []schema.Schema
+	if err = json.Unmarshal(b, &ss); err != nil {
+		t.Fatal(err)
+	}
+	ts := schema.New()
+	for _, s := range ss {
+		if _, err = ts.CreateSchema(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ts
+}
+
+func TestGenerated(t *testing.T) {
+	for _, v := range []interface{}{gentest.Order{}, gentest.Line{}, gentest.Status{}, gentest.Payment{}, gentest.Entity{}} {
+		rt := reflect.TypeOf(v)
+		if nm, ok := gentest.Types.NameByType(rt); !ok || nm != rt.Name() {
+			t.Errorf("name of %s: %s", rt, nm)
+		}
+		if tp, ok := gentest.Types.TypeByName(rt.Name()); !ok || tp != rt {
+			t.Errorf("type of %s: %v", rt.Name(), tp)
+		}
+	}
+	o := gentest.NewOrder()
+	if o.Status != gentest.StatusPaid {
+		t.Errorf("default status: %v", o.Status)
+	}
+	l := gentest.NewLine()
+	l.SKU = "A-1"
+	if l.Qty != 1 {
+		t.Errorf("default qty: %d", l.Qty)
+	}
+	o.ID = 7
+	o.OpenID = "x"
+	o.Lines = append(o.Lines, *l)
+	o.Payment = gentest.NewPaymentPoints(30)
+	o.Ship = &struct {
+		City string
+		Zip  [6]uint8
+	}{City: "c", Zip: [6]uint8{1, 2}}
+	if err := gentest.Types.Validate(o); err != nil {
+		t.Fatal(err)
+	}
+	b := &bytes.Buffer{}
+	if err := (&schema.Encoder{Writer: b, Types: gentest.Types}).Encode(o); err != nil {
+		t.Fatal(err)
+	}
+	src := append([]byte(nil), b.Bytes()...)
+	ts := loadTypes(t)
+	dv, err := ts.NewValue("Order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = (&schema.Decoder{Reader: bytes.NewReader(src), Types: ts}).Decode(dv.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	b.Reset()
+	if err = (&schema.Encoder{Writer: b, Types: ts}).Encode(dv.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), src) {
+		t.Errorf("%x != %x", b.Bytes(), src)
+	}
+	back := &gentest.Order{}
+	if err = (&schema.Decoder{Reader: b, Types: gentest.Types}).Decode(back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, o) {
+		t.Errorf("%+v != %+v", back, o)
+	}
+	o.Lines = nil
+	o.ID = 0
+	if err = gentest.Types.Validate(o); err == nil {
+		t.Error("expected constraint and rule errors")
+	} else if es, ok := err.(schema.FieldErrors); !ok || len(es) != 2 {
+		t.Errorf("unexpected errors: %v", err)
+	}
+}
+
+func TestGenerator_Generate(t *testing.T) {
+	exp, err := ioutil.ReadFile("order_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &bytes.Buffer{}
+	if err = (&schema.Generator{Types: loadTypes(t), Package: "gentest", Methods: true}).Generate(b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), exp) {
+		t.Errorf("order_gen.go is out of date, run go generate:\n%s", b)
+	}
+}
+
+var update = flag.Bool("update", false, "update the generated files")
+
+func TestGenerator_GenerateMethods(t *testing.T) {
+	b := &bytes.Buffer{}
+	if err := (&schema.Generator{Types: gentest.Types, Package: "gentest"}).GenerateMethods(b, reflect.TypeOf(gentest.Sample{})); err != nil {
+		t.Fatal(err)
+	}
+	if *update {
+		if err := ioutil.WriteFile("sample_gen.go", b.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exp, err := ioutil.ReadFile("sample_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), exp) {
+		t.Errorf("sample_gen.go is out of date, run go generate:\n%s", b)
+	}
+}
+
+func TestCheckGenerated(t *testing.T) {
+	f := 2.5
+	pf := &f
+	for i, v := range []interface{}{
+		&gentest.Sample{},
+		&gentest.Sample{
+			Line:    gentest.Line{SKU: "A", Qty: -3},
+			Flag:    true,
+			Small:   -128,
+			Temp:    -40.5,
+			Big:     complex(1, -2),
+			Raw:     []byte{0, 255},
+			Signs:   []int8{-1, 1},
+			Bits:    []bool{true, false},
+			Tags:    gentest.Tags{"x", ""},
+			Grid:    [2][3]int16{{1, 2, 3}, {-4, 5, 6}},
+			Nested:  map[uint16][]*gentest.Line{7: {nil, {SKU: "B"}}},
+			Deep:    &pf,
+			Plain:   gentest.Plain{A: 1, B: []string{"b"}},
+			Any:     gentest.Line{Qty: 2},
+			Status:  gentest.StatusShipped,
+			Payment: &gentest.Payment{Value: "card"},
+		},
+		&gentest.Sample{Payment: &gentest.Payment{}, Nested: map[uint16][]*gentest.Line{1: nil, 2: nil, 3: nil}},
+		&gentest.Order{ID: 1, Lines: []gentest.Line{{SKU: "A"}}, Payment: gentest.NewPaymentPoints(9), Attrs: map[string]string{"k": "v"}},
+	} {
+		if err := schema.CheckGenerated(gentest.Types, v); err != nil {
+			t.Errorf("%d: %v", i, err)
+		}
+	}
+	for _, v := range []interface{}{
+		&gentest.Sample{Status: gentest.Status{Value: 9}},
+		&gentest.Sample{Payment: &gentest.Payment{Variant: "Card", Value: 1}},
+		&gentest.Sample{Any: struct{}{}},
+	} {
+		if err := schema.CheckGenerated(gentest.Types, v); err == nil {
+			t.Errorf("%+v: expected error", v)
+		}
+	}
+	if err := schema.CheckGenerated(gentest.Types, &struct{}{}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func benchOrder(b *testing.B, v interface{}, ts *schema.Types) {
+	w := &bytes.Buffer{}
+	e := &schema.Encoder{Writer: w, Types: ts}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w.Reset()
+		if err := e.Encode(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func testOrder() *gentest.Order {
+	return &gentest.Order{ID: 7, Status: gentest.StatusPaid, OpenID: "o", Lines: []gentest.Line{{SKU: "A-1", Qty: 2}, {SKU: "B-2", Qty: 1}}, Payment: gentest.NewPaymentCard("c")}
+}
+
+func BenchmarkEncoder_Generated(b *testing.B) {
+	benchOrder(b, testOrder(), gentest.Types)
+}
+
+func BenchmarkEncoder_Reflection(b *testing.B) {
+	ts := loadTypes(nil)
+	v, err := schema.FromMap(ts, "Order", map[string]interface{}{"id": 7, "Status": "Paid", "open_id": "o",
+		"lines":   []interface{}{map[string]interface{}{"sku": "A-1", "qty": 2}, map[string]interface{}{"sku": "B-2", "qty": 1}},
+		"Payment": map[string]interface{}{"$type": "Card", "value": "c"}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchOrder(b, v, ts)
+}
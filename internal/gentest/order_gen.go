@@ -0,0 +1,411 @@
+// Code generated by schema gen. DO NOT EDIT.
+
+package gentest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fengyoulin/schema"
+	"reflect"
+)
+
+// Types of the generated types
+var Types = schema.New()
+
+// Entity schema
+type Entity struct {
+	ID uint64 `json:"id"`
+}
+
+// NewEntity with the defaults applied
+func NewEntity() *Entity {
+	return typesNew("Entity").(*Entity)
+}
+
+// MarshalSchema as Encoder
+func (v *Entity) MarshalSchema(e *schema.Encoder) error {
+	if err := e.EncodeUint(v.ID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// UnmarshalSchema as Decoder
+func (v *Entity) UnmarshalSchema(d *schema.Decoder) error {
+	if x, err := d.DecodeUint(); err != nil {
+		return err
+	} else {
+		v.ID = x
+	}
+	return nil
+}
+
+// Line schema
+type Line struct {
+	SKU string `json:"sku"`
+	Qty int    `json:"qty"`
+}
+
+// NewLine with the defaults applied
+func NewLine() *Line {
+	return typesNew("Line").(*Line)
+}
+
+// MarshalSchema as Encoder
+func (v *Line) MarshalSchema(e *schema.Encoder) error {
+	if err := e.EncodeString(v.SKU); err != nil {
+		return err
+	}
+	if err := e.EncodeInt(int64(v.Qty)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// UnmarshalSchema as Decoder
+func (v *Line) UnmarshalSchema(d *schema.Decoder) error {
+	if x, err := d.DecodeString(); err != nil {
+		return err
+	} else if x != "" {
+		v.SKU = x
+	}
+	if x, err := d.DecodeInt(); err != nil {
+		return err
+	} else {
+		v.Qty = int(x)
+	}
+	return nil
+}
+
+// Status enum
+type Status struct {
+	Value uint8 `enum:"Status"`
+}
+
+// Members of Status
+var (
+	StatusNew     = Status{Value: 0}
+	StatusPaid    = Status{Value: 1}
+	StatusShipped = Status{Value: 2}
+)
+
+// MarshalSchema as Encoder
+func (v *Status) MarshalSchema(e *schema.Encoder) error {
+	switch v.Value {
+	case 0:
+		return e.EncodeUint(0)
+	case 1:
+		return e.EncodeUint(1)
+	case 2:
+		return e.EncodeUint(2)
+	}
+	return fmt.Errorf("invalid value of enum Status: %v", v.Value)
+}
+
+// UnmarshalSchema as Decoder
+func (v *Status) UnmarshalSchema(d *schema.Decoder) error {
+	u, err := d.DecodeUint()
+	if err != nil {
+		return err
+	}
+	switch u {
+	case 0:
+		v.Value = 0
+	case 1:
+		v.Value = 1
+	case 2:
+		v.Value = 2
+	default:
+		return fmt.Errorf("ordinal %d out of range of enum: Status", u)
+	}
+	return nil
+}
+
+// Payment union
+type Payment struct {
+	Variant string `union:"Payment"`
+	Value   interface{}
+}
+
+// NewPaymentCard of the Card variant
+func NewPaymentCard(v string) Payment {
+	return Payment{Variant: "Card", Value: v}
+}
+
+// NewPaymentPoints of the Points variant
+func NewPaymentPoints(v uint32) Payment {
+	return Payment{Variant: "Points", Value: v}
+}
+
+// MarshalSchema as Encoder
+func (v *Payment) MarshalSchema(e *schema.Encoder) error {
+	switch v.Variant {
+	case "":
+		switch val := v.Value.(type) {
+		case nil:
+			return e.EncodeUint(0)
+		case string:
+			if err := e.EncodeUint(1); err != nil {
+				return err
+			}
+			if err := e.EncodeString(val); err != nil {
+				return err
+			}
+			return nil
+		case uint32:
+			if err := e.EncodeUint(2); err != nil {
+				return err
+			}
+			if err := e.EncodeUint(uint64(val)); err != nil {
+				return err
+			}
+			return nil
+		}
+		return fmt.Errorf("invalid type of union Payment: %T", v.Value)
+	case "Card":
+		val, ok := v.Value.(string)
+		if !ok {
+			return fmt.Errorf("invalid value of variant Payment.Card")
+		}
+		if err := e.EncodeUint(1); err != nil {
+			return err
+		}
+		if err := e.EncodeString(val); err != nil {
+			return err
+		}
+		return nil
+	case "Points":
+		val, ok := v.Value.(uint32)
+		if !ok {
+			return fmt.Errorf("invalid value of variant Payment.Points")
+		}
+		if err := e.EncodeUint(2); err != nil {
+			return err
+		}
+		if err := e.EncodeUint(uint64(val)); err != nil {
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown variant of union Payment: %s", v.Variant)
+}
+
+// UnmarshalSchema as Decoder
+func (v *Payment) UnmarshalSchema(d *schema.Decoder) error {
+	u, err := d.DecodeUint()
+	if err != nil {
+		return err
+	}
+	switch u {
+	case 0:
+		*v = Payment{}
+	case 1:
+		var val string
+		if x, err := d.DecodeString(); err != nil {
+			return err
+		} else if x != "" {
+			val = x
+		}
+		v.Variant, v.Value = "Card", val
+	case 2:
+		var val uint32
+		if x, err := d.DecodeUint(); err != nil {
+			return err
+		} else {
+			val = uint32(x)
+		}
+		v.Variant, v.Value = "Points", val
+	default:
+		return fmt.Errorf("variant %d out of range of union: Payment", u-1)
+	}
+	return nil
+}
+
+// Order schema
+type Order struct {
+	ID      uint64 `json:"id"`
+	Status  Status
+	OpenID  string `json:"open_id" schema:"open_id"`
+	Lines   []Line `json:"lines"`
+	Payment Payment
+	Ship    *struct {
+		City string
+		Zip  [6]uint8
+	}
+	Attrs map[string]string `json:"attrs,omitempty"`
+}
+
+// NewOrder with the defaults applied
+func NewOrder() *Order {
+	return typesNew("Order").(*Order)
+}
+
+// MarshalSchema as Encoder
+func (v *Order) MarshalSchema(e *schema.Encoder) error {
+	if err := e.EncodeUint(v.ID); err != nil {
+		return err
+	}
+	if err := v.Status.MarshalSchema(e); err != nil {
+		return err
+	}
+	if err := e.EncodeString(v.OpenID); err != nil {
+		return err
+	}
+	if err := e.EncodeInt(int64(len(v.Lines))); err != nil {
+		return err
+	}
+	for i0 := range v.Lines {
+		if err := v.Lines[i0].MarshalSchema(e); err != nil {
+			return err
+		}
+	}
+	if err := v.Payment.MarshalSchema(e); err != nil {
+		return err
+	}
+	if err := e.EncodeBool(v.Ship != nil); err != nil {
+		return err
+	}
+	if v.Ship != nil {
+		if err := e.EncodeString((*v.Ship).City); err != nil {
+			return err
+		}
+		for i0 := range (*v.Ship).Zip {
+			if err := e.EncodeUint8((*v.Ship).Zip[i0]); err != nil {
+				return err
+			}
+		}
+	}
+	if err := e.EncodeInt(int64(len(v.Attrs))); err != nil {
+		return err
+	}
+	for k0, v0 := range v.Attrs {
+		if err := e.EncodeString(k0); err != nil {
+			return err
+		}
+		if err := e.EncodeString(v0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalSchema as Decoder
+func (v *Order) UnmarshalSchema(d *schema.Decoder) error {
+	if x, err := d.DecodeUint(); err != nil {
+		return err
+	} else {
+		v.ID = x
+	}
+	if err := v.Status.UnmarshalSchema(d); err != nil {
+		return err
+	}
+	if x, err := d.DecodeString(); err != nil {
+		return err
+	} else if x != "" {
+		v.OpenID = x
+	}
+	if n0, err := d.DecodeInt(); err != nil {
+		return err
+	} else if n0 > 0 {
+		if cap(v.Lines) < int(n0) {
+			v.Lines = make([]Line, n0)
+		} else {
+			v.Lines = v.Lines[:n0]
+		}
+		for i0 := range v.Lines {
+			if err := v.Lines[i0].UnmarshalSchema(d); err != nil {
+				return err
+			}
+		}
+	}
+	if err := v.Payment.UnmarshalSchema(d); err != nil {
+		return err
+	}
+	if ok, err := d.DecodeBool(); err != nil {
+		return err
+	} else if ok {
+		if v.Ship == nil {
+			v.Ship = new(struct {
+				City string
+				Zip  [6]uint8
+			})
+		}
+		if x, err := d.DecodeString(); err != nil {
+			return err
+		} else if x != "" {
+			(*v.Ship).City = x
+		}
+		for i0 := range (*v.Ship).Zip {
+			if x, err := d.DecodeUint8(); err != nil {
+				return err
+			} else {
+				(*v.Ship).Zip[i0] = x
+			}
+		}
+	}
+	if n0, err := d.DecodeInt(); err != nil {
+		return err
+	} else if n0 > 0 {
+		if v.Attrs == nil {
+			v.Attrs = make(map[string]string, n0)
+		}
+		for i0 := int64(0); i0 < n0; i0++ {
+			var k0 string
+			var v0 string
+			if x, err := d.DecodeString(); err != nil {
+				return err
+			} else if x != "" {
+				k0 = x
+			}
+			if x, err := d.DecodeString(); err != nil {
+				return err
+			} else if x != "" {
+				v0 = x
+			}
+			v.Attrs[k0] = v0
+		}
+	}
+	return nil
+}
+
+const typesDefs = `[
+{"name":"Entity","fields":[{"name":"ID","type":"uint64","tags":{"json":"id"},"constraints":{"required":true}}]},
+{"name":"Line","fields":[{"name":"SKU","type":"string","tags":{"json":"sku"},"constraints":{"pattern":"^[A-Z0-9-]+$"}},{"name":"Qty","type":"int","tags":{"json":"qty"},"default":1,"constraints":{"min":1}}]},
+{"name":"Status","type":"uint8","members":[{"name":"New"},{"name":"Paid"},{"name":"Shipped"}]},
+{"name":"Payment","variants":[{"name":"Card","type":"string"},{"name":"Points","type":"uint32"}]},
+{"name":"Order","extends":["Entity"],"fields":[{"name":"Status","type":"Status","default":"Paid"},{"name":"open_id","type":"string"},{"name":"Lines","type":"[]Line","tags":{"json":"lines"}},{"name":"Payment","type":"Payment"},{"name":"Ship","type":"*struct","fields":[{"name":"City","type":"string"},{"name":"Zip","type":"[6]byte"}]},{"name":"Attrs","type":"map[string]string","tags":{"json":"attrs,omitempty"}}],"rules":["len(Lines) > 0 || Status == \"New\""]}
+]`
+
+// typesNew value of a name, with the defaults applied
+func typesNew(name string) interface{} {
+	v, err := Types.NewValue(name)
+	if err != nil {
+		panic(err)
+	}
+	return v.Interface()
+}
+
+func init() {
+	var ss []schema.Schema
+	if err := json.Unmarshal([]byte(typesDefs), &ss); err != nil {
+		panic(err)
+	}
+	gs := []reflect.Type{
+		reflect.TypeOf(Entity{}),
+		reflect.TypeOf(Line{}),
+		reflect.TypeOf(Status{}),
+		reflect.TypeOf(Payment{}),
+		reflect.TypeOf(Order{}),
+	}
+	for i, s := range ss {
+		if _, err := Types.CreateSchema(s); err != nil {
+			panic(err)
+		}
+		if err := Types.AddType(gs[i]); err != nil {
+			panic(err)
+		}
+		if t, _ := Types.TypeByName(s.Name); t != gs[i] {
+			panic("schema: generated type of " + s.Name + " differs from the schema")
+		}
+	}
+}
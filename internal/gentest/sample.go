@@ -0,0 +1,35 @@
+package gentest
+
+//go:generate go test -run TestGenerator_GenerateMethods -update
+
+// Celsius of a named basic type
+type Celsius float32
+
+// Tags of a named slice type
+type Tags []string
+
+// Plain struct without methods, encoded by reflection
+type Plain struct {
+	A int
+	B []string
+}
+
+// Sample of Go types with generated methods, covering the kinds
+type Sample struct {
+	Line
+	Flag    bool
+	Small   int8
+	Temp    Celsius
+	Big     complex128
+	Raw     []byte
+	Signs   []int8
+	Bits    []bool
+	Tags    Tags
+	Grid    [2][3]int16
+	Nested  map[uint16][]*Line
+	Deep    **float64
+	Plain   Plain
+	Any     interface{}
+	Status  Status
+	Payment *Payment
+}
@@ -0,0 +1,279 @@
+// Code generated by schema gen. DO NOT EDIT.
+
+package gentest
+
+import (
+	"github.com/fengyoulin/schema"
+	"reflect"
+)
+
+// MarshalSchema as Encoder
+func (v *Sample) MarshalSchema(e *schema.Encoder) error {
+	if err := v.Line.MarshalSchema(e); err != nil {
+		return err
+	}
+	if err := e.EncodeBool(v.Flag); err != nil {
+		return err
+	}
+	if err := e.EncodeInt8(v.Small); err != nil {
+		return err
+	}
+	if err := e.EncodeFloat32(float32(v.Temp)); err != nil {
+		return err
+	}
+	if err := e.EncodeComplex128(v.Big); err != nil {
+		return err
+	}
+	if err := e.EncodeBytes(v.Raw); err != nil {
+		return err
+	}
+	if err := e.EncodeInt(int64(len(v.Signs))); err != nil {
+		return err
+	}
+	for i0 := range v.Signs {
+		if err := e.EncodeInt8(v.Signs[i0]); err != nil {
+			return err
+		}
+	}
+	if err := e.EncodeInt(int64(len(v.Bits))); err != nil {
+		return err
+	}
+	for i0 := range v.Bits {
+		if err := e.EncodeBool(v.Bits[i0]); err != nil {
+			return err
+		}
+	}
+	if err := e.EncodeInt(int64(len(v.Tags))); err != nil {
+		return err
+	}
+	for i0 := range v.Tags {
+		if err := e.EncodeString(v.Tags[i0]); err != nil {
+			return err
+		}
+	}
+	for i0 := range v.Grid {
+		for i1 := range v.Grid[i0] {
+			if err := e.EncodeInt(int64(v.Grid[i0][i1])); err != nil {
+				return err
+			}
+		}
+	}
+	if err := e.EncodeInt(int64(len(v.Nested))); err != nil {
+		return err
+	}
+	for k0, v0 := range v.Nested {
+		if err := e.EncodeUint(uint64(k0)); err != nil {
+			return err
+		}
+		if err := e.EncodeInt(int64(len(v0))); err != nil {
+			return err
+		}
+		for i1 := range v0 {
+			if err := e.EncodeBool(v0[i1] != nil); err != nil {
+				return err
+			}
+			if v0[i1] != nil {
+				if err := (*v0[i1]).MarshalSchema(e); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := e.EncodeBool(v.Deep != nil); err != nil {
+		return err
+	}
+	if v.Deep != nil {
+		if err := e.EncodeBool((*v.Deep) != nil); err != nil {
+			return err
+		}
+		if (*v.Deep) != nil {
+			if err := e.EncodeFloat64((*(*v.Deep))); err != nil {
+				return err
+			}
+		}
+	}
+	if err := e.InternalEncode(reflect.ValueOf(&v.Plain).Elem()); err != nil {
+		return err
+	}
+	if err := e.InternalEncode(reflect.ValueOf(&v.Any).Elem()); err != nil {
+		return err
+	}
+	if err := v.Status.MarshalSchema(e); err != nil {
+		return err
+	}
+	if err := e.EncodeBool(v.Payment != nil); err != nil {
+		return err
+	}
+	if v.Payment != nil {
+		if err := (*v.Payment).MarshalSchema(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalSchema as Decoder
+func (v *Sample) UnmarshalSchema(d *schema.Decoder) error {
+	if err := v.Line.UnmarshalSchema(d); err != nil {
+		return err
+	}
+	if x, err := d.DecodeBool(); err != nil {
+		return err
+	} else {
+		v.Flag = x
+	}
+	if x, err := d.DecodeInt8(); err != nil {
+		return err
+	} else {
+		v.Small = x
+	}
+	if x, err := d.DecodeFloat32(); err != nil {
+		return err
+	} else {
+		v.Temp = Celsius(x)
+	}
+	if x, err := d.DecodeComplex128(); err != nil {
+		return err
+	} else {
+		v.Big = x
+	}
+	if x, err := d.DecodeBytes(); err != nil {
+		return err
+	} else if len(x) > 0 {
+		v.Raw = x
+	}
+	if n0, err := d.DecodeInt(); err != nil {
+		return err
+	} else if n0 > 0 {
+		if cap(v.Signs) < int(n0) {
+			v.Signs = make([]int8, n0)
+		} else {
+			v.Signs = v.Signs[:n0]
+		}
+		for i0 := range v.Signs {
+			if x, err := d.DecodeInt8(); err != nil {
+				return err
+			} else {
+				v.Signs[i0] = x
+			}
+		}
+	}
+	if n0, err := d.DecodeInt(); err != nil {
+		return err
+	} else if n0 > 0 {
+		if cap(v.Bits) < int(n0) {
+			v.Bits = make([]bool, n0)
+		} else {
+			v.Bits = v.Bits[:n0]
+		}
+		for i0 := range v.Bits {
+			if x, err := d.DecodeBool(); err != nil {
+				return err
+			} else {
+				v.Bits[i0] = x
+			}
+		}
+	}
+	if n0, err := d.DecodeInt(); err != nil {
+		return err
+	} else if n0 > 0 {
+		if cap(v.Tags) < int(n0) {
+			v.Tags = make(Tags, n0)
+		} else {
+			v.Tags = v.Tags[:n0]
+		}
+		for i0 := range v.Tags {
+			if x, err := d.DecodeString(); err != nil {
+				return err
+			} else if x != "" {
+				v.Tags[i0] = x
+			}
+		}
+	}
+	for i0 := range v.Grid {
+		for i1 := range v.Grid[i0] {
+			if x, err := d.DecodeInt(); err != nil {
+				return err
+			} else {
+				v.Grid[i0][i1] = int16(x)
+			}
+		}
+	}
+	if n0, err := d.DecodeInt(); err != nil {
+		return err
+	} else if n0 > 0 {
+		if v.Nested == nil {
+			v.Nested = make(map[uint16][]*Line, n0)
+		}
+		for i0 := int64(0); i0 < n0; i0++ {
+			var k0 uint16
+			var v0 []*Line
+			if x, err := d.DecodeUint(); err != nil {
+				return err
+			} else {
+				k0 = uint16(x)
+			}
+			if n1, err := d.DecodeInt(); err != nil {
+				return err
+			} else if n1 > 0 {
+				if cap(v0) < int(n1) {
+					v0 = make([]*Line, n1)
+				} else {
+					v0 = v0[:n1]
+				}
+				for i1 := range v0 {
+					if ok, err := d.DecodeBool(); err != nil {
+						return err
+					} else if ok {
+						if v0[i1] == nil {
+							v0[i1] = new(Line)
+						}
+						if err := (*v0[i1]).UnmarshalSchema(d); err != nil {
+							return err
+						}
+					}
+				}
+			}
+			v.Nested[k0] = v0
+		}
+	}
+	if ok, err := d.DecodeBool(); err != nil {
+		return err
+	} else if ok {
+		if v.Deep == nil {
+			v.Deep = new(*float64)
+		}
+		if ok, err := d.DecodeBool(); err != nil {
+			return err
+		} else if ok {
+			if (*v.Deep) == nil {
+				(*v.Deep) = new(float64)
+			}
+			if x, err := d.DecodeFloat64(); err != nil {
+				return err
+			} else {
+				(*(*v.Deep)) = x
+			}
+		}
+	}
+	if err := d.InternalDecode(reflect.ValueOf(&v.Plain).Elem()); err != nil {
+		return err
+	}
+	if err := d.InternalDecode(reflect.ValueOf(&v.Any).Elem()); err != nil {
+		return err
+	}
+	if err := v.Status.UnmarshalSchema(d); err != nil {
+		return err
+	}
+	if ok, err := d.DecodeBool(); err != nil {
+		return err
+	} else if ok {
+		if v.Payment == nil {
+			v.Payment = new(Payment)
+		}
+		if err := (*v.Payment).UnmarshalSchema(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// JSONMarshal a value of Types as encoding/json does, except that interface
+// values are objects of TypeKey, named by TypeString, and ValueKey, and enums
+// and unions are written as by ToMap
+func JSONMarshal(ts *Types, v interface{}) (b []byte, err error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return []byte("null"), nil
+	}
+	var es FieldErrors
+	r := ts.toValue(rv, "", &es, true)
+	if len(es) > 0 {
+		return nil, es
+	}
+	return json.Marshal(r)
+}
+
+// JSONUnmarshal data written by JSONMarshal into the value pointed by v, the
+// concrete types of interface values are created by CreateType
+func JSONUnmarshal(ts *Types, data []byte, v interface{}) (err error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("%T is not pointer", v)
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var doc interface{}
+	if err = d.Decode(&doc); err != nil {
+		return
+	}
+	var es FieldErrors
+	ts.fromValue(rv.Elem(), doc, "", &es)
+	if len(es) > 0 {
+		return es
+	}
+	return
+}
+
+// object of JSON with the members in order
+type object []member
+
+type member struct {
+	key   string
+	value interface{}
+}
+
+// MarshalJSON of the members in order
+func (o object) MarshalJSON() ([]byte, error) {
+	b := &bytes.Buffer{}
+	b.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(m.key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
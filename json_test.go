@@ -0,0 +1,59 @@
+package schema_test
+
+import (
+	"github.com/fengyoulin/schema"
+	"reflect"
+	"testing"
+)
+
+type testJSONDoc struct {
+	Name  string        `json:"name"`
+	Any   interface{}   `json:"any"`
+	List  []interface{} `json:"list,omitempty"`
+	Color Any           `json:"color"`
+	Empty interface{}
+}
+
+func TestJSONMarshal(t *testing.T) {
+	ts := newTypes(t, testMapDef, testMapAdded...)
+	p, err := ts.New("Point")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Set("X", 1); err != nil {
+		t.Fatal(err)
+	}
+	c, err := ts.New("Color")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ts.SetMember(reflect.ValueOf(c.Interface()).Elem(), "Blue"); err != nil {
+		t.Fatal(err)
+	}
+	doc := testJSONDoc{
+		Name:  "n",
+		Any:   reflect.ValueOf(p.Interface()).Elem().Interface(),
+		List:  []interface{}{int16(3), "x", []string{"a"}},
+		Color: reflect.ValueOf(c.Interface()).Elem().Interface(),
+	}
+	b, err := schema.JSONMarshal(ts, &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := `{"name":"n","any":{"$type":"Point","value":{"x":1}},"list":[{"$type":"int16","value":3},` +
+		`{"$type":"string","value":"x"},{"$type":"[]string","value":["a"]}],"color":{"$type":"Color","value":"Blue"},"Empty":null}`
+	if string(b) != exp {
+		t.Errorf("%s != %s", b, exp)
+	}
+	var back testJSONDoc
+	if err = schema.JSONUnmarshal(ts, b, &back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, doc) {
+		t.Errorf("%+v != %+v", back, doc)
+	}
+	err = schema.JSONUnmarshal(ts, []byte(`{"any":{"$type":"Nothing","value":1},"list":[{"value":2}]}`), &back)
+	if es, ok := err.(schema.FieldErrors); !ok || len(es) != 2 || es[1].Path != "list[0]" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
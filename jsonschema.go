@@ -0,0 +1,885 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSONSchemaDraft is the $schema of the documents by JSONSchema
+const JSONSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// Patterns of the property names of maps with integer keys
+const (
+	intKeyPattern  = "^-?[0-9]+$"
+	uintKeyPattern = "^[0-9]+$"
+)
+
+// JSONSchema of a named type as a document of JSON Schema draft 2020-12 for
+// the data of JSONMarshal, the schema types it refers to are in $defs, integer
+// widths are bounded by minimum and maximum, pointers, slices and maps are
+// nullable, and the properties are named by json tags
+func (ts *Types) JSONSchema(name string) (b []byte, err error) {
+	t, ok := ts.TypeByName(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown type: %s", name)
+	}
+	x := &jsonExporter{ts: ts, defs: make(map[string]interface{})}
+	s, err := x.schema(t, nil)
+	if err != nil {
+		return
+	}
+	s["$schema"] = JSONSchemaDraft
+	if len(x.defs) > 0 {
+		s["$defs"] = x.defs
+	}
+	return json.Marshal(s)
+}
+
+type jsonExporter struct {
+	ts   *Types
+	defs map[string]interface{}
+}
+
+// schema of a type with the constraints of a field, c may be nil
+func (x *jsonExporter) schema(t reflect.Type, c *Constraints) (s map[string]interface{}, err error) {
+	if nm, ok := x.ts.NameByType(t); ok && t.Kind() == reflect.Struct && t != timeType && ir.MatchString(nm) {
+		if _, ok = x.defs[nm]; !ok {
+			x.defs[nm] = nil // referred recursively
+			if x.defs[nm], err = x.def(t); err != nil {
+				return nil, fmt.Errorf("%s: %v", nm, err)
+			}
+		}
+		s = map[string]interface{}{"$ref": "#/$defs/" + nm}
+		constrain(s, t, c)
+		return
+	}
+	if t == timeType {
+		s = map[string]interface{}{"type": "string", "format": "date-time"}
+		constrain(s, t, c)
+		return
+	}
+	if t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface && t.Implements(jsonMarshaler) {
+		return map[string]interface{}{}, nil // any value
+	}
+	var ce *Constraints
+	if c != nil {
+		ce = c.Elem
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		s = map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b := uint(t.Bits())
+		s = map[string]interface{}{"type": "integer", "minimum": -int64(1) << (b - 1), "maximum": int64(1)<<(b-1) - 1}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		s = map[string]interface{}{"type": "integer", "minimum": 0, "maximum": ^uint64(0) >> (64 - uint(t.Bits()))}
+	case reflect.Float32, reflect.Float64:
+		s = map[string]interface{}{"type": "number"}
+	case reflect.String:
+		s = map[string]interface{}{"type": "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			s = map[string]interface{}{"type": []string{"string", "null"}, "contentEncoding": "base64"}
+			break
+		}
+		var it map[string]interface{}
+		if it, err = x.schema(t.Elem(), ce); err != nil {
+			return
+		}
+		s = map[string]interface{}{"type": []string{"array", "null"}, "items": it}
+	case reflect.Array:
+		var it map[string]interface{}
+		if it, err = x.schema(t.Elem(), ce); err != nil {
+			return
+		}
+		s = map[string]interface{}{"type": "array", "items": it, "minItems": t.Len(), "maxItems": t.Len()}
+	case reflect.Map:
+		var it map[string]interface{}
+		if it, err = x.schema(t.Elem(), ce); err != nil {
+			return
+		}
+		s = map[string]interface{}{"type": []string{"object", "null"}, "additionalProperties": it}
+		var ck *Constraints
+		if c != nil {
+			ck = c.Key
+		}
+		if pn := x.keySchema(t.Key(), ck); len(pn) > 0 {
+			s["propertyNames"] = pn
+		}
+	case reflect.Ptr:
+		if s, err = x.schema(t.Elem(), c); err != nil {
+			return
+		}
+		return nullable(s), nil
+	case reflect.Interface:
+		return map[string]interface{}{
+			"type": []string{"object", "null"},
+			"properties": object{
+				{TypeKey, map[string]interface{}{"type": "string"}},
+				{ValueKey, map[string]interface{}{}},
+			},
+			"required":             []string{TypeKey, ValueKey},
+			"additionalProperties": false,
+		}, nil
+	case reflect.Struct:
+		s, err = x.object(t)
+	default:
+		err = fmt.Errorf("unsupported type: %s", t)
+	}
+	if err == nil {
+		constrain(s, t, c)
+	}
+	return
+}
+
+// def of a named struct, an enum or a union
+func (x *jsonExporter) def(t reflect.Type) (s map[string]interface{}, err error) {
+	switch c := x.ts.codecOf(t).(type) {
+	case *enumCodec:
+		return map[string]interface{}{"type": "string", "enum": c.names}, nil
+	case *unionCodec:
+		vs := make([]interface{}, 0, len(c.names)+1)
+		for i, nm := range c.names {
+			v, err := x.schema(c.types[i], nil)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", nm, err)
+			}
+			vs = append(vs, map[string]interface{}{
+				"type": "object",
+				"properties": object{
+					{TypeKey, map[string]interface{}{"const": nm}},
+					{ValueKey, v},
+				},
+				"required":             []string{TypeKey, ValueKey},
+				"additionalProperties": false,
+			})
+		}
+		vs = append(vs, map[string]interface{}{"type": "null"}) // empty
+		return map[string]interface{}{"oneOf": vs}, nil
+	}
+	return x.object(t)
+}
+
+// object of the fields of a struct, in order
+func (x *jsonExporter) object(t reflect.Type) (s map[string]interface{}, err error) {
+	var ps object
+	var req []string
+	if err = x.fields(t, &ps, &req); err != nil {
+		return
+	}
+	if ps == nil {
+		ps = object{}
+	}
+	s = map[string]interface{}{"type": "object", "properties": ps, "additionalProperties": false}
+	if len(req) > 0 {
+		s["required"] = req
+	}
+	return
+}
+
+// fields of a struct as properties, the promoted ones are flattened
+func (x *jsonExporter) fields(t reflect.Type, ps *object, req *[]string) (err error) {
+	x.ts.lk.RLock()
+	fr, dv := x.ts.vr[t], x.ts.df[t]
+	x.ts.lk.RUnlock()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if promoted(sf) {
+			et := sf.Type
+			if et.Kind() == reflect.Ptr {
+				et = et.Elem()
+			}
+			if err = x.fields(et, ps, req); err != nil {
+				return
+			}
+			continue
+		}
+		nm, _ := jsonName(sf)
+		if nm == "" {
+			continue
+		}
+		var c *Constraints
+		if i < len(fr) && fr[i].rule != nil {
+			c = fr[i].rule.c
+		}
+		s, err := x.schema(sf.Type, c)
+		if err != nil {
+			return fmt.Errorf("%s: %v", sf.Name, err)
+		}
+		for _, d := range dv {
+			if d.index == i && len(d.value) > 0 {
+				if s["default"], err = x.defaultOf(sf.Type, d.value); err != nil {
+					return fmt.Errorf("%s: %v", sf.Name, err)
+				}
+			}
+		}
+		if c != nil && c.Required {
+			*req = append(*req, nm)
+		}
+		*ps = append(*ps, member{nm, s})
+	}
+	return
+}
+
+// defaultOf a field as the data of JSONMarshal, e.g. member names of enums
+func (x *jsonExporter) defaultOf(t reflect.Type, raw json.RawMessage) (v interface{}, err error) {
+	rv := reflect.New(t)
+	if err = json.Unmarshal(raw, rv.Interface()); err != nil {
+		return
+	}
+	var es FieldErrors
+	v = x.ts.toValue(rv.Elem(), "", &es, true)
+	if len(es) > 0 {
+		return nil, es
+	}
+	return
+}
+
+// keySchema of the property names of a map
+func (x *jsonExporter) keySchema(t reflect.Type, c *Constraints) (s map[string]interface{}) {
+	s = make(map[string]interface{})
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s["pattern"] = intKeyPattern
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		s["pattern"] = uintKeyPattern
+	case reflect.Bool:
+		s["enum"] = []string{"false", "true"}
+	case reflect.Struct:
+		if ec, ok := x.ts.codecOf(t).(*enumCodec); ok {
+			s["enum"] = ec.names
+		}
+	}
+	if c != nil && t.Kind() == reflect.String {
+		constrain(s, t, c)
+	}
+	return
+}
+
+// constrain a schema by the constraints of a field
+func constrain(s map[string]interface{}, t reflect.Type, c *Constraints) {
+	if c == nil {
+		return
+	}
+	if c.Min != nil && !tighter(s["minimum"], *c.Min, false) {
+		s["minimum"] = *c.Min
+	}
+	if c.Max != nil && !tighter(s["maximum"], *c.Max, true) {
+		s["maximum"] = *c.Max
+	}
+	var min, max string
+	switch t.Kind() {
+	case reflect.String:
+		min, max = "minLength", "maxLength"
+	case reflect.Slice, reflect.Array:
+		min, max = "minItems", "maxItems"
+	case reflect.Map:
+		min, max = "minProperties", "maxProperties"
+	}
+	if min != "" && c.MinLen != nil {
+		s[min] = *c.MinLen
+	}
+	if max != "" && c.MaxLen != nil {
+		s[max] = *c.MaxLen
+	}
+	if c.Pattern != "" {
+		s["pattern"] = c.Pattern
+	}
+	if len(c.Enum) > 0 {
+		s["enum"] = c.Enum
+	}
+}
+
+// tighter reports whether the bound b of the width is tighter than v
+func tighter(b interface{}, v float64, max bool) bool {
+	var f float64
+	switch n := b.(type) {
+	case int:
+		f = float64(n)
+	case int64:
+		f = float64(n)
+	case uint64:
+		f = float64(n)
+	default:
+		return false
+	}
+	if max {
+		return f <= v
+	}
+	return f >= v
+}
+
+// nullable schema, also null
+func nullable(s map[string]interface{}) map[string]interface{} {
+	if typ, ok := s["type"].(string); ok && s["enum"] == nil {
+		s["type"] = []string{typ, "null"}
+		return s
+	}
+	if _, ok := s["type"].([]string); ok {
+		return s // nullable already
+	}
+	return map[string]interface{}{"anyOf": []interface{}{s, map[string]interface{}{"type": "null"}}}
+}
+
+// ImportJSONSchema converts a JSON Schema document to Schema definitions in
+// the order for CreateSchema, on a best-effort basis: objects of properties
+// are structs, string enums are enums, oneOf of objects with TypeKey and
+// ValueKey are unions, objects of additionalProperties are maps, arrays of
+// equal minItems and maxItems are fixed arrays, null alternatives are
+// pointers, and integer bounds select the width. The definitions in $defs are
+// named by their keys, and the root by its title or name if it is a struct, an
+// enum or a union. Inline enums and unions are named by the field path, and
+// unsupported schemas like untyped values are errors
+func ImportJSONSchema(data []byte, name string) (ss []Schema, err error) {
+	jd := json.NewDecoder(bytes.NewReader(data))
+	jd.UseNumber()
+	v, err := readOrdered(jd)
+	if err != nil {
+		return
+	}
+	root, ok := v.(object)
+	if !ok {
+		return nil, fmt.Errorf("document is not an object")
+	}
+	x := &jsonImporter{defs: make(map[string]object), done: make(map[string]*Field)}
+	for _, k := range []string{"definitions", "$defs"} {
+		if ds, ok := root.get(k); ok {
+			d, ok := ds.(object)
+			if !ok {
+				return nil, fmt.Errorf("%s is not an object", k)
+			}
+			for _, m := range d {
+				if x.defs["#/"+k+"/"+m.key], ok = m.value.(object); !ok {
+					return nil, fmt.Errorf("%s/%s is not an object", k, m.key)
+				}
+			}
+		}
+	}
+	refs := make([]string, 0, len(x.defs))
+	for r := range x.defs {
+		refs = append(refs, r)
+	}
+	sort.Strings(refs)
+	for _, r := range refs {
+		if _, err = x.ref(r); err != nil {
+			return
+		}
+	}
+	if _, ok = root.get("$ref"); !ok && schemaLike(root) {
+		if t, ok := root.get("title"); ok && name == "" {
+			name, _ = t.(string)
+		}
+		if name == "" {
+			return nil, fmt.Errorf("name of the root schema is empty")
+		}
+		if !ir.MatchString(name) {
+			name = mangle(name)
+		}
+		if _, err = x.define(name, root); err != nil {
+			return
+		}
+	}
+	return x.ss, nil
+}
+
+type jsonImporter struct {
+	defs map[string]object // of refs
+	done map[string]*Field // of refs, nil while an alias is imported
+	ss   []Schema
+}
+
+// ref to a definition, of a schema name, or the type and constraints of an alias
+func (x *jsonImporter) ref(r string) (f Field, err error) {
+	if p, ok := x.done[r]; ok {
+		if p == nil {
+			return f, fmt.Errorf("recursive alias: %s", r)
+		}
+		return *p, nil
+	}
+	d, ok := x.defs[r]
+	if !ok {
+		return f, fmt.Errorf("unknown $ref: %s", r)
+	}
+	nm := r[strings.LastIndexByte(r, '/')+1:]
+	if !ir.MatchString(nm) {
+		nm = mangle(nm)
+	}
+	if schemaLike(d) {
+		x.done[r] = &Field{Type: nm} // referred recursively
+		_, err = x.define(nm, d)
+		return *x.done[r], err
+	}
+	x.done[r] = nil
+	if f, err = x.field(nm, "", d); err != nil {
+		return f, fmt.Errorf("%s: %v", r, err)
+	}
+	if len(f.Fields) > 0 {
+		return f, fmt.Errorf("%s: inline struct alias", r)
+	}
+	f.Default = nil
+	x.done[r] = &f
+	return
+}
+
+// schemaLike reports whether a definition is a struct, an enum or a union
+func schemaLike(d object) bool {
+	if _, ok := d.get("properties"); ok {
+		return true
+	}
+	if _, ok := d.get("allOf"); ok {
+		return true
+	}
+	return len(stringEnum(d)) > 0 || len(unionOf(d)) > 0
+}
+
+// define a named schema after its dependencies, the type string is returned
+func (x *jsonImporter) define(name string, d object) (typ string, err error) {
+	s := Schema{Name: name}
+	if ms := stringEnum(d); len(ms) > 0 {
+		s.Type = "string"
+		for _, m := range ms {
+			s.Members = append(s.Members, Member{Name: m})
+		}
+	} else if us := unionOf(d); len(us) > 0 {
+		for _, ps := range us {
+			tk, _ := ps.get(TypeKey)
+			c, _ := tk.(object).get("const")
+			if c == nil {
+				c = tk.(object).enum()[0]
+			}
+			vn := c.(string)
+			val, _ := ps.get(ValueKey)
+			f, err := x.field(name+mangle(vn), "", val)
+			if err != nil {
+				return "", fmt.Errorf("%s.%s: %v", name, vn, err)
+			}
+			s.Variants = append(s.Variants, Variant{Name: vn, Type: x.named(name+mangle(vn), f)})
+		}
+	} else {
+		if as, ok := d.get("allOf"); ok {
+			a, _ := as.([]interface{})
+			for _, e := range a {
+				o, ok := e.(object)
+				if !ok {
+					return "", fmt.Errorf("%s: invalid allOf", name)
+				}
+				if r, ok := o.get("$ref"); ok {
+					rs, _ := r.(string)
+					b, err := x.ref(rs)
+					if err != nil {
+						return "", fmt.Errorf("%s: %v", name, err)
+					}
+					s.Extends = append(s.Extends, b.Type)
+					continue
+				}
+				fs, err := x.properties(name, o)
+				if err != nil {
+					return "", err
+				}
+				s.Fields = append(s.Fields, fs...)
+			}
+		}
+		fs, err := x.properties(name, d)
+		if err != nil {
+			return "", err
+		}
+		s.Fields = append(s.Fields, fs...)
+	}
+	x.ss = append(x.ss, s)
+	return name, nil
+}
+
+// named type of a field, a struct schema of the name is defined for inline fields
+func (x *jsonImporter) named(name string, f Field) string {
+	if len(f.Fields) == 0 {
+		return f.Type
+	}
+	x.ss = append(x.ss, Schema{Name: name, Fields: f.Fields})
+	return strings.TrimSuffix(f.Type, "struct") + name
+}
+
+// properties of an object as fields, required ones are Required
+func (x *jsonImporter) properties(owner string, d object) (fs []Field, err error) {
+	ps, ok := d.get("properties")
+	if !ok {
+		return
+	}
+	po, ok := ps.(object)
+	if !ok {
+		return nil, fmt.Errorf("%s: properties is not an object", owner)
+	}
+	req := make(map[string]bool)
+	if rs, ok := d.get("required"); ok {
+		a, _ := rs.([]interface{})
+		for _, r := range a {
+			if k, ok := r.(string); ok {
+				req[k] = true
+			}
+		}
+	}
+	for _, p := range po {
+		f, err := x.field(owner, p.key, p.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", owner, p.key, err)
+		}
+		if req[p.key] {
+			if f.Constraints == nil {
+				f.Constraints = &Constraints{}
+			}
+			f.Constraints.Required = true
+		}
+		fs = append(fs, f)
+	}
+	return
+}
+
+// field of a property schema, or of an element if name is empty
+func (x *jsonImporter) field(owner, name string, v interface{}) (f Field, err error) {
+	d, ok := v.(object)
+	if !ok {
+		return f, fmt.Errorf("unsupported schema: %v", v)
+	}
+	f.Name = name
+	if dv, ok := d.get("default"); ok {
+		if f.Default, err = json.Marshal(dv); err != nil {
+			return
+		}
+	}
+	if r, ok := d.get("$ref"); ok {
+		rs, _ := r.(string)
+		rf, err := x.ref(rs)
+		if f.Type = rf.Type; rf.Constraints != nil {
+			c := *rf.Constraints // of the alias, copied to be Required
+			f.Constraints = &c
+		}
+		return f, err
+	}
+	sub := owner + mangle(name)
+	types, null := typesOf(d)
+	for _, k := range []string{"anyOf", "oneOf", "allOf"} {
+		v, ok := d.get(k)
+		if !ok {
+			continue
+		}
+		a, ok := v.([]interface{})
+		if !ok {
+			return f, fmt.Errorf("%s is not an array", k)
+		}
+		if k == "oneOf" && len(unionOf(d)) > 0 {
+			f.Type, err = x.define(sub, d)
+			return
+		}
+		var alts []interface{}
+		for _, e := range a {
+			if o, ok := e.(object); ok {
+				if ts, n := typesOf(o); n && len(ts) == 0 {
+					null = true
+					continue
+				}
+			}
+			alts = append(alts, e)
+		}
+		if len(alts) != 1 {
+			return f, fmt.Errorf("unsupported %s", k)
+		}
+		dv := f.Default
+		if f, err = x.field(owner, name, alts[0]); err != nil {
+			return
+		}
+		if len(dv) > 0 {
+			f.Default = dv
+		}
+		return pointer(f, null), nil
+	}
+	if len(types) == 0 { // inferred by the keywords
+		if _, ok := d.get("properties"); ok {
+			types = []string{"object"}
+		} else if _, ok = d.get("additionalProperties"); ok {
+			types = []string{"object"}
+		} else if _, ok = d.get("items"); ok {
+			types = []string{"array"}
+		} else if len(stringEnum(object{{"type", "string"}, {"enum", d.enum()}})) > 0 {
+			types = []string{"string"}
+		}
+	}
+	if len(types) != 1 {
+		return f, fmt.Errorf("unsupported type: %v", types)
+	}
+	c := &Constraints{}
+	c.Min, c.Max = number(d, "minimum"), number(d, "maximum")
+	switch types[0] {
+	case "boolean":
+		f.Type = "bool"
+	case "integer":
+		f.Type = intWidth(c)
+	case "number":
+		f.Type = "float64"
+	case "string":
+		if ms := stringEnum(d); len(ms) > 0 && name != "" {
+			f.Type, err = x.define(sub, d)
+			return pointer(f, null), err
+		}
+		f.Type = "string"
+		if e, _ := d.get("contentEncoding"); e == "base64" {
+			f.Type = "[]byte"
+			break
+		}
+		c.MinLen, c.MaxLen = length(d, "minLength"), length(d, "maxLength")
+		if p, ok := d.get("pattern"); ok {
+			c.Pattern, _ = p.(string)
+		}
+	case "array":
+		it, _ := d.get("items")
+		ef, err := x.field(sub, "", it)
+		if err != nil {
+			return f, err
+		}
+		c.Elem, f.Fields = ef.Constraints, ef.Fields
+		c.MinLen, c.MaxLen = length(d, "minItems"), length(d, "maxItems")
+		f.Type = "[]" + ef.Type
+		if c.MinLen != nil && c.MaxLen != nil && *c.MinLen == *c.MaxLen && *c.MinLen > 0 {
+			f.Type = "[" + strconv.Itoa(*c.MinLen) + "]" + ef.Type
+			c.MinLen, c.MaxLen = nil, nil
+		}
+		null = false
+	case "object":
+		if ps, ok := d.get("properties"); ok {
+			if po, _ := ps.(object); po != nil {
+				if _, ok = po.get(TypeKey); ok {
+					return f, fmt.Errorf("unsupported interface value")
+				}
+			}
+			if f.Fields, err = x.properties(sub, d); err != nil {
+				return
+			}
+			f.Type = "struct"
+			break
+		}
+		ap, _ := d.get("additionalProperties")
+		ef, err := x.field(sub, "", ap)
+		if err != nil {
+			return f, err
+		}
+		if len(ef.Fields) > 0 {
+			ef.Type = x.named(sub, ef)
+		}
+		key := "string"
+		if pn, ok := d.get("propertyNames"); ok {
+			if p, _ := pn.(object).get("pattern"); p == intKeyPattern {
+				key = "int64"
+			} else if p == uintKeyPattern {
+				key = "uint64"
+			}
+		}
+		c.Elem = ef.Constraints
+		c.MinLen, c.MaxLen = length(d, "minProperties"), length(d, "maxProperties")
+		f.Type = "map[" + key + "]" + ef.Type
+		null = false
+	default:
+		return f, fmt.Errorf("unsupported type: %s", types[0])
+	}
+	if e, ok := d.get("enum"); ok {
+		for _, v := range e.([]interface{}) {
+			raw, err := json.Marshal(v)
+			if err != nil {
+				return f, err
+			}
+			c.Enum = append(c.Enum, raw)
+		}
+	}
+	if !reflect.DeepEqual(c, &Constraints{}) {
+		f.Constraints = c
+	}
+	return pointer(f, null), nil
+}
+
+// pointer to the type of a nullable field, except slices and maps which are nullable
+func pointer(f Field, null bool) Field {
+	if null && !strings.HasPrefix(f.Type, "[]") && !strings.HasPrefix(f.Type, "map[") && !strings.HasPrefix(f.Type, "*") {
+		f.Type = "*" + f.Type
+	}
+	return f
+}
+
+// typesOf a schema, without null
+func typesOf(d object) (ts []string, null bool) {
+	v, _ := d.get("type")
+	var a []interface{}
+	switch t := v.(type) {
+	case string:
+		a = []interface{}{t}
+	case []interface{}:
+		a = t
+	}
+	for _, e := range a {
+		if e == "null" {
+			null = true
+		} else if s, ok := e.(string); ok {
+			ts = append(ts, s)
+		}
+	}
+	return
+}
+
+// stringEnum members of a string schema
+func stringEnum(d object) (ms []string) {
+	if ts, _ := typesOf(d); len(ts) != 1 || ts[0] != "string" {
+		return nil
+	}
+	for _, v := range d.enum() {
+		s, ok := v.(string)
+		if !ok {
+			return nil
+		}
+		ms = append(ms, s)
+	}
+	return
+}
+
+// unionOf the properties of the oneOf alternatives, a TypeKey constant and a ValueKey
+func unionOf(d object) (us []object) {
+	a, ok := d.get("oneOf")
+	if !ok {
+		return
+	}
+	for _, e := range a.([]interface{}) {
+		o, ok := e.(object)
+		if !ok {
+			return nil
+		}
+		if ts, null := typesOf(o); null && len(ts) == 0 {
+			continue
+		}
+		ps, _ := o.get("properties")
+		po, _ := ps.(object)
+		tk, _ := po.get(TypeKey)
+		tko, _ := tk.(object)
+		if _, ok := po.get(ValueKey); !ok || tko == nil {
+			return nil
+		}
+		if c, _ := tko.get("const"); c == nil {
+			if es := tko.enum(); len(es) != 1 {
+				return nil
+			} else if _, ok := es[0].(string); !ok {
+				return nil
+			}
+		} else if _, ok := c.(string); !ok {
+			return nil
+		}
+		us = append(us, po)
+	}
+	return
+}
+
+// intWidth of the bounds, which are kept as constraints unless of the width
+func intWidth(c *Constraints) (typ string) {
+	type width struct {
+		name     string
+		min, max float64
+	}
+	ws := []width{
+		{"int8", -1 << 7, 1<<7 - 1}, {"int16", -1 << 15, 1<<15 - 1}, {"int32", -1 << 31, 1<<31 - 1},
+		{"int64", -1 << 63, 1<<63 - 1},
+	}
+	if c.Min != nil && *c.Min >= 0 {
+		ws = []width{
+			{"uint8", 0, 1<<8 - 1}, {"uint16", 0, 1<<16 - 1}, {"uint32", 0, 1<<32 - 1}, {"uint64", 0, 1<<64 - 1},
+		}
+	}
+	w := ws[len(ws)-1]
+	if c.Min != nil && c.Max != nil {
+		for _, e := range ws {
+			if *c.Min >= e.min && *c.Max <= e.max {
+				w = e
+				break
+			}
+		}
+	}
+	if c.Min != nil && *c.Min == w.min {
+		c.Min = nil
+	}
+	if c.Max != nil && *c.Max == w.max {
+		c.Max = nil
+	}
+	return w.name
+}
+
+// number of a keyword, nil if absent
+func number(d object, k string) *float64 {
+	v, _ := d.get(k)
+	n, ok := v.(json.Number)
+	if !ok {
+		return nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return nil
+	}
+	return &f
+}
+
+// length of a keyword, nil if absent
+func length(d object, k string) *int {
+	if f := number(d, k); f != nil {
+		i := int(*f)
+		return &i
+	}
+	return nil
+}
+
+// get the value of a key
+func (o object) get(k string) (v interface{}, ok bool) {
+	for _, m := range o {
+		if m.key == k {
+			return m.value, true
+		}
+	}
+	return
+}
+
+// enum values of a schema
+func (o object) enum() []interface{} {
+	v, _ := o.get("enum")
+	a, _ := v.([]interface{})
+	return a
+}
+
+// readOrdered reads a JSON value, objects are read as object in order
+func readOrdered(jd *json.Decoder) (v interface{}, err error) {
+	tk, err := jd.Token()
+	if err != nil {
+		return
+	}
+	switch tk {
+	case json.Delim('{'):
+		o := object{}
+		for {
+			k, ok, err := key(jd)
+			if err != nil || !ok {
+				return o, err
+			}
+			e, err := readOrdered(jd)
+			if err != nil {
+				return nil, err
+			}
+			o = append(o, member{k, e})
+		}
+	case json.Delim('['):
+		a := []interface{}{}
+		for jd.More() {
+			e, err := readOrdered(jd)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, e)
+		}
+		_, err = jd.Token()
+		return a, err
+	}
+	return tk, nil
+}
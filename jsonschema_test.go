@@ -0,0 +1,116 @@
+package schema_test
+
+import (
+	"encoding/json"
+	"github.com/fengyoulin/schema"
+	"strings"
+	"testing"
+)
+
+const testJSONSchemaDef = `
+[{"name":"Level","type":"uint8","members":[{"name":"Low"},{"name":"High"}]},
+{"name":"Base","fields":[{"name":"id","type":"uint32","constraints":{"required":true}}]},
+{"name":"Point","fields":[{"name":"X","type":"int16"},{"name":"Y","type":"int16","constraints":{"min":-10,"max":10}}]},
+{"name":"Mark","variants":[{"name":"Point","type":"Point"},{"name":"Label","type":"string"}]},
+{"name":"Doc","extends":["Base"],"fields":[
+{"name":"open_id","type":"string","constraints":{"pattern":"^o"}},
+{"name":"Level","type":"Level","default":"High"},
+{"name":"Score","type":"*float64"},
+{"name":"Tags","type":"[]string","constraints":{"max_len":3}},
+{"name":"Grid","type":"[2][2]int8"},
+{"name":"Counts","type":"map[int32]uint16"},
+{"name":"Data","type":"[]byte"},
+{"name":"Mark","type":"Mark"},
+{"name":"Items","type":"[]*struct","fields":[{"name":"Name","type":"string"},{"name":"Qty","type":"int","default":1}]},
+{"name":"Origin","type":"*Point"}
+]}]
+`
+
+func TestTypes_JSONSchema(t *testing.T) {
+	b, err := newTypes(t, testJSONSchemaDef).JSONSchema("Doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := string(b)
+	for _, s := range []string{
+		`"$ref":"#/$defs/Doc"`,
+		`"$schema":"https://json-schema.org/draft/2020-12/schema"`,
+		`"properties":{"id":{"maximum":4294967295,"minimum":0,"type":"integer"},"open_id":{"pattern":"^o","type":"string"},`,
+		`"required":["id"]`,
+		`"Level":{"$ref":"#/$defs/Level","default":"High"}`,
+		`"Level":{"enum":["Low","High"],"type":"string"}`,
+		`"Score":{"type":["number","null"]}`,
+		`"Tags":{"items":{"type":"string"},"maxItems":3,"type":["array","null"]}`,
+		`"Grid":{"items":{"items":{"maximum":127,"minimum":-128,"type":"integer"},"maxItems":2,"minItems":2,"type":"array"},"maxItems":2,"minItems":2,"type":"array"}`,
+		`"Counts":{"additionalProperties":{"maximum":65535,"minimum":0,"type":"integer"},"propertyNames":{"pattern":"^-?[0-9]+$"},"type":["object","null"]}`,
+		`"Data":{"contentEncoding":"base64","type":["string","null"]}`,
+		`"Y":{"maximum":10,"minimum":-10,"type":"integer"}`,
+		`{"additionalProperties":false,"properties":{"$type":{"const":"Label"},"value":{"type":"string"}},"required":["$type","value"],"type":"object"},{"type":"null"}]`,
+		`"Qty":{"default":1,"maximum":9223372036854775807,"minimum":-9223372036854775808,"type":"integer"}`,
+		`"Origin":{"anyOf":[{"$ref":"#/$defs/Point"},{"type":"null"}]}`,
+	} {
+		if !strings.Contains(doc, s) {
+			t.Errorf("missing %s in:\n%s", s, doc)
+		}
+	}
+	ss, err := schema.ImportJSONSchema(b, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := createTypes(t, ss).JSONSchema("Doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(r) != doc {
+		t.Errorf("imported:\n%s\n!=\n%s", r, doc)
+	}
+	if _, err = newTypes(t, testMapDef, testMapAdded...).JSONSchema("Nothing"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestImportJSONSchema(t *testing.T) {
+	doc := `{"$schema":"http://json-schema.org/draft-07/schema#","title":"order","type":"object",
+"properties":{
+"order_id":{"type":"integer","minimum":0,"maximum":4294967295},
+"status":{"type":"string","enum":["new","paid"]},
+"note":{"type":["string","null"],"maxLength":200},
+"customer":{"$ref":"#/definitions/customer"},
+"lines":{"type":"array","items":{"type":"object","properties":{"sku":{"type":"string"},"qty":{"type":"integer","minimum":1,"maximum":100}},"required":["sku"]}},
+"attrs":{"type":"object","additionalProperties":{"type":"string"}},
+"email":{"$ref":"#/definitions/email"}
+},
+"required":["order_id","email"],
+"definitions":{"customer":{"type":"object","properties":{"name":{"type":"string"}}},"email":{"type":"string","format":"email","pattern":"@"}}}`
+	ss, err := schema.ImportJSONSchema([]byte(doc), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := `[{"name":"Customer","fields":[{"name":"name","type":"string"}]},` +
+		`{"name":"OrderStatus","type":"string","members":[{"name":"new"},{"name":"paid"}]},` +
+		`{"name":"Order","fields":[{"name":"order_id","type":"uint32","constraints":{"required":true}},` +
+		`{"name":"status","type":"OrderStatus"},{"name":"note","type":"*string","constraints":{"max_len":200}},` +
+		`{"name":"customer","type":"Customer"},{"name":"lines","type":"[]struct","fields":[` +
+		`{"name":"sku","type":"string","constraints":{"required":true}},{"name":"qty","type":"uint8","constraints":{"min":1,"max":100}}]},` +
+		`{"name":"attrs","type":"map[string]string"},{"name":"email","type":"string","constraints":{"required":true,"pattern":"@"}}]}]`
+	if string(b) != exp {
+		t.Errorf("%s\n!=\n%s", b, exp)
+	}
+	createTypes(t, ss)
+	for _, doc := range []string{
+		`{"type":"object","properties":{"a":{"type":"string"}}}`,
+		`{"title":"T","type":"object","properties":{"a":{}}}`,
+		`{"title":"T","type":"object","properties":{"a":{"type":"object","properties":{"$type":{"type":"string"},"value":{}}}}}`,
+		`{"title":"T","type":"object","properties":{"a":{"$ref":"#/$defs/b"}}}`,
+		`{"title":"T","type":"object","properties":{"a":{"anyOf":[{"type":"string"},{"type":"integer"}]}}}`,
+		`[]`,
+	} {
+		if _, err = schema.ImportJSONSchema([]byte(doc), ""); err == nil {
+			t.Errorf("%s: expected error", doc)
+		}
+	}
+}
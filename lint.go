@@ -0,0 +1,346 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Rules of Issue
+const (
+	LintDuplicate   = "duplicate"    // names of schemas, fields, members or variants
+	LintJSONName    = "json-name"    // fields of the same json name, ignoring case
+	LintUnused      = "unused"       // schemas not reachable from the roots
+	LintUnknownType = "unknown-type" // types neither defined nor registered
+	LintLargeArray  = "large-array"  // fixed arrays longer than MaxArrayLen
+	LintPointer     = "pointer"      // pointers under DisablePointer
+	LintMapKey      = "map-key"      // keys other than string under StringKeyOnly
+	LintJSON        = "json"         // fields which do not round-trip through encoding/json
+	LintNaming      = "naming"       // names against the Go conventions
+)
+
+// Issue found by a Linter
+type Issue struct {
+	Schema  string
+	Field   string // path of the field, empty for the schema
+	Rule    string
+	Message string
+}
+
+func (i Issue) String() string {
+	p := i.Schema
+	if i.Field != "" {
+		p += "." + i.Field
+	}
+	return p + ": " + i.Message + " (" + i.Rule + ")"
+}
+
+// Linter of schema definitions, before they are created
+type Linter struct {
+	// Types for the options, and the types the schemas refer to, New() if nil
+	Types *Types
+	// Roots are the types used directly, the others must be reachable from them,
+	// by default the schemas no other refers to
+	Roots []string
+	// MaxArrayLen of fixed arrays, 1024 if zero
+	MaxArrayLen int
+}
+
+type linter struct {
+	*Linter
+	defs   map[string]*Schema
+	refs   map[string][]string
+	issues []Issue
+}
+
+var (
+	externalName = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$|^[a-z][A-Za-z0-9]*$`)
+)
+
+// Lint the schemas, the issues are in the order of the schemas
+func (l *Linter) Lint(ss []Schema) []Issue {
+	lt := &linter{Linter: l, defs: make(map[string]*Schema, len(ss)), refs: make(map[string][]string)}
+	if lt.Types == nil {
+		lt.Types = New()
+	}
+	for i := range ss {
+		s := &ss[i]
+		if _, ok := lt.defs[s.Name]; ok {
+			lt.add(s.Name, "", LintDuplicate, "duplicate schema")
+			continue
+		}
+		lt.defs[s.Name] = s
+	}
+	for i := range ss {
+		if lt.defs[ss[i].Name] == &ss[i] {
+			lt.schema(&ss[i])
+		}
+	}
+	lt.reach(ss)
+	return lt.issues
+}
+
+func (lt *linter) add(schema, field, rule, format string, a ...interface{}) {
+	lt.issues = append(lt.issues, Issue{schema, field, rule, fmt.Sprintf(format, a...)})
+}
+
+func (lt *linter) schema(s *Schema) {
+	lt.naming(s.Name, "", s.Name)
+	switch {
+	case len(s.Members) > 0:
+		lt.walk(s.Name, "", s.Type, false)
+		seen := make(map[string]bool, len(s.Members))
+		for _, m := range s.Members {
+			if seen[m.Name] {
+				lt.add(s.Name, m.Name, LintDuplicate, "duplicate member")
+			}
+			seen[m.Name] = true
+			lt.naming(s.Name, m.Name, m.Name)
+		}
+	case len(s.Variants) > 0:
+		seen := make(map[string]bool, len(s.Variants))
+		for _, v := range s.Variants {
+			if seen[v.Name] {
+				lt.add(s.Name, v.Name, LintDuplicate, "duplicate variant")
+			}
+			seen[v.Name] = true
+			lt.naming(s.Name, v.Name, v.Name)
+			lt.walk(s.Name, v.Name, v.Type, false)
+		}
+	default:
+		var fs []Field
+		for _, e := range s.Extends {
+			lt.ref(s.Name, "", e)
+			fs = append(fs, lt.fieldsOf(e, map[string]bool{s.Name: true})...)
+		}
+		lt.fields(s.Name, "", append(fs, s.Fields...), len(fs))
+	}
+}
+
+// fieldsOf a schema to extend, flattened
+func (lt *linter) fieldsOf(name string, seen map[string]bool) (fs []Field) {
+	if seen[name] {
+		return
+	}
+	seen[name] = true
+	s, ok := lt.defs[name]
+	if !ok {
+		if rs, err := lt.Types.SchemaOf(name); err == nil {
+			s = &rs
+		} else {
+			return
+		}
+	}
+	for _, e := range s.Extends {
+		fs = append(fs, lt.fieldsOf(e, seen)...)
+	}
+	return append(fs, s.Fields...)
+}
+
+// fields of a struct, the first inherited ones are only checked for duplicates
+func (lt *linter) fields(schema, prefix string, fs []Field, inherited int) {
+	idents := make(map[string]string, len(fs))
+	jsons := make(map[string]string, len(fs))
+	for i := range fs {
+		f := &fs[i]
+		name := fieldName(f)
+		path := prefix + name
+		ident := f.Ident
+		if ident == "" {
+			ident = name
+			if !ir.MatchString(ident) {
+				ident = mangle(ident)
+			}
+		}
+		if n, ok := idents[ident]; ok {
+			lt.add(schema, path, LintDuplicate, "duplicate field, %s and %s both map to %s", n, name, ident)
+		}
+		idents[ident] = name
+		tag := f.Tags["json"]
+		jn := strings.Split(tag, ",")[0]
+		switch {
+		case tag == "-":
+			if i >= inherited {
+				lt.add(schema, path, LintJSON, "omitted from JSON")
+			}
+		case jn == "" && f.Embedded: // promoted
+		default:
+			if jn == "" {
+				jn = ident
+				if ident != name {
+					jn = name
+				}
+			}
+			// encoding/json matches the names case-insensitively
+			if n, ok := jsons[strings.ToLower(jn)]; ok {
+				lt.add(schema, path, LintJSONName, "json name %s of %s is used by %s", jn, name, n)
+			}
+			jsons[strings.ToLower(jn)] = name
+		}
+		if i < inherited {
+			continue
+		}
+		if ir.MatchString(name) {
+			lt.naming(schema, path, name)
+		} else if !externalName.MatchString(name) {
+			lt.add(schema, path, LintNaming, "name %s is neither MixedCaps nor snake_case", name)
+		}
+		if len(f.Fields) > 0 {
+			lt.fields(schema, path+".", f.Fields, 0)
+			lt.walk(schema, path, strings.TrimSuffix(f.Type, "struct"), true)
+			continue
+		}
+		lt.walk(schema, path, f.Type, false)
+	}
+}
+
+// walk a type definition, inline if the struct is defined by fields
+func (lt *linter) walk(schema, path, typ string, inline bool) {
+	for {
+		switch {
+		case strings.HasPrefix(typ, "[]"):
+			typ = typ[2:]
+		case strings.HasPrefix(typ, "*"):
+			if lt.Types.os.disablePointer {
+				lt.add(schema, path, LintPointer, "pointer %s with DisablePointer", typ)
+			}
+			typ = typ[1:]
+		case strings.HasPrefix(typ, "struct{"):
+			fs, err := parseStruct(typ)
+			if err != nil {
+				lt.add(schema, path, LintUnknownType, "%v", err)
+				return
+			}
+			lt.fields(schema, path+".", fs, 0)
+			return
+		case ar.MatchString(typ):
+			ms := ar.FindStringSubmatch(typ)
+			max := lt.MaxArrayLen
+			if max <= 0 {
+				max = 1024
+			}
+			if n, err := strconv.ParseInt(ms[1], 10, 64); err != nil || n > int64(max) {
+				lt.add(schema, path, LintLargeArray, "array of %s elements, more than %d", ms[1], max)
+			}
+			typ = ms[2]
+		case mr.MatchString(typ):
+			ms := mr.FindStringSubmatch(typ)
+			if k := ms[1]; k != "string" {
+				if lt.Types.os.stringKeyOnly {
+					lt.add(schema, path, LintMapKey, "key %s with StringKeyOnly", k)
+				}
+				switch lt.kindOf(k) {
+				case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+					reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+				default:
+					lt.add(schema, path, LintJSON, "key %s is not supported by encoding/json", k)
+				}
+				lt.ref(schema, path, k)
+			}
+			typ = ms[2]
+		case typ == "" && inline:
+			return
+		default:
+			switch lt.kindOf(typ) {
+			case reflect.Complex64, reflect.Complex128:
+				lt.add(schema, path, LintJSON, "%s is not supported by encoding/json", typ)
+			case reflect.Interface:
+				lt.add(schema, path, LintJSON, "%s is decoded as map[string]interface{} by encoding/json, use JSONUnmarshal", typ)
+			}
+			lt.ref(schema, path, typ)
+			return
+		}
+	}
+}
+
+// kindOf a named type, Struct for the schemas
+func (lt *linter) kindOf(name string) reflect.Kind {
+	if _, ok := lt.defs[name]; ok {
+		return reflect.Struct
+	}
+	if t, ok := lt.Types.TypeByName(name); ok {
+		return t.Kind()
+	}
+	return reflect.Invalid
+}
+
+// ref from a schema to a named type
+func (lt *linter) ref(schema, path, name string) {
+	if _, ok := lt.defs[name]; ok {
+		if name != schema {
+			lt.refs[schema] = append(lt.refs[schema], name)
+		}
+		return
+	}
+	if _, ok := lt.Types.TypeByName(name); !ok {
+		lt.add(schema, path, LintUnknownType, "unknown type: %s", name)
+	}
+}
+
+// reach the schemas from the roots
+func (lt *linter) reach(ss []Schema) {
+	roots := lt.Roots
+	if len(roots) == 0 {
+		used := make(map[string]bool)
+		for _, rs := range lt.refs {
+			for _, r := range rs {
+				used[r] = true
+			}
+		}
+		for _, s := range ss {
+			if !used[s.Name] {
+				roots = append(roots, s.Name)
+			}
+		}
+	}
+	seen := make(map[string]bool, len(ss))
+	var visit func(string)
+	visit = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		for _, r := range lt.refs[name] {
+			visit(r)
+		}
+	}
+	for _, r := range roots {
+		if _, ok := lt.defs[r]; !ok {
+			lt.add(r, "", LintUnknownType, "unknown root")
+		}
+		visit(r)
+	}
+	for _, s := range ss {
+		if !seen[s.Name] {
+			seen[s.Name] = true
+			lt.add(s.Name, "", LintUnused, "not reachable from %s", strings.Join(roots, ", "))
+		}
+	}
+}
+
+// naming of a Go identifier, MixedCaps with initialisms upper case
+func (lt *linter) naming(schema, path, name string) {
+	if !ir.MatchString(name) {
+		lt.add(schema, path, LintNaming, "name %s is not an exported identifier", name)
+		return
+	}
+	want := strings.Replace(name, "_", "", -1)
+	for _, w := range initialisms {
+		mixed := w[:1] + strings.ToLower(w[1:])
+		for i := strings.Index(want, mixed); i >= 0; {
+			if e := i + len(mixed); e == len(want) || want[e] < 'a' || want[e] > 'z' {
+				want = want[:i] + w + want[e:]
+			}
+			n := strings.Index(want[i+1:], mixed)
+			if n < 0 {
+				break
+			}
+			i += 1 + n
+		}
+	}
+	if want != name {
+		lt.add(schema, path, LintNaming, "name %s should be %s", name, want)
+	}
+}
@@ -0,0 +1,67 @@
+package schema_test
+
+import (
+	"github.com/fengyoulin/schema"
+	"strings"
+	"testing"
+)
+
+func TestLinter_Lint(t *testing.T) {
+	ss := []schema.Schema{
+		{Name: "Order", Fields: []schema.Field{
+			{Name: "Id", Type: "uint"},
+			{Name: "open_id", Type: "string"},
+			{Name: "OpenID", Type: "string"},
+			{Name: "Note", Type: "string", Tags: map[string]string{"json": "id"}},
+			{Name: "Secret", Type: "string", Tags: map[string]string{"json": "-"}},
+			{Name: "Lines", Type: "*[]Line"},
+			{Name: "Buf", Type: "[1000000]byte"},
+			{Name: "Index", Type: "map[uint16]Line"},
+			{Name: "Ratio", Type: "complex128"},
+			{Name: "Extra", Type: "Missing"},
+			{Name: "Meta", Type: "struct", Fields: []schema.Field{{Name: "Tag-Name", Type: "string"}}},
+		}},
+		{Name: "Line", Fields: []schema.Field{{Name: "SKU", Type: "string"}}},
+		{Name: "Status", Type: "uint8", Members: []schema.Member{{Name: "New"}, {Name: "New"}}},
+		{Name: "Line"},
+	}
+	issues := (&schema.Linter{Types: schema.New(schema.DisablePointer(), schema.StringKeyOnly()), Roots: []string{"Order"}}).Lint(ss)
+	var lines []string
+	for _, i := range issues {
+		lines = append(lines, i.String())
+	}
+	got := strings.Join(lines, "\n")
+	for _, s := range []string{
+		"Line: duplicate schema (duplicate)",
+		"Order.Id: name Id should be ID (naming)",
+		"Order.OpenID: duplicate field, open_id and OpenID both map to OpenID (duplicate)",
+		"Order.Note: json name id of Note is used by Id (json-name)",
+		"Order.Secret: omitted from JSON (json)",
+		"Order.Lines: pointer *[]Line with DisablePointer (pointer)",
+		"Order.Buf: array of 1000000 elements, more than 1024 (large-array)",
+		"Order.Index: key uint16 with StringKeyOnly (map-key)",
+		"Order.Ratio: complex128 is not supported by encoding/json (json)",
+		"Order.Extra: unknown type: Missing (unknown-type)",
+		"Order.Meta.Tag-Name: name Tag-Name is neither MixedCaps nor snake_case (naming)",
+		"Status.New: duplicate member (duplicate)",
+		"Status: not reachable from Order (unused)",
+	} {
+		if !strings.Contains(got, s) {
+			t.Errorf("missing %q in:\n%s", s, got)
+		}
+	}
+	if strings.Contains(got, "Line: not reachable") || strings.Contains(got, "open_id: name") {
+		t.Errorf("unexpected issues:\n%s", got)
+	}
+	if issues = (&schema.Linter{Roots: []string{"Order", "Status"}}).Lint(ss[:3]); len(issues) == 0 {
+		t.Error("expected issues")
+	}
+	for _, i := range issues {
+		if i.Rule == schema.LintUnused || i.Rule == schema.LintPointer || i.Rule == schema.LintMapKey {
+			t.Errorf("unexpected issue: %v", i)
+		}
+	}
+	if issues = (&schema.Linter{}).Lint([]schema.Schema{{Name: "Line", Fields: []schema.Field{{Name: "SKU", Type: "string"}}}}); len(issues) != 0 {
+		t.Errorf("unexpected issues: %v", issues)
+	}
+}
@@ -0,0 +1,457 @@
+package schema
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Keys of the object for an interface or union value in maps and JSON
+const (
+	TypeKey  = "$type"
+	ValueKey = "value"
+)
+
+var (
+	jsonMarshaler   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// FromMap creates a value of the named type from a generic document, as decoded by encoding/json,
+// keys are the json names of fields, and interface or union values are objects of TypeKey and ValueKey,
+// errors are returned as FieldErrors
+func FromMap(ts *Types, name string, m map[string]interface{}) (v interface{}, err error) {
+	rv, err := ts.NewValue(name)
+	if err != nil {
+		return
+	}
+	var es FieldErrors
+	ts.fromValue(rv.Elem(), m, "", &es)
+	if len(es) > 0 {
+		return nil, es
+	}
+	return rv.Interface(), nil
+}
+
+// ToMap converts a struct value of Types to a generic document, the reverse of FromMap,
+// values of types implementing json.Marshaler are kept
+func ToMap(ts *Types, v interface{}) (m map[string]interface{}, err error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%T is not struct", v)
+	}
+	var es FieldErrors
+	r := ts.toValue(rv, "", &es, false)
+	if len(es) > 0 {
+		return nil, es
+	}
+	if m, _ = r.(map[string]interface{}); m == nil {
+		return nil, fmt.Errorf("%T is not converted to map", v)
+	}
+	return
+}
+
+// jsonName of a struct field, empty if skipped
+func jsonName(sf reflect.StructField) (name string, omitEmpty bool) {
+	tag, ok := sf.Tag.Lookup("json")
+	if tag == "-" || sf.PkgPath != "" {
+		return "", false
+	}
+	name = sf.Name
+	if ok {
+		opts := strings.Split(tag, ",")
+		if opts[0] != "" {
+			name = opts[0]
+		}
+		for _, o := range opts[1:] {
+			omitEmpty = omitEmpty || o == "omitempty"
+		}
+	}
+	return
+}
+
+// promoted reports whether the fields of an embedded field are promoted in JSON
+func promoted(sf reflect.StructField) bool {
+	if !sf.Anonymous {
+		return false
+	}
+	t := sf.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	tag := sf.Tag.Get("json")
+	return t.Kind() == reflect.Struct && (tag == "" || tag[0] == ',')
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func (ts *Types) fromValue(dst reflect.Value, src interface{}, path string, es *FieldErrors) {
+	fail := func(format string, a ...interface{}) {
+		*es = append(*es, FieldError{path, fmt.Sprintf(format, a...)})
+	}
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return
+	}
+	t := dst.Type()
+	if reflect.PtrTo(t).Implements(jsonUnmarshaler) {
+		b, err := json.Marshal(src)
+		if err == nil {
+			err = json.Unmarshal(b, dst.Addr().Interface())
+		}
+		if err != nil {
+			fail("%v", err)
+		}
+		return
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		e := reflect.New(t.Elem())
+		n := len(*es)
+		ts.fromValue(e.Elem(), src, path, es)
+		if len(*es) == n {
+			dst.Set(e)
+		}
+		return
+	case reflect.Interface:
+		tp, val, err := ts.typedValue(src, ts.CreateType)
+		if err != nil {
+			fail("%v", err)
+			return
+		}
+		e := reflect.New(tp).Elem()
+		ts.fromValue(e, val, joinPath(path, ValueKey), es)
+		dst.Set(e)
+		return
+	case reflect.Struct:
+		switch c := ts.codecOf(t).(type) {
+		case *enumCodec:
+			if s, ok := src.(string); ok {
+				if err := ts.SetMember(dst, s); err != nil {
+					fail("%v", err)
+				}
+				return
+			}
+		case *unionCodec:
+			var nm string
+			tp, val, err := ts.typedValue(src, func(n string) (reflect.Type, error) {
+				for i, v := range c.names {
+					if v == n {
+						nm = n
+						return c.types[i], nil
+					}
+				}
+				return nil, fmt.Errorf("unknown variant of union %s: %s", c.name, n)
+			})
+			if err != nil {
+				fail("%v", err)
+				return
+			}
+			e := reflect.New(tp).Elem()
+			ts.fromValue(e, val, joinPath(path, ValueKey), es)
+			dst.Field(0).SetString(nm)
+			dst.Field(1).Set(e)
+			return
+		default:
+			m, ok := src.(map[string]interface{})
+			if !ok {
+				break
+			}
+			seen := make(map[string]bool, len(m))
+			ts.fromFields(dst, m, path, seen, es)
+			for k := range m {
+				if !seen[k] {
+					*es = append(*es, FieldError{joinPath(path, k), "unknown field"})
+				}
+			}
+			return
+		}
+	case reflect.Slice:
+		if s, ok := src.(string); ok && t.Elem().Kind() == reflect.Uint8 {
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				fail("%v", err)
+				return
+			}
+			dst.SetBytes(b)
+			return
+		}
+		a, ok := src.([]interface{})
+		if !ok {
+			break
+		}
+		dst.Set(reflect.MakeSlice(t, len(a), len(a)))
+		for i, e := range a {
+			ts.fromValue(dst.Index(i), e, fmt.Sprintf("%s[%d]", path, i), es)
+		}
+		return
+	case reflect.Array:
+		a, ok := src.([]interface{})
+		if !ok {
+			break
+		}
+		if len(a) > dst.Len() {
+			fail("%d elements overflow %s", len(a), t)
+			return
+		}
+		for i, e := range a {
+			ts.fromValue(dst.Index(i), e, fmt.Sprintf("%s[%d]", path, i), es)
+		}
+		return
+	case reflect.Map:
+		m, ok := src.(map[string]interface{})
+		if !ok {
+			break
+		}
+		dst.Set(reflect.MakeMapWithSize(t, len(m)))
+		for ks, e := range m {
+			p := fmt.Sprintf("%s[%q]", path, ks)
+			k, err := ts.parseKey(strconv.Quote(ks), t.Key())
+			if err != nil {
+				*es = append(*es, FieldError{p, err.Error()})
+				continue
+			}
+			v := reflect.New(t.Elem()).Elem()
+			ts.fromValue(v, e, p, es)
+			dst.SetMapIndex(k, v)
+		}
+		return
+	}
+	sv := reflect.ValueOf(src)
+	if n, ok := src.(json.Number); ok {
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i, err := n.Int64()
+			if err != nil {
+				fail("%v", err)
+				return
+			}
+			sv = reflect.ValueOf(i)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			u, err := strconv.ParseUint(string(n), 10, 64)
+			if err != nil {
+				fail("%v", err)
+				return
+			}
+			sv = reflect.ValueOf(u)
+		default:
+			f, err := n.Float64()
+			if err != nil {
+				fail("%v", err)
+				return
+			}
+			sv = reflect.ValueOf(f)
+		}
+	}
+	if err := ts.convert(dst, sv); err != nil {
+		fail("%v", err)
+	}
+}
+
+// fromFields of a struct, with fields of embedded structs promoted
+func (ts *Types) fromFields(dst reflect.Value, m map[string]interface{}, path string, seen map[string]bool, es *FieldErrors) {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if promoted(sf) {
+			fv := dst.Field(i)
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					fv.Set(reflect.New(sf.Type.Elem()))
+				}
+				fv = fv.Elem()
+			}
+			ts.fromFields(fv, m, path, seen, es)
+			continue
+		}
+		nm, _ := jsonName(sf)
+		if nm == "" {
+			continue
+		}
+		if e, ok := m[nm]; ok {
+			seen[nm] = true
+			ts.fromValue(dst.Field(i), e, joinPath(path, nm), es)
+		}
+	}
+}
+
+// typedValue of an object of TypeKey and ValueKey
+func (ts *Types) typedValue(src interface{}, typeOf func(string) (reflect.Type, error)) (t reflect.Type, val interface{}, err error) {
+	m, ok := src.(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("%T is not object of %s", src, TypeKey)
+	}
+	nm, ok := m[TypeKey].(string)
+	if !ok {
+		return nil, nil, fmt.Errorf("missing %s", TypeKey)
+	}
+	for k := range m {
+		if k != TypeKey && k != ValueKey {
+			return nil, nil, fmt.Errorf("unknown key of typed value: %s", k)
+		}
+	}
+	if t, err = typeOf(nm); err != nil {
+		return
+	}
+	return t, m[ValueKey], nil
+}
+
+// toValue of a generic document, structs are objects in field order if ordered
+func (ts *Types) toValue(rv reflect.Value, path string, es *FieldErrors, ordered bool) interface{} {
+	fail := func(format string, a ...interface{}) interface{} {
+		*es = append(*es, FieldError{path, fmt.Sprintf(format, a...)})
+		return nil
+	}
+	t := rv.Type()
+	if t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface && t.Implements(jsonMarshaler) {
+		return rv.Interface()
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil
+		}
+		return ts.toValue(rv.Elem(), path, es, ordered)
+	case reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		nm, err := ts.TypeString(rv.Elem().Type())
+		if err != nil {
+			return fail("%v", err)
+		}
+		return map[string]interface{}{TypeKey: nm, ValueKey: ts.toValue(rv.Elem(), joinPath(path, ValueKey), es, ordered)}
+	case reflect.Struct:
+		switch c := ts.codecOf(t).(type) {
+		case *enumCodec:
+			nm, ok := ts.Member(rv)
+			if !ok {
+				return fail("invalid value of enum %s: %v", c.name, rv.Field(0).Interface())
+			}
+			return nm
+		case *unionCodec:
+			i, err := c.variant(rv)
+			if err != nil {
+				return fail("%v", err)
+			}
+			if i < 0 {
+				return nil
+			}
+			return map[string]interface{}{TypeKey: c.names[i], ValueKey: ts.toValue(rv.Field(1).Elem(), joinPath(path, ValueKey), es, ordered)}
+		}
+		if ordered {
+			var o object
+			ts.toFields(rv, path, es, ordered, func(k string, v interface{}) { o = append(o, member{k, v}) })
+			return o
+		}
+		m := make(map[string]interface{}, t.NumField())
+		ts.toFields(rv, path, es, ordered, func(k string, v interface{}) { m[k] = v })
+		return m
+	case reflect.Slice:
+		if rv.IsNil() {
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			return rv.Bytes()
+		}
+		fallthrough
+	case reflect.Array:
+		a := make([]interface{}, rv.Len())
+		for i := range a {
+			a[i] = ts.toValue(rv.Index(i), fmt.Sprintf("%s[%d]", path, i), es, ordered)
+		}
+		return a
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil
+		}
+		m := make(map[string]interface{}, rv.Len())
+		it := rv.MapRange()
+		for it.Next() {
+			k, err := ts.keyString(it.Key())
+			if err != nil {
+				fail("%v", err)
+				continue
+			}
+			m[k] = ts.toValue(it.Value(), fmt.Sprintf("%s[%q]", path, k), es, ordered)
+		}
+		return m
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return fail("unexpected kind: %v", t.Kind())
+	}
+	return rv.Interface()
+}
+
+// toFields of a struct, with fields of embedded structs promoted
+func (ts *Types) toFields(rv reflect.Value, path string, es *FieldErrors, ordered bool, add func(string, interface{})) {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := rv.Field(i)
+		if promoted(sf) {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			ts.toFields(fv, path, es, ordered, add)
+			continue
+		}
+		nm, omitEmpty := jsonName(sf)
+		if nm == "" || omitEmpty && isEmpty(fv) {
+			continue
+		}
+		add(nm, ts.toValue(fv, joinPath(path, nm), es, ordered))
+	}
+}
+
+// keyString of a map key, as encoding/json does for basic kinds, and member names for enums
+func (ts *Types) keyString(k reflect.Value) (string, error) {
+	switch k.Kind() {
+	case reflect.String:
+		return k.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(k.Float(), 'g', -1, k.Type().Bits()), nil
+	case reflect.Bool:
+		return strconv.FormatBool(k.Bool()), nil
+	}
+	if nm, ok := ts.Member(k); ok {
+		return nm, nil
+	}
+	return "", fmt.Errorf("unsupported key type: %s", k.Type())
+}
+
+// isEmpty as omitempty of encoding/json
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
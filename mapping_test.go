@@ -0,0 +1,120 @@
+package schema_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/fengyoulin/schema"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+const testMapDef = `
+[{"name":"Color","type":"uint8","members":[{"name":"Red"},{"name":"Blue"}]},
+{"name":"Point","fields":[
+{"name":"X","type":"int16","tags":{"json":"x"}},
+{"name":"Y","type":"int16","tags":{"json":"y,omitempty"}}
+]},
+{"name":"Shape","variants":[{"name":"Point","type":"Point"},{"name":"Label","type":"string"}]},
+{"name":"Canvas","fields":[
+{"name":"Title","type":"string","tags":{"json":"title"}},
+{"name":"Secret","type":"string","tags":{"json":"-"}},
+{"name":"Color","type":"Color","tags":{"json":"color"}},
+{"name":"Origin","type":"*Point","tags":{"json":"origin,omitempty"}},
+{"name":"Points","type":"[]Point","tags":{"json":"points"}},
+{"name":"Scale","type":"map[uint8]float32","tags":{"json":"scale"}},
+{"name":"Data","type":"[]byte","tags":{"json":"data"}},
+{"name":"Any","type":"Any","tags":{"json":"any"}},
+{"name":"Shape","type":"Shape","tags":{"json":"shape"}},
+{"name":"At","type":"Time","tags":{"json":"at"}}
+]}]
+`
+
+type Any interface{}
+
+// testMapAdded of Go types used by testMapDef
+var testMapAdded = []reflect.Type{reflect.TypeOf(time.Time{}), reflect.TypeOf((*Any)(nil)).Elem()}
+
+func TestFromMap(t *testing.T) {
+	ts := newTypes(t, testMapDef, testMapAdded...)
+	doc := `{"title":"t","color":"Blue","origin":{"x":1},"points":[{"x":2,"y":3}],
+"scale":{"7":1.5},"data":"AQI=","any":{"$type":"Point","value":{"x":4}},
+"shape":{"$type":"Label","value":"s"},"at":"2020-01-02T03:04:05Z"}`
+	d := json.NewDecoder(bytes.NewReader([]byte(doc)))
+	d.UseNumber()
+	var m map[string]interface{}
+	if err := d.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	v, err := schema.FromMap(ts, "Canvas", m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := ts.Wrap(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, exp := range map[string]string{"Title": "t", "Color": "Blue", "Shape.Value": "s"} {
+		if s, err := r.String(p); err != nil || s != exp {
+			t.Errorf("%s: %q != %q, error: %v", p, s, exp, err)
+		}
+	}
+	for p, exp := range map[string]int64{"Origin.X": 1, "Points[0].Y": 3, "Any.X": 4, "Data[1]": 2} {
+		if i, err := r.Int(p); err != nil || i != exp {
+			t.Errorf("%s: %d != %d, error: %v", p, i, exp, err)
+		}
+	}
+	if f, err := r.Float("Scale[7]"); err != nil || f != 1.5 {
+		t.Errorf("Scale[7]: %v != 1.5, error: %v", f, err)
+	}
+	back, err := schema.ToMap(ts, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b1, _ := json.Marshal(back)
+	m2 := make(map[string]interface{})
+	if err = json.Unmarshal(b1, &m2); err != nil {
+		t.Fatal(err)
+	}
+	v2, err := schema.FromMap(ts, "Canvas", m2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, v2) {
+		t.Errorf("round trip mismatch: %s", b1)
+	}
+	if _, ok := back["origin"]; !ok {
+		t.Error("missing origin")
+	}
+	if o := back["origin"].(map[string]interface{}); len(o) != 1 {
+		t.Errorf("omitempty not respected: %v", o)
+	}
+}
+
+func TestFromMap_Errors(t *testing.T) {
+	ts := newTypes(t, testMapDef, testMapAdded...)
+	m := map[string]interface{}{
+		"title":  1,
+		"color":  "Green",
+		"points": []interface{}{map[string]interface{}{"x": 40000}, map[string]interface{}{"y": 1.5}},
+		"scale":  map[string]interface{}{"300": 1},
+		"any":    map[string]interface{}{"value": 1},
+		"shape":  map[string]interface{}{"$type": "Circle"},
+		"Secret": "s",
+	}
+	_, err := schema.FromMap(ts, "Canvas", m)
+	es, ok := err.(schema.FieldErrors)
+	if !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var paths []string
+	for _, e := range es {
+		paths = append(paths, e.Path)
+	}
+	sort.Strings(paths)
+	exp := []string{"Secret", "any", "color", "points[0].x", "points[1].y", `scale["300"]`, "shape", "title"}
+	if !reflect.DeepEqual(paths, exp) {
+		t.Errorf("unexpected errors: %v", es)
+	}
+}
@@ -0,0 +1,438 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	marshalerType   = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	byteType        = reflect.TypeOf(byte(0))
+)
+
+// GenerateMethods of Go struct types of a package, MarshalSchema and
+// UnmarshalSchema by their fields, or as the enums and unions they are
+// registered for in Types
+func (g *Generator) GenerateMethods(w io.Writer, types ...reflect.Type) (err error) {
+	gn := g.generator()
+	if gn.Types == nil {
+		gn.Types = New()
+	}
+	for _, t := range types {
+		if t.Kind() != reflect.Struct || t.Name() == "" {
+			return fmt.Errorf("not a named struct type: %s", t)
+		}
+		if gn.pkgPath == "" {
+			gn.pkgPath = t.PkgPath()
+		} else if t.PkgPath() != gn.pkgPath {
+			return fmt.Errorf("%s is not in package %s", t, gn.pkgPath)
+		}
+		gn.local[t] = t.Name()
+	}
+	gn.Types.lk.RLock()
+	defer gn.Types.lk.RUnlock()
+	var ms []string
+	for _, t := range types {
+		m, err := gn.methods(t.Name(), t)
+		if err != nil {
+			return fmt.Errorf("%s: %v", t.Name(), err)
+		}
+		ms = append(ms, m)
+	}
+	gn.header()
+	for _, m := range ms {
+		gn.buf.WriteString("\n" + m)
+	}
+	return gn.write(w)
+}
+
+// callable methods of a type, generated or implemented
+func (gn *generator) callable(t reflect.Type) bool {
+	if _, ok := gn.local[t]; ok {
+		return true
+	}
+	pt := reflect.PtrTo(t)
+	return t.Name() != "" && pt.Implements(marshalerType) && pt.Implements(unmarshalerType)
+}
+
+// methods of a named type, t is the underlying type
+func (gn *generator) methods(name string, t reflect.Type) (string, error) {
+	gn.use(selfPath)
+	me, md := &strings.Builder{}, &strings.Builder{}
+	fmt.Fprintf(me, "// MarshalSchema as Encoder\nfunc (v *%s) MarshalSchema(e *schema.Encoder) error {\n", name)
+	fmt.Fprintf(md, "// UnmarshalSchema as Decoder\nfunc (v *%s) UnmarshalSchema(d *schema.Decoder) error {\n", name)
+	switch c := gn.Types.cd[t].(type) {
+	case *enumCodec:
+		gn.use("fmt")
+		me.WriteString("switch v.Value {\n")
+		md.WriteString("u, err := d.DecodeUint()\nif err != nil {\nreturn err\n}\nswitch u {\n")
+		for i, v := range c.values {
+			lit := fmt.Sprint(v.Interface())
+			if v.Kind() == reflect.String {
+				lit = strconv.Quote(v.String())
+			}
+			fmt.Fprintf(me, "case %s:\nreturn e.EncodeUint(%d)\n", lit, i)
+			fmt.Fprintf(md, "case %d:\nv.Value = %s\n", i, lit)
+		}
+		if _, ok := c.index[reflect.Zero(t.Field(0).Type).Interface()]; !ok {
+			zero := "0"
+			if t.Field(0).Type.Kind() == reflect.String {
+				zero = `""`
+			}
+			fmt.Fprintf(me, "case %s:\nreturn e.EncodeUint(0)\n", zero)
+		}
+		fmt.Fprintf(me, "}\nreturn fmt.Errorf(\"invalid value of enum %s: %%v\", v.Value)\n}\n", c.name)
+		fmt.Fprintf(md, "default:\nreturn fmt.Errorf(\"ordinal %%d out of range of enum: %s\", u)\n}\nreturn nil\n}\n", c.name)
+	case *unionCodec:
+		if err := gn.union(me, md, name, c); err != nil {
+			return "", err
+		}
+	default:
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if err := gn.encode(me, "v."+sf.Name, sf.Type, 0); err != nil {
+				return "", err
+			}
+			if err := gn.decode(md, "v."+sf.Name, sf.Type, 0); err != nil {
+				return "", err
+			}
+		}
+		me.WriteString("return nil\n}\n")
+		md.WriteString("return nil\n}\n")
+	}
+	return me.String() + "\n" + md.String(), nil
+}
+
+// union methods, the variant is found by the type of the value if its name is empty
+func (gn *generator) union(me, md *strings.Builder, name string, c *unionCodec) (err error) {
+	gn.use("fmt")
+	cs := &strings.Builder{}
+	seen := make(map[reflect.Type]bool)
+	used := false
+	for i, vt := range c.types {
+		if vt.Kind() == reflect.Interface {
+			return fmt.Errorf("interface type of variant %s.%s", c.name, c.names[i])
+		}
+		if seen[vt] {
+			continue
+		}
+		seen[vt] = true
+		typ := gn.goType(vt)
+		dup := false
+		for _, o := range c.types[i+1:] {
+			dup = dup || o == vt
+		}
+		if dup {
+			fmt.Fprintf(cs, "case %s:\nreturn fmt.Errorf(\"ambiguous variant of union %s: %s\")\n", typ, c.name, vt)
+			continue
+		}
+		used = true
+		fmt.Fprintf(cs, "case %s:\nif err := e.EncodeUint(%d); err != nil {\nreturn err\n}\n", typ, i+1)
+		if err = gn.encode(cs, "val", vt, 1); err != nil {
+			return
+		}
+		cs.WriteString("return nil\n")
+	}
+	me.WriteString("switch v.Variant {\ncase \"\":\n")
+	if used {
+		me.WriteString("switch val := v.Value.(type) {\n")
+	} else {
+		me.WriteString("switch v.Value.(type) {\n")
+	}
+	fmt.Fprintf(me, "case nil:\nreturn e.EncodeUint(0)\n%s}\nreturn fmt.Errorf(\"invalid type of union %s: %%T\", v.Value)\n", cs, c.name)
+	md.WriteString("u, err := d.DecodeUint()\nif err != nil {\nreturn err\n}\nswitch u {\ncase 0:\n")
+	fmt.Fprintf(md, "*v = %s{}\n", name)
+	for i, vt := range c.types {
+		typ := gn.goType(vt)
+		fmt.Fprintf(me, "case %q:\nval, ok := v.Value.(%s)\nif !ok {\nreturn fmt.Errorf(\"invalid value of variant %s.%s\")\n}\n", c.names[i], typ, c.name, c.names[i])
+		fmt.Fprintf(me, "if err := e.EncodeUint(%d); err != nil {\nreturn err\n}\n", i+1)
+		if err = gn.encode(me, "val", vt, 1); err != nil {
+			return
+		}
+		me.WriteString("return nil\n")
+		fmt.Fprintf(md, "case %d:\nvar val %s\n", i+1, typ)
+		if err = gn.decode(md, "val", vt, 1); err != nil {
+			return
+		}
+		fmt.Fprintf(md, "v.Variant, v.Value = %q, val\n", c.names[i])
+	}
+	fmt.Fprintf(me, "}\nreturn fmt.Errorf(\"unknown variant of union %s: %%s\", v.Variant)\n}\n", c.name)
+	fmt.Fprintf(md, "default:\nreturn fmt.Errorf(\"variant %%d out of range of union: %s\", u-1)\n}\nreturn nil\n}\n", c.name)
+	return
+}
+
+// convert expr of t to the basic type, if t is not
+func convert(basic string, t reflect.Type, expr string) string {
+	if t.Name() == basic && t.PkgPath() == "" {
+		return expr
+	}
+	return basic + "(" + expr + ")"
+}
+
+// encode statements of expr of type t, depth names the variables of loops
+func (gn *generator) encode(b *strings.Builder, expr string, t reflect.Type, depth int) (err error) {
+	check := func(call string) {
+		fmt.Fprintf(b, "if err := %s; err != nil {\nreturn err\n}\n", call)
+	}
+	if gn.callable(t) {
+		check(expr + ".MarshalSchema(e)")
+		return
+	}
+	d := strconv.Itoa(depth)
+	switch t.Kind() {
+	case reflect.Bool:
+		check("e.EncodeBool(" + convert("bool", t, expr) + ")")
+	case reflect.Int8:
+		check("e.EncodeInt8(" + convert("int8", t, expr) + ")")
+	case reflect.Uint8:
+		check("e.EncodeUint8(" + convert("uint8", t, expr) + ")")
+	case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64:
+		check("e.EncodeInt(" + convert("int64", t, expr) + ")")
+	case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		check("e.EncodeUint(" + convert("uint64", t, expr) + ")")
+	case reflect.Float32:
+		check("e.EncodeFloat32(" + convert("float32", t, expr) + ")")
+	case reflect.Float64:
+		check("e.EncodeFloat64(" + convert("float64", t, expr) + ")")
+	case reflect.Complex64:
+		check("e.EncodeComplex64(" + convert("complex64", t, expr) + ")")
+	case reflect.Complex128:
+		check("e.EncodeComplex128(" + convert("complex128", t, expr) + ")")
+	case reflect.String:
+		check("e.EncodeString(" + convert("string", t, expr) + ")")
+	case reflect.Slice:
+		if t.Elem() == byteType {
+			if t.Name() != "" {
+				expr = "[]byte(" + expr + ")"
+			}
+			check("e.EncodeBytes(" + expr + ")")
+			return
+		}
+		check("e.EncodeInt(int64(len(" + expr + ")))")
+		fmt.Fprintf(b, "for i%s := range %s {\n", d, expr)
+		if err = gn.encode(b, expr+"[i"+d+"]", t.Elem(), depth+1); err != nil {
+			return
+		}
+		b.WriteString("}\n")
+	case reflect.Array:
+		fmt.Fprintf(b, "for i%s := range %s {\n", d, expr)
+		if err = gn.encode(b, expr+"[i"+d+"]", t.Elem(), depth+1); err != nil {
+			return
+		}
+		b.WriteString("}\n")
+	case reflect.Map:
+		check("e.EncodeInt(int64(len(" + expr + ")))")
+		fmt.Fprintf(b, "for k%s, v%s := range %s {\n", d, d, expr)
+		if err = gn.encode(b, "k"+d, t.Key(), depth+1); err != nil {
+			return
+		}
+		if err = gn.encode(b, "v"+d, t.Elem(), depth+1); err != nil {
+			return
+		}
+		b.WriteString("}\n")
+	case reflect.Ptr:
+		check("e.EncodeBool(" + expr + " != nil)")
+		fmt.Fprintf(b, "if %s != nil {\n", expr)
+		if err = gn.encode(b, "(*"+expr+")", t.Elem(), depth); err != nil {
+			return
+		}
+		b.WriteString("}\n")
+	case reflect.Struct:
+		if t.Name() == "" {
+			for i := 0; i < t.NumField(); i++ {
+				if err = gn.encode(b, expr+"."+t.Field(i).Name, t.Field(i).Type, depth); err != nil {
+					return
+				}
+			}
+			return
+		}
+		fallthrough
+	case reflect.Interface:
+		gn.use("reflect")
+		check("e.InternalEncode(reflect.ValueOf(&" + expr + ").Elem())")
+	default:
+		return fmt.Errorf("unexpected kind: %v", t.Kind())
+	}
+	return
+}
+
+// decode statements of expr of type t, as Decoder leaves expr unchanged for
+// an empty string, slice or map
+func (gn *generator) decode(b *strings.Builder, expr string, t reflect.Type, depth int) (err error) {
+	check := func(call string) {
+		fmt.Fprintf(b, "if err := %s; err != nil {\nreturn err\n}\n", call)
+	}
+	scalar := func(fn, basic string) {
+		fmt.Fprintf(b, "if x, err := d.%s(); err != nil {\nreturn err\n} else {\n%s = ", fn, expr)
+		if t.Name() == basic && t.PkgPath() == "" {
+			b.WriteString("x\n}\n")
+		} else {
+			b.WriteString(gn.goType(t) + "(x)\n}\n")
+		}
+	}
+	if gn.callable(t) {
+		check(expr + ".UnmarshalSchema(d)")
+		return
+	}
+	d := strconv.Itoa(depth)
+	switch t.Kind() {
+	case reflect.Bool:
+		scalar("DecodeBool", "bool")
+	case reflect.Int8:
+		scalar("DecodeInt8", "int8")
+	case reflect.Uint8:
+		scalar("DecodeUint8", "uint8")
+	case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64:
+		scalar("DecodeInt", "int64")
+	case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		scalar("DecodeUint", "uint64")
+	case reflect.Float32:
+		scalar("DecodeFloat32", "float32")
+	case reflect.Float64:
+		scalar("DecodeFloat64", "float64")
+	case reflect.Complex64:
+		scalar("DecodeComplex64", "complex64")
+	case reflect.Complex128:
+		scalar("DecodeComplex128", "complex128")
+	case reflect.String:
+		fmt.Fprintf(b, "if x, err := d.DecodeString(); err != nil {\nreturn err\n} else if x != \"\" {\n%s = ", expr)
+		if t.Name() == "string" && t.PkgPath() == "" {
+			b.WriteString("x\n}\n")
+		} else {
+			b.WriteString(gn.goType(t) + "(x)\n}\n")
+		}
+	case reflect.Slice:
+		typ := gn.goType(t)
+		if t.Elem() == byteType {
+			fmt.Fprintf(b, "if x, err := d.DecodeBytes(); err != nil {\nreturn err\n} else if len(x) > 0 {\n%s = ", expr)
+			if t.Name() == "" {
+				b.WriteString("x\n}\n")
+			} else {
+				b.WriteString(typ + "(x)\n}\n")
+			}
+			return
+		}
+		fmt.Fprintf(b, "if n%s, err := d.DecodeInt(); err != nil {\nreturn err\n} else if n%s > 0 {\n", d, d)
+		fmt.Fprintf(b, "if cap(%s) < int(n%s) {\n%s = make(%s, n%s)\n} else {\n%s = %s[:n%s]\n}\n", expr, d, expr, typ, d, expr, expr, d)
+		fmt.Fprintf(b, "for i%s := range %s {\n", d, expr)
+		if err = gn.decode(b, expr+"[i"+d+"]", t.Elem(), depth+1); err != nil {
+			return
+		}
+		b.WriteString("}\n}\n")
+	case reflect.Array:
+		fmt.Fprintf(b, "for i%s := range %s {\n", d, expr)
+		if err = gn.decode(b, expr+"[i"+d+"]", t.Elem(), depth+1); err != nil {
+			return
+		}
+		b.WriteString("}\n")
+	case reflect.Map:
+		fmt.Fprintf(b, "if n%s, err := d.DecodeInt(); err != nil {\nreturn err\n} else if n%s > 0 {\n", d, d)
+		fmt.Fprintf(b, "if %s == nil {\n%s = make(%s, n%s)\n}\n", expr, expr, gn.goType(t), d)
+		fmt.Fprintf(b, "for i%s := int64(0); i%s < n%s; i%s++ {\nvar k%s %s\nvar v%s %s\n", d, d, d, d, d, gn.goType(t.Key()), d, gn.goType(t.Elem()))
+		if err = gn.decode(b, "k"+d, t.Key(), depth+1); err != nil {
+			return
+		}
+		if err = gn.decode(b, "v"+d, t.Elem(), depth+1); err != nil {
+			return
+		}
+		fmt.Fprintf(b, "%s[k%s] = v%s\n}\n}\n", expr, d, d)
+	case reflect.Ptr:
+		fmt.Fprintf(b, "if ok, err := d.DecodeBool(); err != nil {\nreturn err\n} else if ok {\n")
+		fmt.Fprintf(b, "if %s == nil {\n%s = new(%s)\n}\n", expr, expr, gn.goType(t.Elem()))
+		if err = gn.decode(b, "(*"+expr+")", t.Elem(), depth); err != nil {
+			return
+		}
+		b.WriteString("}\n")
+	case reflect.Struct:
+		if t.Name() == "" {
+			for i := 0; i < t.NumField(); i++ {
+				if err = gn.decode(b, expr+"."+t.Field(i).Name, t.Field(i).Type, depth); err != nil {
+					return
+				}
+			}
+			return
+		}
+		fallthrough
+	case reflect.Interface:
+		gn.use("reflect")
+		check("d.InternalDecode(reflect.ValueOf(&" + expr + ").Elem())")
+	default:
+		return fmt.Errorf("unexpected kind: %v", t.Kind())
+	}
+	return
+}
+
+// CheckGenerated compares the generated methods of the type of v, a pointer,
+// with reflection: v is encoded both ways to the same bytes, and decoded both
+// ways to equal values. The encodings of maps of more entries differ in order,
+// so only the decoded values are compared if the type has maps
+func CheckGenerated(ts *Types, v interface{}) error {
+	if _, ok := v.(Marshaler); !ok {
+		return fmt.Errorf("%T is not Marshaler", v)
+	}
+	if _, ok := v.(Unmarshaler); !ok {
+		return fmt.Errorf("%T is not Unmarshaler", v)
+	}
+	gb, rb := &bytes.Buffer{}, &bytes.Buffer{}
+	if err := (&Encoder{Writer: gb, Types: ts}).Encode(v); err != nil {
+		return fmt.Errorf("generated: %v", err)
+	}
+	if err := (&Encoder{Writer: rb, Types: ts, noMethods: true}).Encode(v); err != nil {
+		return fmt.Errorf("reflection: %v", err)
+	}
+	t := reflect.TypeOf(v).Elem()
+	if !bytes.Equal(gb.Bytes(), rb.Bytes()) && !hasMap(t, make(map[reflect.Type]bool)) {
+		return fmt.Errorf("generated % x != reflection % x", gb.Bytes(), rb.Bytes())
+	}
+	var vs []interface{}
+	for _, src := range [][]byte{gb.Bytes(), rb.Bytes()} {
+		for _, noMethods := range []bool{false, true} {
+			r := bytes.NewReader(src)
+			dv := reflect.New(t).Interface()
+			if err := (&Decoder{Reader: r, Types: ts, noMethods: noMethods}).Decode(dv); err != nil {
+				return fmt.Errorf("decode %s: %v", method(noMethods), err)
+			}
+			if r.Len() > 0 {
+				return fmt.Errorf("decode %s: %d trailing bytes", method(noMethods), r.Len())
+			}
+			if len(vs) > 0 && !reflect.DeepEqual(dv, vs[0]) {
+				return fmt.Errorf("decoded %s %+v != %+v", method(noMethods), dv, vs[0])
+			}
+			vs = append(vs, dv)
+		}
+	}
+	return nil
+}
+
+func method(noMethods bool) string {
+	if noMethods {
+		return "by reflection"
+	}
+	return "by generated"
+}
+
+// hasMap in a type, interfaces may have
+func hasMap(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Map, reflect.Interface:
+		return true
+	case reflect.Slice, reflect.Array, reflect.Ptr:
+		return hasMap(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if hasMap(t.Field(i).Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package schema_test
+
+import (
+	"bytes"
+	"github.com/fengyoulin/schema"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Fixed of hand written methods
+type Fixed struct {
+	N uint16
+}
+
+func (f *Fixed) MarshalSchema(e *schema.Encoder) error {
+	return e.EncodeUint8(uint8(f.N >> 8))
+}
+
+func (f *Fixed) UnmarshalSchema(d *schema.Decoder) error {
+	b, err := d.DecodeUint8()
+	f.N = uint16(b) << 8
+	return err
+}
+
+type withFixed struct {
+	A Fixed
+	B []Fixed
+	C map[string]Fixed
+}
+
+func TestEncoder_Marshaler(t *testing.T) {
+	v := &withFixed{A: Fixed{0x1234}, B: []Fixed{{0x5678}}, C: map[string]Fixed{"c": {0x9abc}}}
+	b := &bytes.Buffer{}
+	if err := (&schema.Encoder{Writer: b}).Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	exp := []byte{1, 0x12, 2, 0x56, 2, 2, 'c', 0x9a}
+	if !bytes.Equal(b.Bytes(), exp) {
+		t.Errorf("% x != % x", b.Bytes(), exp)
+	}
+	r := &withFixed{}
+	if err := (&schema.Decoder{Reader: bytes.NewReader(exp)}).Decode(r); err != nil {
+		t.Fatal(err)
+	}
+	if r.A.N != 0x1200 || r.B[0].N != 0x5600 || r.C["c"].N != 0x9a00 {
+		t.Errorf("unexpected value: %+v", r)
+	}
+	r = &withFixed{}
+	if err := (&schema.Decoder{Reader: bytes.NewReader(exp[:2]), Defaults: true}).Decode(r); err != nil || r.A.N != 0x12 {
+		t.Errorf("unexpected value by reflection with Defaults: %+v, error: %v", r, err)
+	}
+	if err := schema.CheckGenerated(nil, &Fixed{0x1234}); err == nil || !strings.Contains(err.Error(), "generated 01 12 != reflection 01 b4 24") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestGenerator_Methods(t *testing.T) {
+	ts := newTypes(t, testMapDef, testMapAdded...)
+	b := &bytes.Buffer{}
+	if err := (&schema.Generator{Types: ts, Package: "canvas", Methods: true}).Generate(b, "Canvas"); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"func (v *Canvas) MarshalSchema(e *schema.Encoder) error {\n",
+		"\tif err := v.Color.MarshalSchema(e); err != nil {\n",
+		"\tif err := e.InternalEncode(reflect.ValueOf(&v.At).Elem()); err != nil {\n",
+		"\tif err := d.InternalDecode(reflect.ValueOf(&v.Any).Elem()); err != nil {\n",
+		"\t\tif v.Scale == nil {\n\t\t\tv.Scale = make(map[uint8]float32, n0)\n\t\t}\n",
+		"\t\tv.Variant, v.Value = \"Point\", val\n",
+		"\t\treturn fmt.Errorf(\"ordinal %d out of range of enum: Color\", u)\n",
+	} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("missing %q in:\n%s", s, b)
+		}
+	}
+	b.Reset()
+	if err := (&schema.Generator{Types: newTypes(t, testEnumDef), Package: "account", Methods: true}).Generate(b, "Status"); err != nil {
+		t.Fatal(err)
+	}
+	if s := "\tcase 0:\n\t\treturn e.EncodeUint(0)\n"; !strings.Contains(b.String(), s) {
+		t.Errorf("missing %q of the zero value in:\n%s", s, b)
+	}
+	g := &schema.Generator{Package: "x"}
+	for _, ts := range [][]reflect.Type{{reflect.TypeOf(0)}, {reflect.TypeOf(Fixed{}), reflect.TypeOf(bytes.Buffer{})}, {reflect.TypeOf(struct{ C chan int }{})}} {
+		if err := g.GenerateMethods(&bytes.Buffer{}, ts...); err == nil {
+			t.Errorf("%v: expected error", ts)
+		}
+	}
+}
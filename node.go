@@ -0,0 +1,292 @@
+package schema
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+)
+
+// Kind of a Node
+type Kind uint8
+
+// Kinds of Node
+const (
+	KindValue     Kind = iota // basic kind, byte slice, or a type of Extend
+	KindStruct                // Children are the fields
+	KindEnum                  // Variant is the member, Value the underlying value
+	KindUnion                 // with one child of the Variant if not empty
+	KindSlice                 // Children are the elements
+	KindArray                 // Children are the elements
+	KindMap                   // Children are the values, each with its Key
+	KindPtr                   // one child if not nil
+	KindInterface             // with one child of the Variant type if not nil
+)
+
+var kindNames = [...]string{"value", "struct", "enum", "union", "slice", "array", "map", "ptr", "interface"}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("Kind(%d)", k)
+}
+
+// Node of a generic value tree, decoded by the schema only
+type Node struct {
+	Kind     Kind
+	Type     string      // type of the value, as TypeString
+	Name     string      // name of the field
+	Variant  string      // member of an enum, variant of a union, or type of an interface value
+	Key      *Node       // key of a map entry
+	Value    interface{} // value of KindValue and KindEnum
+	Children []*Node
+}
+
+// DecodeNode of the named type, from a stream written by Encode with a pointer
+// to the type, nil if the pointer was nil. With Defaults, a stream ending
+// before a field leaves the trailing fields out of Children
+func (d *Decoder) DecodeNode(name string) (n *Node, err error) {
+	if d.Types == nil {
+		return nil, fmt.Errorf("unknown type: %s", name)
+	}
+	t, ok := d.Types.TypeByName(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown type: %s", name)
+	}
+	c, err := d.byteReader().ReadByte()
+	if err != nil || c == 0 {
+		return
+	}
+	return d.decodeNode(t)
+}
+
+func (d *Decoder) decodeNode(t reflect.Type) (n *Node, err error) {
+	n = &Node{Type: t.String()}
+	if s, err := d.Types.TypeString(t); err == nil {
+		n.Type = s
+	}
+	br := d.byteReader()
+	if _, ok := d.Extend[t]; ok {
+		return n, d.decodeLeaf(n, t)
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		switch c := d.Types.codecOf(t).(type) {
+		case *enumCodec:
+			n.Kind = KindEnum
+			v := reflect.New(t).Elem()
+			if err = c.decode(v, d); err != nil {
+				return
+			}
+			n.Variant, _ = d.Types.Member(v)
+			n.Value = v.Field(0).Interface()
+			return
+		case *unionCodec:
+			n.Kind = KindUnion
+			var u uint64
+			if u, err = binary.ReadUvarint(br); err != nil || u == 0 {
+				return
+			}
+			if u > uint64(len(c.types)) {
+				return nil, fmt.Errorf("variant %d out of range of union: %s", u-1, c.name)
+			}
+			n.Variant = c.names[u-1]
+			return n, d.decodeChildren(n, c.types[u-1], 1)
+		}
+		n.Kind = KindStruct
+		if d.Defaults && t.NumField() > 1 {
+			defer d.scanning()()
+		}
+		for x := 0; x < t.NumField(); x++ {
+			if x > 0 && d.Defaults {
+				var end bool
+				if end, err = d.atEOF(); err != nil || end {
+					return
+				}
+			}
+			var f *Node
+			if f, err = d.decodeNode(t.Field(x).Type); err != nil {
+				return
+			}
+			f.Name = structFieldName(t.Field(x))
+			n.Children = append(n.Children, f)
+		}
+	case reflect.Slice:
+		switch t.Elem().Kind() {
+		case reflect.Int8, reflect.Uint8, reflect.Bool:
+			return n, d.decodeLeaf(n, t)
+		}
+		n.Kind = KindSlice
+		var i int64
+		if i, err = binary.ReadVarint(br); err != nil || i <= 0 {
+			return
+		}
+		return n, d.decodeChildren(n, t.Elem(), int(i))
+	case reflect.Array:
+		n.Kind = KindArray
+		return n, d.decodeChildren(n, t.Elem(), t.Len())
+	case reflect.Map:
+		n.Kind = KindMap
+		var i int64
+		if i, err = binary.ReadVarint(br); err != nil || i <= 0 {
+			return
+		}
+		for x := 0; x < int(i); x++ {
+			var k, v *Node
+			if k, err = d.decodeNode(t.Key()); err != nil {
+				return
+			}
+			if v, err = d.decodeNode(t.Elem()); err != nil {
+				return
+			}
+			v.Key = k
+			n.Children = append(n.Children, v)
+		}
+	case reflect.Ptr:
+		n.Kind = KindPtr
+		var c byte
+		if c, err = br.ReadByte(); err != nil || c <= 0 {
+			return
+		}
+		return n, d.decodeChildren(n, t.Elem(), 1)
+	case reflect.Interface:
+		n.Kind = KindInterface
+		if err = d.InternalDecode(reflect.ValueOf(&n.Variant).Elem()); err != nil || n.Variant == "" {
+			return
+		}
+		var tp reflect.Type
+		if tp, err = d.Types.CreateType(n.Variant); err != nil {
+			return
+		}
+		return n, d.decodeChildren(n, tp, 1)
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return nil, fmt.Errorf("unexpected kind: %v", t.Kind())
+	default:
+		return n, d.decodeLeaf(n, t)
+	}
+	return
+}
+
+func (d *Decoder) decodeLeaf(n *Node, t reflect.Type) (err error) {
+	v := reflect.New(t).Elem()
+	if err = d.InternalDecode(v); err != nil {
+		return
+	}
+	n.Kind = KindValue
+	n.Value = v.Interface()
+	return
+}
+
+func (d *Decoder) decodeChildren(n *Node, t reflect.Type, count int) (err error) {
+	for x := 0; x < count; x++ {
+		var c *Node
+		if c, err = d.decodeNode(t); err != nil {
+			return
+		}
+		n.Children = append(n.Children, c)
+	}
+	return
+}
+
+// EncodeNode as Encode with a pointer to the value of the node, the bytes are
+// identical to those the node was decoded from
+func (e *Encoder) EncodeNode(n *Node) (err error) {
+	if n == nil {
+		_, err = e.Writer.Write([]byte{0})
+		return
+	}
+	if _, err = e.Writer.Write([]byte{1}); err != nil {
+		return
+	}
+	return e.encodeNode(n)
+}
+
+func (e *Encoder) encodeNode(n *Node) (err error) {
+	var buf [16]byte
+	switch n.Kind {
+	case KindValue:
+		v := reflect.ValueOf(n.Value)
+		if !v.IsValid() {
+			return fmt.Errorf("missing value of %s", n.Type)
+		}
+		return e.InternalEncode(v)
+	case KindEnum, KindUnion:
+		if e.Types == nil {
+			return fmt.Errorf("unknown type: %s", n.Type)
+		}
+		var t reflect.Type
+		if t, err = e.Types.CreateType(n.Type); err != nil {
+			return
+		}
+		if n.Kind == KindEnum {
+			v := reflect.New(t).Elem()
+			if err = e.Types.SetMember(v, n.Variant); err != nil {
+				return
+			}
+			return e.InternalEncode(v)
+		}
+		c, ok := e.Types.codecOf(t).(*unionCodec)
+		if !ok {
+			return fmt.Errorf("%s is not union", n.Type)
+		}
+		i := -1
+		if n.Variant != "" {
+			for x, nm := range c.names {
+				if nm == n.Variant {
+					i = x
+				}
+			}
+			if i < 0 || len(n.Children) != 1 {
+				return fmt.Errorf("invalid variant of union %s: %s", c.name, n.Variant)
+			}
+		}
+		l := binary.PutUvarint(buf[:], uint64(i+1))
+		if _, err = e.Writer.Write(buf[:l]); err != nil || i < 0 {
+			return
+		}
+	case KindSlice, KindMap:
+		l := binary.PutVarint(buf[:], int64(len(n.Children)))
+		if _, err = e.Writer.Write(buf[:l]); err != nil {
+			return
+		}
+		if n.Kind == KindMap {
+			for _, c := range n.Children {
+				if c.Key == nil {
+					return fmt.Errorf("missing key of %s", n.Type)
+				}
+				if err = e.encodeNode(c.Key); err != nil {
+					return
+				}
+				if err = e.encodeNode(c); err != nil {
+					return
+				}
+			}
+			return
+		}
+	case KindPtr:
+		buf[0] = 0
+		if len(n.Children) > 0 {
+			buf[0] = 1
+		}
+		if _, err = e.Writer.Write(buf[:1]); err != nil {
+			return
+		}
+	case KindInterface:
+		nm := ""
+		if len(n.Children) > 0 {
+			nm = n.Variant
+		}
+		if err = e.InternalEncode(reflect.ValueOf(&nm).Elem()); err != nil {
+			return
+		}
+	case KindStruct, KindArray:
+	default:
+		return fmt.Errorf("unexpected kind: %v", n.Kind)
+	}
+	for _, c := range n.Children {
+		if err = e.encodeNode(c); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,100 @@
+package schema_test
+
+import (
+	"bytes"
+	"github.com/fengyoulin/schema"
+	"testing"
+)
+
+func TestDecoder_DecodeNode(t *testing.T) {
+	ts := newTypes(t, testMapDef, testMapAdded...)
+	v, err := schema.FromMap(ts, "Canvas", map[string]interface{}{
+		"title":  "t",
+		"color":  "Blue",
+		"origin": map[string]interface{}{"x": 1, "y": -2},
+		"points": []interface{}{map[string]interface{}{"x": 2}, map[string]interface{}{"y": 3}},
+		"scale":  map[string]interface{}{"1": 0.5, "2": 1.5, "3": 2.5, "4": 3.5},
+		"data":   "AQID",
+		"any":    map[string]interface{}{"$type": "Point", "value": map[string]interface{}{"x": 4}},
+		"shape":  map[string]interface{}{"$type": "Label", "value": "s"},
+		"at":     "2021-05-09T11:39:05Z",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &bytes.Buffer{}
+	if err = (&schema.Encoder{Writer: b, Extend: testEnc, Types: ts}).Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	src := append([]byte(nil), b.Bytes()...)
+	n, err := (&schema.Decoder{Reader: b, Extend: testDec, Types: ts}).DecodeNode("Canvas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Kind != schema.KindStruct || n.Type != "Canvas" || len(n.Children) != 10 {
+		t.Fatalf("unexpected node: %+v", n)
+	}
+	fs := map[string]*schema.Node{}
+	for _, c := range n.Children {
+		fs[c.Name] = c
+	}
+	if c := fs["Color"]; c.Kind != schema.KindEnum || c.Variant != "Blue" || c.Value != uint8(1) {
+		t.Errorf("unexpected enum: %+v", c)
+	}
+	if c := fs["Shape"]; c.Kind != schema.KindUnion || c.Variant != "Label" || c.Children[0].Value != "s" {
+		t.Errorf("unexpected union: %+v", c)
+	}
+	if c := fs["Any"]; c.Kind != schema.KindInterface || c.Variant != "Point" || c.Children[0].Children[0].Value != int16(4) {
+		t.Errorf("unexpected interface: %+v", c)
+	}
+	if c := fs["Scale"]; c.Kind != schema.KindMap || len(c.Children) != 4 || c.Children[0].Key.Type != "uint8" {
+		t.Errorf("unexpected map: %+v", c)
+	}
+	if c := fs["At"]; c.Kind != schema.KindValue || c.Type != "Time" {
+		t.Errorf("unexpected time: %+v", c)
+	}
+	out := &bytes.Buffer{}
+	if err = (&schema.Encoder{Writer: out, Extend: testEnc, Types: ts}).EncodeNode(n); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), src) {
+		t.Errorf("%x != %x", out.Bytes(), src)
+	}
+	fs["Color"].Variant = "Red"
+	fs["Shape"].Variant = ""
+	fs["Shape"].Children = nil
+	out.Reset()
+	if err = (&schema.Encoder{Writer: out, Extend: testEnc, Types: ts}).EncodeNode(n); err != nil {
+		t.Fatal(err)
+	}
+	r, err := ts.New("Canvas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = (&schema.Decoder{Reader: out, Extend: testDec, Types: ts}).Decode(r.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := r.String("Color"); c != "Red" {
+		t.Errorf("unexpected color: %s", c)
+	}
+	if s, _ := r.Get("Shape.Value"); s != nil {
+		t.Errorf("unexpected shape: %v", s)
+	}
+}
+
+func TestDecoder_DecodeNodeDefaults(t *testing.T) {
+	ts := newTypes(t, testDefaultDef)
+	// Name: "x", Size: 3, Option.Key: "y", the rest absent
+	buf := []byte{1, 2, 'x', 3, 2, 'y'}
+	n, err := (&schema.Decoder{Reader: bytes.NewReader(buf), Types: ts, Defaults: true}).DecodeNode("Config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(n.Children) != 3 || len(n.Children[2].Children) != 1 || n.Children[2].Children[0].Value != "y" {
+		t.Errorf("unexpected node: %+v", n)
+	}
+	// cut in the middle of Option.Key
+	if _, err = (&schema.Decoder{Reader: bytes.NewReader(buf[:5]), Types: ts, Defaults: true}).DecodeNode("Config"); err == nil {
+		t.Error("expected error of a stream cut in a field")
+	}
+}
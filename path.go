@@ -0,0 +1,185 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// step of a path, a field name or the content of brackets
+type step struct {
+	name    string
+	bracket bool
+}
+
+// parsePath in the form of Items[2].Name or Extra["key"]
+func parsePath(path string) (ss []step, err error) {
+	s := path
+	for s != "" {
+		switch s[0] {
+		case '.':
+			if len(ss) == 0 {
+				return nil, fmt.Errorf("invalid path: %s", path)
+			}
+			s = s[1:]
+			fallthrough
+		default:
+			i := strings.IndexAny(s, ".[")
+			if i < 0 {
+				i = len(s)
+			}
+			if i == 0 {
+				return nil, fmt.Errorf("invalid path: %s", path)
+			}
+			ss = append(ss, step{name: s[:i]})
+			s = s[i:]
+		case '[':
+			i := indexTop(s[1:], ']')
+			if i < 0 {
+				return nil, fmt.Errorf("invalid path: %s", path)
+			}
+			ss = append(ss, step{name: strings.TrimSpace(s[1 : i+1]), bracket: true})
+			s = s[i+2:]
+		}
+	}
+	if len(ss) == 0 {
+		return nil, fmt.Errorf("empty path")
+	}
+	return
+}
+
+// fieldByName of a struct value, by the Go name or the name in schema tag. A
+// field promoted through a nil embedded pointer is read as the zero value, or
+// the pointer is allocated to set the field if alloc
+func fieldByName(rv reflect.Value, name string, alloc bool) (f reflect.Value, ok bool) {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath == "" && (sf.Name == name || sf.Tag.Get("schema") == name) {
+			return rv.Field(i), true
+		}
+	}
+	for i := 0; i < t.NumField(); i++ { // promoted by embedded structs
+		sf := t.Field(i)
+		if !sf.Anonymous {
+			continue
+		}
+		ev := rv.Field(i)
+		if ev.Kind() == reflect.Ptr {
+			if ev.IsNil() {
+				if !alloc {
+					if sf, ok := typeFieldByName(ev.Type().Elem(), name); ok {
+						return reflect.Zero(sf.Type), true
+					}
+					continue
+				}
+				if !ev.CanSet() {
+					continue
+				}
+				ev.Set(reflect.New(ev.Type().Elem()))
+			}
+			ev = ev.Elem()
+		}
+		if ev.Kind() == reflect.Struct {
+			if f, ok = fieldByName(ev, name, alloc); ok {
+				return
+			}
+		}
+	}
+	return
+}
+
+// typeFieldByName like fieldByName, for a struct type
+func typeFieldByName(t reflect.Type, name string) (f reflect.StructField, ok bool) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath == "" && (sf.Name == name || sf.Tag.Get("schema") == name) {
+			return sf, true
+		}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		et := t.Field(i).Type
+		if et.Kind() == reflect.Ptr {
+			et = et.Elem()
+		}
+		if t.Field(i).Anonymous && et.Kind() == reflect.Struct {
+			if f, ok = typeFieldByName(et, name); ok {
+				return
+			}
+		}
+	}
+	return
+}
+
+// parseIndex of a slice or array
+func parseIndex(s string, n int) (i int, err error) {
+	if i, err = strconv.Atoi(s); err != nil {
+		return 0, fmt.Errorf("invalid index: %s", s)
+	}
+	if i < 0 || i >= n {
+		return 0, fmt.Errorf("index out of range: %d", i)
+	}
+	return
+}
+
+// parseKey of a map from a bare or quoted literal
+func (ts *Types) parseKey(s string, t reflect.Type) (k reflect.Value, err error) {
+	if len(s) > 0 && (s[0] == '"' || s[0] == '`') {
+		if s, err = strconv.Unquote(s); err != nil {
+			return k, fmt.Errorf("invalid key: %v", err)
+		}
+	}
+	k = reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		k.SetString(s)
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(s); err == nil {
+			k.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		if i, err = strconv.ParseInt(s, 10, 64); err == nil {
+			err = ts.convert(k, reflect.ValueOf(i))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		if u, err = strconv.ParseUint(s, 10, 64); err == nil {
+			err = ts.convert(k, reflect.ValueOf(u))
+		}
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(s, 64); err == nil {
+			err = ts.convert(k, reflect.ValueOf(f))
+		}
+	default:
+		err = ts.SetMember(k, s)
+	}
+	if err != nil {
+		return k, fmt.Errorf("invalid key: %s", s)
+	}
+	return
+}
+
+// sortValues of basic kinds in place, others are sorted by their formatting
+func sortValues(vs []reflect.Value) {
+	sort.Slice(vs, func(i, j int) bool {
+		a, b := vs[i], vs[j]
+		switch a.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return a.Uint() < b.Uint()
+		case reflect.Float32, reflect.Float64:
+			return a.Float() < b.Float()
+		case reflect.String:
+			return a.String() < b.String()
+		case reflect.Bool:
+			return !a.Bool() && b.Bool()
+		}
+		return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+	})
+}
@@ -0,0 +1,908 @@
+package schema
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ProtoTag of the Field tags, "<number>[,<type>]" of the field number and the
+// proto type if it is not the default of the Go type, e.g. "3,sint32", or
+// "4,map<sint32,fixed64>" of a map
+const ProtoTag = "proto"
+
+// default proto types of Go kinds
+var protoTypes = map[reflect.Kind]string{
+	reflect.Bool:    "bool",
+	reflect.Int:     "int64",
+	reflect.Int8:    "int32",
+	reflect.Int16:   "int32",
+	reflect.Int32:   "int32",
+	reflect.Int64:   "int64",
+	reflect.Uint:    "uint64",
+	reflect.Uint8:   "uint32",
+	reflect.Uint16:  "uint32",
+	reflect.Uint32:  "uint32",
+	reflect.Uint64:  "uint64",
+	reflect.Uintptr: "uint64",
+	reflect.Float32: "float",
+	reflect.Float64: "double",
+	reflect.String:  "string",
+}
+
+// Go types of proto scalar types
+var protoScalars = map[string]string{
+	"double":   "float64",
+	"float":    "float32",
+	"int32":    "int32",
+	"int64":    "int64",
+	"uint32":   "uint32",
+	"uint64":   "uint64",
+	"sint32":   "int32",
+	"sint64":   "int64",
+	"fixed32":  "uint32",
+	"fixed64":  "uint64",
+	"sfixed32": "int32",
+	"sfixed64": "int64",
+	"bool":     "bool",
+	"string":   "string",
+	"bytes":    "[]byte",
+}
+
+// protoTag of a struct field, the number and the proto type, empty if default
+func protoTag(sf reflect.StructField) (num int, typ string, err error) {
+	tag, ok := sf.Tag.Lookup(ProtoTag)
+	if !ok {
+		return 0, "", fmt.Errorf("no proto tag of field: %s", sf.Name)
+	}
+	s := tag
+	if i := strings.IndexByte(tag, ','); i >= 0 {
+		s, typ = tag[:i], tag[i+1:]
+	}
+	if num, err = strconv.Atoi(s); err != nil || num < 1 || num > 1<<29-1 || num >= 19000 && num <= 19999 {
+		return 0, "", fmt.Errorf("invalid proto tag of field %s: %s", sf.Name, tag)
+	}
+	return
+}
+
+// protoScalar type of a Go type, typ overrides the default if compatible
+func protoScalar(t reflect.Type, typ string) (string, error) {
+	if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+		if typ == "" || typ == "bytes" {
+			return "bytes", nil
+		}
+	}
+	def, ok := protoTypes[t.Kind()]
+	if !ok {
+		return "", fmt.Errorf("not a proto scalar: %s", t)
+	}
+	if typ == "" || typ == def {
+		return def, nil
+	}
+	ok = false
+	switch typ {
+	case "int32", "sint32", "sfixed32":
+		ok = def == "int32"
+	case "int64", "sint64", "sfixed64":
+		ok = def == "int32" || def == "int64"
+	case "uint32", "fixed32":
+		ok = def == "uint32"
+	case "uint64", "fixed64":
+		ok = def == "uint32" || def == "uint64"
+	}
+	if !ok {
+		return "", fmt.Errorf("proto type %s of %s", typ, t)
+	}
+	return typ, nil
+}
+
+// Proto writes the named schemas and the ones they refer to as a proto3 file
+// of the package, all schemas if names is empty. The field numbers are taken
+// from ProtoTag, pointers of scalars are optional, inline structs are nested
+// messages and enums keep the member names, numbered by the values of integer
+// members or the ordinals. Unions and interfaces are not supported
+func (ts *Types) Proto(w io.Writer, pkg string, names ...string) (err error) {
+	if len(names) == 0 {
+		ts.lk.RLock()
+		for nm := range ts.sm {
+			names = append(names, nm)
+		}
+		ts.lk.RUnlock()
+		sort.Strings(names)
+	}
+	x := &protoExporter{ts: ts, seen: make(map[reflect.Type]bool), values: make(map[string]string)}
+	for _, nm := range names {
+		t, ok := ts.TypeByName(nm)
+		if !ok {
+			return fmt.Errorf("unknown type: %s", nm)
+		}
+		if t.Kind() != reflect.Struct {
+			continue
+		}
+		if _, err = x.ref(t); err != nil {
+			return
+		}
+	}
+	b := &strings.Builder{}
+	b.WriteString("syntax = \"proto3\";\n")
+	if pkg != "" {
+		fmt.Fprintf(b, "\npackage %s;\n", pkg)
+	}
+	for _, d := range x.decls {
+		b.WriteString("\n" + d)
+	}
+	_, err = io.WriteString(w, b.String())
+	return
+}
+
+type protoExporter struct {
+	ts     *Types
+	seen   map[reflect.Type]bool
+	values map[string]string // enum value names to enums, scoped by the package
+	decls  []string
+}
+
+// ref to a named enum or message, declared after the ones it refers to
+func (x *protoExporter) ref(t reflect.Type) (name string, err error) {
+	name, ok := x.ts.NameByType(t)
+	if !ok || !ir.MatchString(name) || t.Kind() != reflect.Struct {
+		return "", fmt.Errorf("not a schema type: %s", t)
+	}
+	if x.seen[t] {
+		return
+	}
+	x.seen[t] = true
+	b := &strings.Builder{}
+	switch c := x.ts.codecOf(t).(type) {
+	case *enumCodec:
+		err = x.enum(b, name, c)
+	case *unionCodec:
+		err = fmt.Errorf("union is not supported: %s", name)
+	default:
+		fmt.Fprintf(b, "message %s {\n", name)
+		if err = x.message(b, t, "  "); err == nil {
+			b.WriteString("}\n")
+		}
+	}
+	if err != nil {
+		return
+	}
+	x.decls = append(x.decls, b.String())
+	return
+}
+
+// enum of the members, the first must be zero
+func (x *protoExporter) enum(b *strings.Builder, name string, c *enumCodec) error {
+	fmt.Fprintf(b, "enum %s {\n", name)
+	for i, nm := range c.names {
+		n := c.protoNumber(i)
+		if i == 0 && n != 0 {
+			return fmt.Errorf("first member of enum %s is not zero: %s", name, nm)
+		}
+		if !protoIdent(nm) {
+			return fmt.Errorf("invalid member name of enum %s: %s", name, nm)
+		}
+		if e, ok := x.values[nm]; ok {
+			return fmt.Errorf("member %s of enum %s collides with enum %s", nm, name, e)
+		}
+		x.values[nm] = name
+		fmt.Fprintf(b, "  %s = %d;\n", nm, n)
+	}
+	b.WriteString("}\n")
+	return nil
+}
+
+// protoNumber of the i-th member, the value of an integer member or the ordinal
+func (c *enumCodec) protoNumber(i int) int64 {
+	switch v := c.values[i]; v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	}
+	return int64(i)
+}
+
+// message fields of a struct, inline structs are nested messages
+func (x *protoExporter) message(b *strings.Builder, t reflect.Type, indent string) (err error) {
+	nums := make(map[int]string, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		num, typ, err := protoTag(sf)
+		if err != nil {
+			return err
+		}
+		if o, ok := nums[num]; ok {
+			return fmt.Errorf("field %s and %s of the same number: %d", o, sf.Name, num)
+		}
+		nums[num] = sf.Name
+		name := sf.Tag.Get("schema")
+		if name == "" {
+			name = sf.Name
+		}
+		if !protoIdent(name) {
+			return fmt.Errorf("invalid proto name of field: %s", name)
+		}
+		ft := sf.Type
+		label := ""
+		switch {
+		case ft.Kind() == reflect.Ptr:
+			if ft = ft.Elem(); ft.Kind() != reflect.Struct {
+				label = "optional "
+			}
+		case ft.Kind() == reflect.Map:
+		case ft.Kind() == reflect.Slice && ft.Elem().Kind() != reflect.Uint8, ft.Kind() == reflect.Array:
+			label, ft = "repeated ", ft.Elem()
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+		}
+		var pt string
+		if ft.Kind() == reflect.Map {
+			pt, err = x.mapType(b, ft, typ, mangle(sf.Name), indent)
+		} else {
+			pt, err = x.fieldType(b, ft, typ, mangle(sf.Name), indent)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", sf.Name, err)
+		}
+		fmt.Fprintf(b, "%s%s%s %s = %d;\n", indent, label, pt, name, num)
+	}
+	return
+}
+
+// fieldType of a proto field, an inline struct is a nested message of the name
+func (x *protoExporter) fieldType(b *strings.Builder, t reflect.Type, typ, name, indent string) (string, error) {
+	if t.Kind() == reflect.Struct {
+		if typ != "" {
+			return "", fmt.Errorf("proto type %s of %s", typ, t)
+		}
+		if nm, ok := x.ts.NameByType(t); ok && ir.MatchString(nm) {
+			return x.ref(t)
+		}
+		name += "Message"
+		fmt.Fprintf(b, "%smessage %s {\n", indent, name)
+		if err := x.message(b, t, indent+"  "); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(b, "%s}\n", indent)
+		return name, nil
+	}
+	return protoScalar(t, typ)
+}
+
+// mapType of a proto map field, typ is the proto type of the map if not default
+func (x *protoExporter) mapType(b *strings.Builder, t reflect.Type, typ, name, indent string) (string, error) {
+	k, vt, err := protoMapTag(t, typ)
+	if err != nil {
+		return "", err
+	}
+	et := t.Elem()
+	if et.Kind() == reflect.Ptr && et.Elem().Kind() == reflect.Struct {
+		et = et.Elem()
+	}
+	v, err := x.fieldType(b, et, vt, name, indent)
+	if err != nil {
+		return "", err
+	}
+	return "map<" + k + ", " + v + ">", nil
+}
+
+// protoMapTag of a map type, the proto type of the keys and the one of the
+// values from typ, empty for the values of messages and enums
+func protoMapTag(t reflect.Type, typ string) (kt, vt string, err error) {
+	if typ != "" {
+		if !strings.HasPrefix(typ, "map<") || !strings.HasSuffix(typ, ">") {
+			return "", "", fmt.Errorf("proto type %s of %s", typ, t)
+		}
+		ps := strings.Split(typ[4:len(typ)-1], ",")
+		if len(ps) != 2 {
+			return "", "", fmt.Errorf("proto type %s of %s", typ, t)
+		}
+		kt, vt = strings.TrimSpace(ps[0]), strings.TrimSpace(ps[1])
+	}
+	switch t.Key().Kind() {
+	case reflect.Float32, reflect.Float64:
+		return "", "", fmt.Errorf("key type of proto map: %s", t.Key())
+	}
+	if kt, err = protoScalar(t.Key(), kt); err != nil {
+		return
+	}
+	et := t.Elem()
+	if et.Kind() == reflect.Ptr && et.Elem().Kind() == reflect.Struct {
+		et = et.Elem()
+	}
+	if et.Kind() == reflect.Struct {
+		vt = "" // name of the message or enum
+	}
+	return
+}
+
+// protoIdent reports whether s is an identifier of proto
+func protoIdent(s string) bool {
+	for i, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_' || i > 0 && r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// ImportProto parses the named proto3 files and the local files they import
+// from fsys into Schema definitions in the order for CreateSchema. Messages
+// are structs and nested ones are named as Outer_Inner, message fields are
+// pointers, repeated fields are slices, optional scalars are pointers, enums
+// are of int32 with the numbers as values, and the field numbers and proto
+// types are kept in ProtoTag. Imports are relative to the root of fsys, or to
+// the directory of the importing file. Oneofs, groups, proto2 and recursive
+// messages are not supported
+func ImportProto(fsys fs.FS, names ...string) (ss []Schema, err error) {
+	x := &protoImporter{fsys: fsys, files: make(map[string]bool), defs: make(map[string]*protoDef),
+		open: make(map[string]bool), done: make(map[string]bool)}
+	for _, nm := range names {
+		if err = x.load(nm, ""); err != nil {
+			return
+		}
+	}
+	for _, d := range x.order {
+		if err = x.define(d); err != nil {
+			return
+		}
+	}
+	return x.ss, nil
+}
+
+type protoImporter struct {
+	fsys  fs.FS
+	files map[string]bool
+	defs  map[string]*protoDef // of full names
+	order []*protoDef
+	open  map[string]bool // of messages being defined
+	done  map[string]bool
+	names map[string]string // schema names to full names
+	ss    []Schema
+}
+
+// protoDef of a message or an enum
+type protoDef struct {
+	full   string // with the package
+	name   string // of the schema
+	enum   bool
+	fields []protoField
+	values []Member
+}
+
+type protoField struct {
+	label  string // repeated or optional
+	typ    string
+	key    string // of map
+	name   string
+	number int
+	pos    string
+}
+
+// load a file, from dir of the importing file if not found from the root
+func (x *protoImporter) load(name, dir string) (err error) {
+	data, err := fs.ReadFile(x.fsys, name)
+	if err != nil && dir != "" {
+		var e error
+		if data, e = fs.ReadFile(x.fsys, path.Join(dir, name)); e == nil {
+			name, err = path.Join(dir, name), nil
+		}
+	}
+	if err != nil {
+		return
+	}
+	if x.files[name] {
+		return
+	}
+	x.files[name] = true
+	p := &protoParser{lx: protoLexer{src: string(data), file: name, line: 1}, x: x}
+	imports, err := p.parse()
+	if err != nil {
+		return
+	}
+	for _, im := range imports {
+		if err = x.load(im, path.Dir(name)); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return
+}
+
+// add a definition of a full name
+func (x *protoImporter) add(d *protoDef, pkg string) error {
+	if _, ok := x.defs[d.full]; ok {
+		return fmt.Errorf("duplicate definition: %s", d.full)
+	}
+	d.name = strings.Replace(strings.TrimPrefix(strings.TrimPrefix(d.full, pkg), "."), ".", "_", -1)
+	if !ir.MatchString(d.name) {
+		d.name = mangle(d.name)
+	}
+	if x.names == nil {
+		x.names = make(map[string]string)
+	}
+	if o, ok := x.names[d.name]; ok {
+		return fmt.Errorf("schema name %s of both %s and %s", d.name, o, d.full)
+	}
+	x.names[d.name] = d.full
+	x.defs[d.full] = d
+	x.order = append(x.order, d)
+	return nil
+}
+
+// resolve a type name referred in the scope of a full name
+func (x *protoImporter) resolve(ref, scope string) (d *protoDef, ok bool) {
+	if strings.HasPrefix(ref, ".") {
+		d, ok = x.defs[ref[1:]]
+		return
+	}
+	for {
+		full := ref
+		if scope != "" {
+			full = scope + "." + ref
+		}
+		if d, ok = x.defs[full]; ok || scope == "" {
+			return
+		}
+		if i := strings.LastIndexByte(scope, '.'); i >= 0 {
+			scope = scope[:i]
+		} else {
+			scope = ""
+		}
+	}
+}
+
+// define the schema of a definition after the ones it refers to, not a
+// message being defined, as recursive types can not be created
+func (x *protoImporter) define(d *protoDef) (err error) {
+	if x.open[d.full] {
+		return fmt.Errorf("recursive proto message: %s", d.full)
+	}
+	if x.done[d.full] {
+		return
+	}
+	s := Schema{Name: d.name}
+	if d.enum {
+		s.Type, s.Members = "int32", d.values
+		x.ss, x.done[d.full] = append(x.ss, s), true
+		return
+	}
+	x.open[d.full] = true
+	defer delete(x.open, d.full)
+	for _, pf := range d.fields {
+		f := Field{Name: pf.name, Tags: map[string]string{ProtoTag: strconv.Itoa(pf.number)}}
+		typ, pt, msg, err := x.typeOf(pf.typ, d.full)
+		if err != nil {
+			return fmt.Errorf("%s: %v", pf.pos, err)
+		}
+		if pf.key != "" {
+			kt, kp, _, err := x.typeOf(pf.key, d.full)
+			if err != nil || protoScalars[pf.key] == "" || pf.key == "double" || pf.key == "float" || pf.key == "bytes" {
+				return fmt.Errorf("%s: invalid key type of map: %s", pf.pos, pf.key)
+			}
+			f.Type = "map[" + kt + "]" + typ
+			if kp != "" || pt != "" {
+				pt = "map<" + pf.key + "," + pf.typ + ">"
+			}
+		} else {
+			switch {
+			case pf.label == "repeated":
+				f.Type = "[]" + typ
+			case pf.label == "optional" || msg:
+				f.Type = "*" + typ
+			default:
+				f.Type = typ
+			}
+		}
+		if pt != "" {
+			f.Tags[ProtoTag] += "," + pt
+		}
+		s.Fields = append(s.Fields, f)
+	}
+	x.ss, x.done[d.full] = append(x.ss, s), true
+	return
+}
+
+// typeOf a proto type in a scope, the Go type, the proto type if not the
+// default of the Go type, and whether it is a message
+func (x *protoImporter) typeOf(typ, scope string) (t, pt string, msg bool, err error) {
+	if t, ok := protoScalars[typ]; ok {
+		switch typ {
+		case "sint32", "sint64", "fixed32", "fixed64", "sfixed32", "sfixed64":
+			pt = typ
+		}
+		return t, pt, false, nil
+	}
+	d, ok := x.resolve(typ, scope)
+	if !ok {
+		return "", "", false, fmt.Errorf("unknown type: %s", typ)
+	}
+	if err = x.define(d); err != nil {
+		return
+	}
+	return d.name, "", !d.enum, nil
+}
+
+// protoLexer of the tokens of a proto file, comments are skipped
+type protoLexer struct {
+	src  string
+	pos  int
+	file string
+	line int
+	peek string
+}
+
+func (l *protoLexer) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", l.file, l.line, fmt.Sprintf(format, a...))
+}
+
+// next token, empty at the end, strings are kept quoted
+func (l *protoLexer) next() (tok string, err error) {
+	if l.peek != "" {
+		tok, l.peek = l.peek, ""
+		return
+	}
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "//"):
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			i := strings.Index(l.src[l.pos+2:], "*/")
+			if i < 0 {
+				return "", l.errorf("unterminated comment")
+			}
+			l.line += strings.Count(l.src[l.pos:l.pos+2+i], "\n")
+			l.pos += i + 4
+		case c == '"' || c == '\'':
+			i := l.pos + 1
+			for ; i < len(l.src) && l.src[i] != c; i++ {
+				if l.src[i] == '\\' {
+					i++
+				} else if l.src[i] == '\n' {
+					break
+				}
+			}
+			if i >= len(l.src) || l.src[i] != c {
+				return "", l.errorf("unterminated string")
+			}
+			tok, l.pos = l.src[l.pos:i+1], i+1
+			return
+		case c == '_' || c == '.' || c == '-' || c == '+' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			i := l.pos + 1
+			for ; i < len(l.src); i++ {
+				c := l.src[i]
+				if !(c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+					break
+				}
+			}
+			tok, l.pos = l.src[l.pos:i], i
+			return
+		default:
+			tok, l.pos = l.src[l.pos:l.pos+1], l.pos+1
+			return
+		}
+	}
+	return
+}
+
+// expect the next token
+func (l *protoLexer) expect(want string) error {
+	tok, err := l.next()
+	if err != nil {
+		return err
+	}
+	if tok != want {
+		return l.errorf("expected %q, found %q", want, tok)
+	}
+	return nil
+}
+
+// ident of a name or a type
+func (l *protoLexer) ident() (tok string, err error) {
+	if tok, err = l.next(); err != nil {
+		return
+	}
+	if !protoIdent(strings.Replace(strings.TrimPrefix(tok, "."), ".", "_", -1)) {
+		return "", l.errorf("expected identifier, found %q", tok)
+	}
+	return
+}
+
+// str of a quoted string
+func (l *protoLexer) str() (s string, err error) {
+	tok, err := l.next()
+	if err != nil {
+		return
+	}
+	if tok == "" || tok[0] != '"' && tok[0] != '\'' {
+		return "", l.errorf("expected string, found %q", tok)
+	}
+	if tok[0] == '\'' {
+		tok = `"` + strings.Replace(tok[1:len(tok)-1], `"`, `\"`, -1) + `"`
+	}
+	if s, err = strconv.Unquote(tok); err != nil {
+		return "", l.errorf("invalid string %s", tok)
+	}
+	return
+}
+
+// skip to the end of a statement, or of a block
+func (l *protoLexer) skip() (err error) {
+	depth := 0
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case "":
+			return l.errorf("unexpected end of file")
+		case "{":
+			depth++
+		case "}":
+			if depth--; depth == 0 {
+				return nil
+			}
+		case ";":
+			if depth == 0 {
+				return nil
+			}
+		}
+	}
+}
+
+type protoParser struct {
+	lx  protoLexer
+	x   *protoImporter
+	pkg string
+}
+
+// parse the file, the imports are returned
+func (p *protoParser) parse() (imports []string, err error) {
+	l := &p.lx
+	syntax := false
+	for {
+		tok, err := l.next()
+		if err != nil || tok == "" {
+			if err == nil && !syntax {
+				err = l.errorf("syntax is not proto3")
+			}
+			return imports, err
+		}
+		switch tok {
+		case "syntax", "edition":
+			if err = l.expect("="); err != nil {
+				return nil, err
+			}
+			s, err := l.str()
+			if err != nil {
+				return nil, err
+			}
+			if tok != "syntax" || s != "proto3" {
+				return nil, l.errorf("unsupported %s: %s", tok, s)
+			}
+			syntax = true
+			err = l.expect(";")
+		case "package":
+			if p.pkg, err = l.ident(); err == nil {
+				err = l.expect(";")
+			}
+		case "import":
+			if tok, err = l.next(); err != nil {
+				return nil, err
+			}
+			if tok != "public" && tok != "weak" {
+				l.peek = tok
+			}
+			s, err := l.str()
+			if err != nil {
+				return nil, err
+			}
+			imports = append(imports, s)
+			err = l.expect(";")
+		case "option", "service", "extend":
+			err = l.skip()
+		case "message":
+			err = p.message(p.pkg)
+		case "enum":
+			err = p.enum(p.pkg)
+		case ";":
+		default:
+			err = l.errorf("unexpected %q", tok)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// full name of a definition in a scope
+func full(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+// message after the keyword
+func (p *protoParser) message(scope string) (err error) {
+	l := &p.lx
+	name, err := l.ident()
+	if err != nil {
+		return
+	}
+	d := &protoDef{full: full(scope, name)}
+	if err = l.expect("{"); err != nil {
+		return
+	}
+	if err = p.x.add(d, p.pkg); err != nil {
+		return l.errorf("%v", err)
+	}
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case "}":
+			return nil
+		case "":
+			return l.errorf("unexpected end of file")
+		case ";":
+		case "message":
+			err = p.message(d.full)
+		case "enum":
+			err = p.enum(d.full)
+		case "option", "reserved", "extensions", "extend":
+			err = l.skip()
+		case "oneof", "group", "required":
+			err = l.errorf("%s is not supported", tok)
+		default:
+			err = p.field(d, tok)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// field of a message from its first token
+func (p *protoParser) field(d *protoDef, tok string) (err error) {
+	l := &p.lx
+	f := protoField{pos: fmt.Sprintf("%s:%d", l.file, l.line)}
+	if tok == "repeated" || tok == "optional" {
+		f.label = tok
+		if tok, err = l.next(); err != nil {
+			return
+		}
+	}
+	if tok == "map" {
+		if err = l.expect("<"); err != nil {
+			return
+		}
+		if f.key, err = l.ident(); err != nil {
+			return
+		}
+		if err = l.expect(","); err != nil {
+			return
+		}
+		if f.typ, err = l.ident(); err != nil {
+			return
+		}
+		if err = l.expect(">"); err != nil {
+			return
+		}
+	} else {
+		l.peek = tok
+		if f.typ, err = l.ident(); err != nil {
+			return
+		}
+	}
+	if f.name, err = l.ident(); err != nil {
+		return
+	}
+	if err = l.expect("="); err != nil {
+		return
+	}
+	n, err := l.next()
+	if err != nil {
+		return
+	}
+	if f.number, err = strconv.Atoi(n); err != nil {
+		return l.errorf("invalid field number: %s", n)
+	}
+	if err = p.options(); err != nil {
+		return
+	}
+	d.fields = append(d.fields, f)
+	return
+}
+
+// options of a field or an enum value to the end of the statement, which are ignored
+func (p *protoParser) options() (err error) {
+	l := &p.lx
+	tok, err := l.next()
+	if err != nil || tok == ";" {
+		return
+	}
+	if tok != "[" {
+		return l.errorf("expected \";\", found %q", tok)
+	}
+	for tok != "]" {
+		if tok, err = l.next(); err != nil {
+			return
+		}
+		if tok == "" {
+			return l.errorf("unexpected end of file")
+		}
+	}
+	return l.expect(";")
+}
+
+// enum after the keyword
+func (p *protoParser) enum(scope string) (err error) {
+	l := &p.lx
+	name, err := l.ident()
+	if err != nil {
+		return
+	}
+	d := &protoDef{full: full(scope, name), enum: true}
+	if err = l.expect("{"); err != nil {
+		return
+	}
+	if err = p.x.add(d, p.pkg); err != nil {
+		return l.errorf("%v", err)
+	}
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case "}":
+			if len(d.values) == 0 {
+				return l.errorf("empty enum: %s", name)
+			}
+			return nil
+		case "":
+			return l.errorf("unexpected end of file")
+		case ";":
+		case "option", "reserved":
+			if err = l.skip(); err != nil {
+				return err
+			}
+		default:
+			if err = l.expect("="); err != nil {
+				return err
+			}
+			n, err := l.next()
+			if err != nil {
+				return err
+			}
+			if _, err = strconv.ParseInt(n, 10, 32); err != nil {
+				return l.errorf("invalid enum value: %s", n)
+			}
+			if len(d.values) == 0 && n != "0" {
+				return l.errorf("first value of enum %s is not zero", name)
+			}
+			if err = p.options(); err != nil {
+				return err
+			}
+			d.values = append(d.values, Member{Name: tok, Value: []byte(n)})
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package schema_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/fengyoulin/schema"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var testProtoFS = fstest.MapFS{
+	"shop/order.proto": {Data: []byte(`syntax = "proto3";
+package shop;
+
+import public "common/money.proto";
+option go_package = "example.com/shop";
+
+/* An order
+   of lines */
+message Order {
+  uint64 id = 1;
+  Status status = 2;
+  repeated Line lines = 3;
+  map<string, sint32> counts = 4;
+  optional string note = 5;
+  common.Money total = 6;
+  message Line {
+    string sku = 1 [json_name = "sku"];
+    fixed32 qty = 2;
+  }
+  reserved 7, 8;
+  bytes data = 9; // raw
+}
+
+enum Status {
+  option allow_alias = false;
+  STATUS_NEW = 0;
+  STATUS_PAID = 1;
+}
+`)},
+	"common/money.proto": {Data: []byte(`syntax = 'proto3';
+package common;
+message Money {
+  string currency = 1;
+  int64 units = 2;
+}
+`)},
+}
+
+const testProtoOrder = `syntax = "proto3";
+
+package shop;
+
+enum Status {
+  STATUS_NEW = 0;
+  STATUS_PAID = 1;
+}
+
+message Order_Line {
+  string sku = 1;
+  fixed32 qty = 2;
+}
+
+message Money {
+  string currency = 1;
+  int64 units = 2;
+}
+
+message Order {
+  uint64 id = 1;
+  Status status = 2;
+  repeated Order_Line lines = 3;
+  map<string, sint32> counts = 4;
+  optional string note = 5;
+  Money total = 6;
+  bytes data = 9;
+}
+`
+
+// marshalSchemas without escaping HTML
+func marshalSchemas(t *testing.T, ss []schema.Schema) []byte {
+	b := &bytes.Buffer{}
+	je := json.NewEncoder(b)
+	je.SetEscapeHTML(false)
+	if err := je.Encode(ss); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n"))
+}
+
+func TestImportProto(t *testing.T) {
+	ss, err := schema.ImportProto(testProtoFS, "shop/order.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := marshalSchemas(t, ss)
+	exp := `[{"name":"Status","type":"int32","members":[{"name":"STATUS_NEW","value":0},{"name":"STATUS_PAID","value":1}]},` +
+		`{"name":"Order_Line","fields":[{"name":"sku","type":"string","tags":{"proto":"1"}},{"name":"qty","type":"uint32","tags":{"proto":"2,fixed32"}}]},` +
+		`{"name":"Money","fields":[{"name":"currency","type":"string","tags":{"proto":"1"}},{"name":"units","type":"int64","tags":{"proto":"2"}}]},` +
+		`{"name":"Order","fields":[{"name":"id","type":"uint64","tags":{"proto":"1"}},{"name":"status","type":"Status","tags":{"proto":"2"}},` +
+		`{"name":"lines","type":"[]Order_Line","tags":{"proto":"3"}},{"name":"counts","type":"map[string]int32","tags":{"proto":"4,map<string,sint32>"}},` +
+		`{"name":"note","type":"*string","tags":{"proto":"5"}},{"name":"total","type":"*Money","tags":{"proto":"6"}},{"name":"data","type":"[]byte","tags":{"proto":"9"}}]}]`
+	if string(b) != exp {
+		t.Errorf("%s\n!=\n%s", b, exp)
+	}
+	ts := createTypes(t, ss)
+	w := &bytes.Buffer{}
+	if err = ts.Proto(w, "shop", "Order"); err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != testProtoOrder {
+		t.Errorf("%s\n!=\n%s", w, testProtoOrder)
+	}
+	rs, err := schema.ImportProto(fstest.MapFS{"order.proto": {Data: w.Bytes()}}, "order.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := marshalSchemas(t, rs); string(r) != exp {
+		t.Errorf("reimported:\n%s\n!=\n%s", r, exp)
+	}
+	for _, src := range []string{
+		"syntax = \"proto2\";\nmessage A {}",
+		"message A {}",
+		"syntax = \"proto3\";\nmessage A { oneof x { int32 a = 1; } }",
+		"syntax = \"proto3\";\nmessage A { B b = 1; }",
+		"syntax = \"proto3\";\nimport \"missing.proto\";",
+		"syntax = \"proto3\";\nmessage A { map<double, int32> m = 1; }",
+		"syntax = \"proto3\";\nenum E { X = 1; }",
+		"syntax = \"proto3\";\nmessage A { int32 a = 1 }",
+		"syntax = \"proto3\";\nmessage A {}\nmessage A {}",
+		"syntax = \"proto3\";\nmessage A { repeated A a = 1; }",
+		"syntax = \"proto3\";\nmessage A { map<string, A> m = 1; }",
+	} {
+		if _, err = schema.ImportProto(fstest.MapFS{"a.proto": {Data: []byte(src)}}, "a.proto"); err == nil {
+			t.Errorf("%q: expected error", src)
+		}
+	}
+	for src, exp := range map[string]string{
+		"syntax = \"proto3\";\nmessage Node { int32 v = 1; Node next = 2; }":               "a.proto:2: recursive proto message: Node",
+		"syntax = \"proto3\";\npackage p;\nmessage A { B b = 1; }\nmessage B { A a = 1; }": "a.proto:3: a.proto:4: recursive proto message: p.A",
+	} {
+		if _, err = schema.ImportProto(fstest.MapFS{"a.proto": {Data: []byte(src)}}, "a.proto"); err == nil || err.Error() != exp {
+			t.Errorf("%q: unexpected error: %v", src, err)
+		}
+	}
+}
+
+func TestTypes_Proto(t *testing.T) {
+	ts := newTypes(t, `[{"name":"Box","fields":[
+{"name":"Items","type":"[]*struct","tags":{"proto":"1"},"fields":[{"name":"N","type":"int","tags":{"proto":"1,sint64"}}]},
+{"name":"Size","type":"*uint8","tags":{"proto":"2"}},
+{"name":"open_id","type":"string","tags":{"proto":"3"}}
+]}]`)
+	w := &bytes.Buffer{}
+	if err := ts.Proto(w, ""); err != nil {
+		t.Fatal(err)
+	}
+	exp := "syntax = \"proto3\";\n\nmessage Box {\n  message ItemsMessage {\n    sint64 N = 1;\n  }\n" +
+		"  repeated ItemsMessage Items = 1;\n  optional uint32 Size = 2;\n  string open_id = 3;\n}\n"
+	if w.String() != exp {
+		t.Errorf("%q != %q", w, exp)
+	}
+	for _, def := range []string{
+		`{"name":"A","fields":[{"name":"X","type":"int"}]}`,
+		`{"name":"A","fields":[{"name":"X","type":"int","tags":{"proto":"1"}},{"name":"Y","type":"int","tags":{"proto":"1"}}]}`,
+		`{"name":"A","fields":[{"name":"X","type":"int","tags":{"proto":"1,fixed32"}}]}`,
+		`{"name":"A","fields":[{"name":"X","type":"[][]int","tags":{"proto":"1"}}]}`,
+		`{"name":"A","variants":[{"name":"X","type":"int"}]}`,
+		`{"name":"A","type":"int","members":[{"name":"X","value":1}]}`,
+	} {
+		ts := newTypes(t, "["+def+"]")
+		if err := ts.Proto(w, "x", "A"); err == nil || strings.Contains(err.Error(), "unknown type") {
+			t.Errorf("%s: unexpected error: %v", def, err)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Query compiled against a root type, e.g. Items[?Level>3].Name
+//
+// A query is a path of steps: a field name, * for every field, [n] for an
+// index, [key] or ["key"] for a map key, [*] for every element, and [?P op L]
+// for the elements where the path P compares with the literal L by one of
+// == != < <= > >=, or [?P] where P is true. A predicate on a value other than
+// a collection keeps or drops the value itself.
+type Query struct {
+	ts    *Types
+	root  reflect.Type
+	steps []queryStep
+}
+
+type queryStep struct {
+	step
+	wild bool       // * or [*]
+	pred *predicate // [?...]
+}
+
+type predicate struct {
+	path []step
+	op   string // empty for a bool path
+	lit  interface{}
+}
+
+var queryOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// Query compiles q against the named root type
+func (ts *Types) Query(root, q string) (qr *Query, err error) {
+	t, ok := ts.TypeByName(root)
+	if !ok {
+		return nil, fmt.Errorf("unknown type: %s", root)
+	}
+	ss, err := parsePath(q)
+	if err != nil {
+		return
+	}
+	qr = &Query{ts: ts, root: t}
+	for _, s := range ss {
+		qs := queryStep{step: s}
+		if s.name == "*" {
+			qs.wild = true
+		} else if s.bracket && strings.HasPrefix(s.name, "?") {
+			if qs.pred, err = parsePredicate(s.name[1:]); err != nil {
+				return nil, err
+			}
+		}
+		qr.steps = append(qr.steps, qs)
+	}
+	if err = qr.check(); err != nil {
+		return nil, fmt.Errorf("%s: %v", q, err)
+	}
+	return
+}
+
+func parsePredicate(s string) (p *predicate, err error) {
+	p = &predicate{}
+	left := s
+	for _, op := range queryOps {
+		if i := indexTop(s, op[0]); i >= 0 && strings.HasPrefix(s[i:], op) {
+			left, p.op = s[:i], op
+			if p.lit, err = parseLiteral(strings.TrimSpace(s[i+len(op):])); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if p.path, err = parsePath(strings.TrimSpace(left)); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// parseLiteral of a number, quoted string, bool, or a bare name as string
+func parseLiteral(s string) (v interface{}, err error) {
+	if s == "" {
+		return nil, fmt.Errorf("missing literal")
+	}
+	switch {
+	case s[0] == '"' || s[0] == '`':
+		return strconv.Unquote(s)
+	case s == "true" || s == "false":
+		return s == "true", nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+	if !ir.MatchString(s) {
+		return nil, fmt.Errorf("invalid literal: %s", s)
+	}
+	return s, nil
+}
+
+// check the steps against the root type, until an interface is reached
+func (q *Query) check() (err error) {
+	t := q.root
+	for _, s := range q.steps {
+		if s.pred == nil || isCollection(t) {
+			if t, err = checkStep(t, s.step, s.wild); err != nil || t == nil {
+				return
+			}
+		}
+		if s.pred != nil {
+			pt := t
+			for _, ps := range s.pred.path {
+				if pt, err = checkStep(pt, ps, false); err != nil || pt == nil {
+					break
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// checkStep returns the type selected by s from t, nil if unknown until run time
+func checkStep(t reflect.Type, s step, wild bool) (reflect.Type, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t.Kind() == reflect.Interface:
+		return nil, nil
+	case !s.bracket && t.Kind() == reflect.Struct:
+		if wild {
+			return nil, nil
+		}
+		if f, ok := typeFieldByName(t, s.name); ok {
+			return f.Type, nil
+		}
+		return nil, fmt.Errorf("unknown field of %s: %s", t, s.name)
+	case s.bracket && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map):
+		return t.Elem(), nil
+	}
+	return nil, fmt.Errorf("cannot select %s of %s", s.name, t)
+}
+
+// Eval the query on a value of the root type, or a pointer to it
+func (q *Query) Eval(v interface{}) (vs []reflect.Value, err error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && rv.Type() != q.root && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() || rv.Type() != q.root {
+		return nil, fmt.Errorf("%T is not %s", v, q.root)
+	}
+	vs = []reflect.Value{rv}
+	for _, s := range q.steps {
+		var next []reflect.Value
+		for _, cv := range vs {
+			if next, err = q.apply(next, cv, s); err != nil {
+				return nil, err
+			}
+		}
+		vs = next
+	}
+	return
+}
+
+// Decode a value of the root type and evaluate the query on it
+func (q *Query) Decode(d *Decoder) (vs []reflect.Value, err error) {
+	name, ok := q.ts.NameByType(q.root)
+	if !ok {
+		return nil, fmt.Errorf("unknown type: %s", q.root)
+	}
+	v, err := q.ts.NewValue(name)
+	if err != nil {
+		return
+	}
+	if err = d.Decode(v.Interface()); err != nil {
+		return
+	}
+	return q.Eval(v.Interface())
+}
+
+// apply a step to a value, appending the selected values to vs
+func (q *Query) apply(vs []reflect.Value, rv reflect.Value, s queryStep) ([]reflect.Value, error) {
+	rv = indirect(rv)
+	if !rv.IsValid() {
+		return vs, nil
+	}
+	switch {
+	case s.pred != nil && !isCollection(rv.Type()):
+		if q.match(rv, s.pred) {
+			vs = append(vs, rv)
+		}
+		return vs, nil
+	case !s.bracket && rv.Kind() == reflect.Struct:
+		if s.wild {
+			for i := 0; i < rv.NumField(); i++ {
+				if rv.Type().Field(i).PkgPath == "" {
+					vs = append(vs, indirectIface(rv.Field(i)))
+				}
+			}
+		} else if f, ok := fieldByName(rv, s.name, false); ok {
+			vs = append(vs, indirectIface(f))
+		}
+		return vs, nil
+	case s.bracket && (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array):
+		if !s.wild && s.pred == nil {
+			if i, err := parseIndex(s.name, rv.Len()); err == nil {
+				vs = append(vs, indirectIface(rv.Index(i)))
+			}
+			return vs, nil
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if e := indirectIface(rv.Index(i)); q.match(e, s.pred) {
+				vs = append(vs, e)
+			}
+		}
+		return vs, nil
+	case s.bracket && rv.Kind() == reflect.Map:
+		if !s.wild && s.pred == nil {
+			k, err := q.ts.parseKey(s.name, rv.Type().Key())
+			if err != nil {
+				return nil, err
+			}
+			if e := rv.MapIndex(k); e.IsValid() {
+				vs = append(vs, indirectIface(e))
+			}
+			return vs, nil
+		}
+		for _, k := range sortedKeys(rv) {
+			if e := indirectIface(rv.MapIndex(k)); q.match(e, s.pred) {
+				vs = append(vs, e)
+			}
+		}
+		return vs, nil
+	}
+	return vs, nil // mismatch below an interface, static types are checked by Query
+}
+
+// match an element against the predicate, nil matches all
+func (q *Query) match(rv reflect.Value, p *predicate) bool {
+	if p == nil {
+		return true
+	}
+	pv, err := q.ts.get(rv, p.path)
+	if err != nil {
+		return false
+	}
+	if p.op == "" {
+		return pv.Kind() == reflect.Bool && pv.Bool()
+	}
+	c, ok := q.compare(pv, p.lit)
+	if !ok {
+		return p.op == "!="
+	}
+	switch p.op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+// compare a value with a literal, ok is false if they are not comparable
+func (q *Query) compare(rv reflect.Value, lit interface{}) (c int, ok bool) {
+	switch l := lit.(type) {
+	case float64:
+		f, err := toFloat(rv)
+		if err != nil {
+			return
+		}
+		switch {
+		case f < l:
+			return -1, true
+		case f > l:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		var s string
+		if rv.Kind() == reflect.String {
+			s = rv.String()
+		} else if s, ok = q.ts.Member(rv); !ok {
+			return
+		}
+		return strings.Compare(s, l), true
+	case bool:
+		if rv.Kind() != reflect.Bool {
+			return
+		}
+		if rv.Bool() == l {
+			return 0, true
+		}
+		return 1, true
+	}
+	return
+}
+
+// isCollection of elements, through pointers
+func isCollection(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map
+}
+
+func indirect(rv reflect.Value) reflect.Value {
+	for rv.IsValid() && (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface) {
+		if rv.IsNil() {
+			return reflect.Value{}
+		}
+		rv = rv.Elem()
+	}
+	return rv
+}
+
+func indirectIface(rv reflect.Value) reflect.Value {
+	for rv.Kind() == reflect.Interface && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	return rv
+}
+
+// sortedKeys of a map with keys of basic kinds, for a stable order
+func sortedKeys(rv reflect.Value) []reflect.Value {
+	ks := rv.MapKeys()
+	sortValues(ks)
+	return ks
+}
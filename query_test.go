@@ -0,0 +1,128 @@
+package schema_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/fengyoulin/schema"
+	"reflect"
+	"testing"
+)
+
+const testQueryDef = `
+[{"name":"Tier","type":"int","members":[{"name":"Free"},{"name":"Pro"}]},
+{"name":"Task","fields":[
+{"name":"Name","type":"string"},
+{"name":"Level","type":"int"},
+{"name":"Done","type":"bool"},
+{"name":"Tier","type":"Tier"}
+]},
+{"name":"Board","fields":[
+{"name":"Title","type":"string"},
+{"name":"Items","type":"[]Task"},
+{"name":"Owners","type":"map[string]*Task"}
+]}]
+`
+
+func newQueryTypes(t *testing.T) (*schema.Types, reflect.Value) {
+	ts := newTypes(t, testQueryDef)
+	r, err := ts.New("Board")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt, _ := ts.TypeByName("Task")
+	if err = r.Set("Items", reflect.MakeSlice(reflect.SliceOf(tt), 3, 3).Interface()); err != nil {
+		t.Fatal(err)
+	}
+	sets := map[string]interface{}{
+		"Title":          "b",
+		"Items[0].Name":  "a",
+		"Items[0].Level": 1,
+		"Items[1].Name":  "b",
+		"Items[1].Level": 4,
+		"Items[1].Done":  true,
+		"Items[2].Name":  "c",
+		"Items[2].Level": 5,
+		"Items[2].Tier":  "Pro",
+		"Owners[x].Name": "x",
+		"Owners[y].Name": "y",
+		"Owners[y].Tier": "Pro",
+	}
+	for p, v := range sets {
+		if err = r.Set(p, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ts, reflect.ValueOf(r.Interface())
+}
+
+func TestTypes_Query(t *testing.T) {
+	ts, v := newQueryTypes(t)
+	cases := []struct {
+		q   string
+		exp string
+	}{
+		{"Items[?Level>3].Name", "[b c]"},
+		{"Items[?Level<=4][?Done].Name", "[b]"},
+		{`Items[?Name!="b"].Level`, "[1 5]"},
+		{"Items[?Tier==Pro].Name", "[c]"},
+		{"Items[*].Name", "[a b c]"},
+		{"Items[1].*", "[b 4 true {0}]"},
+		{"Owners[*].Name", "[x y]"},
+		{"Owners[?Tier==Free].Name", "[x]"},
+		{`Owners["y"].Name`, "[y]"},
+		{"Owners[z].Name", "[]"},
+		{"Items[9].Name", "[]"},
+	}
+	for _, c := range cases {
+		q, err := ts.Query("Board", c.q)
+		if err != nil {
+			t.Errorf("%s: %v", c.q, err)
+			continue
+		}
+		vs, err := q.Eval(v.Interface())
+		if err != nil {
+			t.Errorf("%s: %v", c.q, err)
+			continue
+		}
+		is := make([]interface{}, len(vs))
+		for i, rv := range vs {
+			is[i] = rv.Interface()
+		}
+		if s := fmt.Sprint(is); s != c.exp {
+			t.Errorf("%s: %s != %s", c.q, s, c.exp)
+		}
+	}
+	for _, q := range []string{"Missing", "Title[0]", "Items[?Unknown>1]", "Items[?Level>]", "Items.Name"} {
+		if _, err := ts.Query("Board", q); err == nil {
+			t.Errorf("%s: expected error", q)
+		}
+	}
+	q, err := ts.Query("Board", "Items[*].Name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range []interface{}{nil, reflect.Zero(v.Type()).Interface(), 1} {
+		if _, err = q.Eval(a); err == nil {
+			t.Errorf("%#v: expected error", a)
+		}
+	}
+}
+
+func TestQuery_Decode(t *testing.T) {
+	ts, v := newQueryTypes(t)
+	b := &bytes.Buffer{}
+	if err := (&schema.Encoder{Writer: b, Types: ts}).Encode(v.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	q, err := ts.Query("Board", "Items[?Level>=4].Level")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs, err := q.Decode(&schema.Decoder{Reader: b, Types: ts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 2 || vs[0].Int() != 4 || vs[1].Int() != 5 {
+		t.Errorf("unexpected values: %v", vs)
+	}
+}
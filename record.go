@@ -0,0 +1,390 @@
+package schema
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// Record wraps a struct value of a type in Types, for access by field names and paths
+type Record struct {
+	ts *Types
+	rv reflect.Value // addressable struct
+}
+
+// New record of the named type, with defaults applied
+func (ts *Types) New(name string) (r *Record, err error) {
+	v, err := ts.NewValue(name)
+	if err != nil {
+		return
+	}
+	return &Record{ts: ts, rv: v.Elem()}, nil
+}
+
+// Wrap a pointer to struct as record
+func (ts *Types) Wrap(v interface{}) (r *Record, err error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%T is not pointer to struct", v)
+	}
+	return &Record{ts: ts, rv: rv.Elem()}, nil
+}
+
+// Interface returns the pointer to the wrapped struct
+func (r *Record) Interface() interface{} {
+	return r.rv.Addr().Interface()
+}
+
+// Name of the record type, empty if it is not named in Types
+func (r *Record) Name() string {
+	nm, _ := r.ts.NameByType(r.rv.Type())
+	return nm
+}
+
+// Fields of the record type, with embedded structs as single fields
+func (r *Record) Fields() (fs []Field) {
+	t := r.rv.Type()
+	r.ts.lk.RLock()
+	nm := r.ts.tn[t]
+	fs, err := r.ts.fieldsOf(nm)
+	r.ts.lk.RUnlock()
+	if err == nil && len(fs) == t.NumField() {
+		return
+	}
+	fs = make([]Field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		typ, _ := r.ts.TypeString(sf.Type)
+		fs = append(fs, Field{Name: sf.Name, Type: typ, Tags: parseTags(sf.Tag), Embedded: sf.Anonymous})
+	}
+	return
+}
+
+// Range calls fn for each field in order, until fn returns false
+func (r *Record) Range(fn func(f Field, v interface{}) bool) {
+	for _, f := range r.Fields() {
+		fv, ok := fieldByName(r.rv, fieldName(&f), false)
+		if ok && !fn(f, fv.Interface()) {
+			return
+		}
+	}
+}
+
+// Get the value of a field or a path, e.g. Items[2].Name
+func (r *Record) Get(path string) (v interface{}, err error) {
+	rv, err := r.value(path)
+	if err != nil {
+		return
+	}
+	return rv.Interface(), nil
+}
+
+// Set the value of a field or a path, converting numbers and enum member names,
+// nil pointers and maps on the path are created
+func (r *Record) Set(path string, v interface{}) (err error) {
+	ss, err := parsePath(path)
+	if err != nil {
+		return
+	}
+	if err = r.ts.set(r.rv, ss, reflect.ValueOf(v)); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return
+}
+
+// Int value of a path, converted from any number
+func (r *Record) Int(path string) (i int64, err error) {
+	rv, err := r.value(path)
+	if err != nil {
+		return
+	}
+	return toInt(rv)
+}
+
+// Uint value of a path, converted from any number
+func (r *Record) Uint(path string) (u uint64, err error) {
+	rv, err := r.value(path)
+	if err != nil {
+		return
+	}
+	return toUint(rv)
+}
+
+// Float value of a path, converted from any number
+func (r *Record) Float(path string) (f float64, err error) {
+	rv, err := r.value(path)
+	if err != nil {
+		return
+	}
+	return toFloat(rv)
+}
+
+// String value of a path, or the member name of an enum
+func (r *Record) String(path string) (s string, err error) {
+	rv, err := r.value(path)
+	if err != nil {
+		return
+	}
+	if rv.Kind() == reflect.String {
+		return rv.String(), nil
+	}
+	if nm, ok := r.ts.Member(rv); ok {
+		return nm, nil
+	}
+	return "", fmt.Errorf("%s: cannot convert %s to string", path, rv.Type())
+}
+
+// Bool value of a path
+func (r *Record) Bool(path string) (b bool, err error) {
+	rv, err := r.value(path)
+	if err != nil {
+		return
+	}
+	if rv.Kind() != reflect.Bool {
+		return false, fmt.Errorf("%s: cannot convert %s to bool", path, rv.Type())
+	}
+	return rv.Bool(), nil
+}
+
+// Record of a struct, or pointer to struct at a path, of a copy if not
+// addressable, e.g. a map element
+func (r *Record) Record(path string) (sub *Record, err error) {
+	rv, err := r.value(path)
+	if err != nil {
+		return
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s: %s is not struct", path, rv.Type())
+	}
+	if !rv.CanAddr() {
+		cv := reflect.New(rv.Type()).Elem()
+		cv.Set(rv)
+		rv = cv
+	}
+	return &Record{ts: r.ts, rv: rv}, nil
+}
+
+// value at a path, through pointers and interfaces
+func (r *Record) value(path string) (rv reflect.Value, err error) {
+	ss, err := parsePath(path)
+	if err != nil {
+		return
+	}
+	if rv, err = r.ts.get(r.rv, ss); err != nil {
+		return rv, fmt.Errorf("%s: %v", path, err)
+	}
+	return
+}
+
+func (ts *Types) get(rv reflect.Value, ss []step) (v reflect.Value, err error) {
+	for _, s := range ss {
+		for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+			if rv.IsNil() {
+				return v, fmt.Errorf("nil %s at %s", rv.Type(), s.name)
+			}
+			rv = rv.Elem()
+		}
+		switch {
+		case !s.bracket && rv.Kind() == reflect.Struct:
+			f, ok := fieldByName(rv, s.name, false)
+			if !ok {
+				return v, fmt.Errorf("unknown field: %s", s.name)
+			}
+			rv = f
+		case s.bracket && (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array):
+			i, err := parseIndex(s.name, rv.Len())
+			if err != nil {
+				return v, err
+			}
+			rv = rv.Index(i)
+		case s.bracket && rv.Kind() == reflect.Map:
+			k, err := ts.parseKey(s.name, rv.Type().Key())
+			if err != nil {
+				return v, err
+			}
+			e := rv.MapIndex(k)
+			if !e.IsValid() {
+				return v, fmt.Errorf("key not found: %s", s.name)
+			}
+			rv = e
+		default:
+			return v, fmt.Errorf("cannot select %s of %s", s.name, rv.Type())
+		}
+	}
+	for rv.Kind() == reflect.Interface && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	return rv, nil
+}
+
+func (ts *Types) set(rv reflect.Value, ss []step, v reflect.Value) (err error) {
+	if len(ss) == 0 {
+		return ts.convert(rv, v)
+	}
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return ts.set(rv.Elem(), ss, v)
+	}
+	s := ss[0]
+	switch {
+	case !s.bracket && rv.Kind() == reflect.Struct:
+		f, ok := fieldByName(rv, s.name, true)
+		if !ok {
+			return fmt.Errorf("unknown field: %s", s.name)
+		}
+		return ts.set(f, ss[1:], v)
+	case s.bracket && (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array):
+		i, err := parseIndex(s.name, rv.Len())
+		if err != nil {
+			return err
+		}
+		return ts.set(rv.Index(i), ss[1:], v)
+	case s.bracket && rv.Kind() == reflect.Map:
+		k, err := ts.parseKey(s.name, rv.Type().Key())
+		if err != nil {
+			return err
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMap(rv.Type()))
+		}
+		e := reflect.New(rv.Type().Elem()).Elem()
+		if o := rv.MapIndex(k); o.IsValid() {
+			e.Set(o)
+		}
+		if err = ts.set(e, ss[1:], v); err != nil {
+			return err
+		}
+		rv.SetMapIndex(k, e)
+		return nil
+	case rv.Kind() == reflect.Interface && !rv.IsNil():
+		e := reflect.New(rv.Elem().Type()).Elem()
+		e.Set(rv.Elem())
+		if err = ts.set(e, ss, v); err != nil {
+			return err
+		}
+		rv.Set(e)
+		return nil
+	}
+	return fmt.Errorf("cannot select %s of %s", s.name, rv.Type())
+}
+
+// convert v and set to dst, numbers are converted with overflow checks,
+// and strings are converted to enum members by name
+func (ts *Types) convert(dst, v reflect.Value) (err error) {
+	for v.IsValid() && v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		dst.Set(reflect.Zero(dst.Type()))
+		return
+	}
+	if v.Type().AssignableTo(dst.Type()) {
+		dst.Set(v)
+		return
+	}
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := toInt(v)
+		if err != nil {
+			return err
+		}
+		if dst.OverflowInt(i) {
+			return fmt.Errorf("%d overflows %s", i, dst.Type())
+		}
+		dst.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := toUint(v)
+		if err != nil {
+			return err
+		}
+		if dst.OverflowUint(u) {
+			return fmt.Errorf("%d overflows %s", u, dst.Type())
+		}
+		dst.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := toFloat(v)
+		if err != nil {
+			return err
+		}
+		if dst.OverflowFloat(f) {
+			return fmt.Errorf("%v overflows %s", f, dst.Type())
+		}
+		dst.SetFloat(f)
+		return nil
+	case reflect.Ptr:
+		e := reflect.New(dst.Type().Elem())
+		if err = ts.convert(e.Elem(), v); err != nil {
+			return
+		}
+		dst.Set(e)
+		return
+	case reflect.Struct:
+		if v.Kind() == reflect.String {
+			if _, ok := ts.codecOf(dst.Type()).(*enumCodec); ok {
+				return ts.SetMember(dst, v.String())
+			}
+		}
+	}
+	if v.Kind() == dst.Kind() && v.Type().ConvertibleTo(dst.Type()) {
+		dst.Set(v.Convert(dst.Type()))
+		return
+	}
+	return fmt.Errorf("cannot convert %s to %s", v.Type(), dst.Type())
+}
+
+func toInt(v reflect.Value) (i int64, err error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return 0, fmt.Errorf("%d overflows int64", v.Uint())
+		}
+		return int64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, fmt.Errorf("%v is not an int64", f)
+		}
+		return int64(f), nil
+	}
+	return 0, fmt.Errorf("cannot convert %s to int64", v.Type())
+}
+
+func toUint(v reflect.Value) (u uint64, err error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() < 0 {
+			return 0, fmt.Errorf("%d overflows uint64", v.Int())
+		}
+		return uint64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+			return 0, fmt.Errorf("%v is not an uint64", f)
+		}
+		return uint64(f), nil
+	}
+	return 0, fmt.Errorf("cannot convert %s to uint64", v.Type())
+}
+
+func toFloat(v reflect.Value) (f float64, err error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	}
+	return 0, fmt.Errorf("cannot convert %s to float64", v.Type())
+}
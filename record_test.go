@@ -0,0 +1,181 @@
+package schema_test
+
+import (
+	"github.com/fengyoulin/schema"
+	"reflect"
+	"testing"
+)
+
+const testRecordDef = `
+[{"name":"Level","type":"uint8","members":[{"name":"Low"},{"name":"High"}]},
+{"name":"Entry","fields":[
+{"name":"Name","type":"string"},
+{"name":"Level","type":"Level"},
+{"name":"unit_price","type":"float32"}
+]},
+{"name":"Basket","fields":[
+{"name":"ID","type":"uint","tags":{"json":"id"},"default":1},
+{"name":"Items","type":"[]Entry"},
+{"name":"Counts","type":"map[string]int16"},
+{"name":"Owner","type":"*Entry"},
+{"name":"Extra","type":"map[int]*Entry"},
+{"name":"Named","type":"map[string]Entry"}
+]}]
+`
+
+func TestRecord(t *testing.T) {
+	ts := newTypes(t, testRecordDef)
+	r, err := ts.New("Basket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Name() != "Basket" {
+		t.Errorf("unexpected name: %s", r.Name())
+	}
+	if id, err := r.Uint("ID"); err != nil || id != 1 {
+		t.Errorf("unexpected id: %d, error: %v", id, err)
+	}
+	it, _ := ts.TypeByName("Entry")
+	if err = r.Set("Items", reflect.MakeSlice(reflect.SliceOf(it), 2, 2).Interface()); err != nil {
+		t.Fatal(err)
+	}
+	sets := []struct {
+		path string
+		val  interface{}
+	}{
+		{"Items[1].Name", "apple"},
+		{"Items[1].Level", "High"},
+		{"Items[1].unit_price", 2},
+		{`Counts["a b"]`, 3.0},
+		{"Counts[c]", uint8(4)},
+		{"Owner.Name", "bob"},
+		{"Extra[7].Level", "High"},
+	}
+	for _, s := range sets {
+		if err = r.Set(s.path, s.val); err != nil {
+			t.Errorf("%s: %v", s.path, err)
+		}
+	}
+	if s, err := r.String("Items[1].Level"); err != nil || s != "High" {
+		t.Errorf("unexpected level: %s, error: %v", s, err)
+	}
+	if f, err := r.Float("Items[1].UnitPrice"); err != nil || f != 2 {
+		t.Errorf("unexpected price: %v, error: %v", f, err)
+	}
+	if i, err := r.Int(`Counts["a b"]`); err != nil || i != 3 {
+		t.Errorf("unexpected count: %d, error: %v", i, err)
+	}
+	if s, err := r.String("Owner.Name"); err != nil || s != "bob" {
+		t.Errorf("unexpected owner: %s, error: %v", s, err)
+	}
+	if s, err := r.String("Extra[7].Level"); err != nil || s != "High" {
+		t.Errorf("unexpected level: %s, error: %v", s, err)
+	}
+	bad := []struct {
+		path string
+		val  interface{}
+	}{
+		{"Counts[x]", 1 << 20},
+		{"Counts[x]", 1.5},
+		{"Items[2].Name", "x"},
+		{"Items[0].Level", "Medium"},
+		{"Missing", 1},
+		{"ID", -1},
+		{"Items[0].Name", 1},
+	}
+	for _, s := range bad {
+		if err = r.Set(s.path, s.val); err == nil {
+			t.Errorf("%s: expected error", s.path)
+		}
+	}
+	var names []string
+	r.Range(func(f schema.Field, v interface{}) bool {
+		names = append(names, f.Name)
+		return f.Name != "Owner"
+	})
+	if exp := []string{"ID", "Items", "Counts", "Owner"}; !reflect.DeepEqual(names, exp) {
+		t.Errorf("%v != %v", names, exp)
+	}
+	sub, err := r.Record("Items[1]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs := sub.Fields(); len(fs) != 3 || fs[2].Name != "unit_price" {
+		t.Errorf("unexpected fields: %v", fs)
+	}
+	// a map element is not addressable, the sub record is of a copy
+	nv := reflect.MakeMap(reflect.MapOf(reflect.TypeOf(""), it))
+	e := reflect.New(it).Elem()
+	e.Field(0).SetString("pear")
+	nv.SetMapIndex(reflect.ValueOf("x"), e)
+	if err = r.Set("Named", nv.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	if sub, err = r.Record("Named[x]"); err != nil {
+		t.Fatal(err)
+	}
+	if err = sub.Set("Name", "fig"); err != nil {
+		t.Fatal(err)
+	}
+	if v := reflect.ValueOf(sub.Interface()).Elem().Field(0).String(); v != "fig" {
+		t.Errorf("unexpected name: %s", v)
+	}
+	if s, err := r.String("Named[x].Name"); err != nil || s != "pear" {
+		t.Errorf("unexpected name: %s, error: %v", s, err)
+	}
+	w, err := ts.Wrap(r.Interface())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := w.Get("Items[1].Name"); err != nil || v != "apple" {
+		t.Errorf("unexpected value: %v, error: %v", v, err)
+	}
+}
+
+func TestRecord_Embedded(t *testing.T) {
+	ts := schema.New()
+	for _, s := range []schema.Schema{
+		{Name: "Audit", Fields: []schema.Field{{Name: "CreatedAt", Type: "int64"}}},
+		{Name: "Doc", Fields: []schema.Field{{Type: "*Audit", Embedded: true}, {Name: "Name", Type: "string"}}},
+	} {
+		if _, err := ts.CreateSchema(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := ts.New("Doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit := reflect.ValueOf(r.Interface()).Elem().Field(0)
+	// reads through the nil embedded pointer leave it nil
+	if v, err := r.Get("CreatedAt"); err != nil || v != int64(0) {
+		t.Errorf("unexpected value: %v, error: %v", v, err)
+	}
+	r.Range(func(f schema.Field, v interface{}) bool { return true })
+	q, err := ts.Query("Doc", "CreatedAt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vs, err := q.Eval(r.Interface()); err != nil || len(vs) != 1 || vs[0].Int() != 0 {
+		t.Errorf("unexpected values: %v, error: %v", vs, err)
+	}
+	e, err := ts.Compile("Doc", "CreatedAt == 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := e.Eval(r.Interface()); err != nil || v != true {
+		t.Errorf("unexpected result: %v, error: %v", v, err)
+	}
+	if !audit.IsNil() {
+		t.Error("embedded pointer allocated by reads")
+	}
+	if err = r.Set("CreatedAt", 5); err != nil {
+		t.Fatal(err)
+	}
+	if audit.IsNil() {
+		t.Error("embedded pointer not allocated by Set")
+	}
+	if v, err := r.Get("CreatedAt"); err != nil || v != int64(5) {
+		t.Errorf("unexpected value: %v, error: %v", v, err)
+	}
+}
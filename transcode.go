@@ -0,0 +1,669 @@
+package schema
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+)
+
+// Transcoder between the binary format and JSON, driven by the types only
+//
+// Fields are named by their json tags, with embedded structs promoted, enums
+// are member names, interfaces and unions are objects of TypeKey and ValueKey,
+// and byte slices are base64 strings. Collections are streamed element by
+// element, only the binary of a collection read from JSON is buffered, as its
+// length is written first.
+type Transcoder struct {
+	Types  *Types
+	Encode map[reflect.Type]func(reflect.Value, *Encoder) error // Extend of the Encoder
+	Decode map[reflect.Type]func(reflect.Value, *Decoder) error // Extend of the Decoder
+}
+
+// slot of a struct field in the binary, with embedded structs flattened, an
+// embedded pointer is a slot of its presence before the promoted fields
+type slot struct {
+	name  string
+	t     reflect.Type
+	owner int  // slot of the embedded pointer promoting the field, -1 if none
+	embed bool // presence of an embedded pointer
+}
+
+// ToJSON reads a value of the named type from r, as written by Encode with a
+// pointer to the type, and writes it to w as JSON
+func (tc *Transcoder) ToJSON(w io.Writer, r io.Reader, name string) (err error) {
+	t, ok := tc.Types.TypeByName(name)
+	if !ok {
+		return fmt.Errorf("unknown type: %s", name)
+	}
+	bw := bufio.NewWriter(w)
+	d := &Decoder{Reader: newStreamReader(r), Extend: tc.Decode, Types: tc.Types}
+	if err = tc.toJSON(bw, d, reflect.PtrTo(t)); err != nil {
+		return
+	}
+	return bw.Flush()
+}
+
+// FromJSON reads a JSON value of the named type from r, and writes it to w as
+// Encode with a pointer to the type, missing fields are written with their defaults
+func (tc *Transcoder) FromJSON(w io.Writer, r io.Reader, name string) (err error) {
+	t, ok := tc.Types.TypeByName(name)
+	if !ok {
+		return fmt.Errorf("unknown type: %s", name)
+	}
+	bw := bufio.NewWriter(w)
+	jd := json.NewDecoder(r)
+	jd.UseNumber()
+	if err = tc.next(tc.encoder(bw), jd, reflect.PtrTo(t)); err != nil {
+		return
+	}
+	return bw.Flush()
+}
+
+func (tc *Transcoder) encoder(w io.Writer) *Encoder {
+	return &Encoder{Writer: w, Extend: tc.Encode, Types: tc.Types}
+}
+
+// slots of a struct type, the fields of embedded structs are promoted as by
+// encoding/json, those of a nil embedded pointer are omitted
+func (tc *Transcoder) slots(t reflect.Type, ss []slot, owner int) []slot {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if promoted(sf) {
+			if sf.Type.Kind() == reflect.Struct && !tc.custom(sf.Type) {
+				ss = tc.slots(sf.Type, ss, owner)
+				continue
+			}
+			if sf.Type.Kind() == reflect.Ptr && !tc.custom(sf.Type.Elem()) {
+				ss = append(ss, slot{t: sf.Type, owner: owner, embed: true})
+				ss = tc.slots(sf.Type.Elem(), ss, len(ss)-1)
+				continue
+			}
+		}
+		nm, _ := jsonName(sf)
+		if nm == "" {
+			nm = sf.Name
+		}
+		ss = append(ss, slot{name: nm, t: sf.Type, owner: owner})
+	}
+	return ss
+}
+
+// custom reports whether a struct type is encoded by Extend or a codec
+func (tc *Transcoder) custom(t reflect.Type) bool {
+	if _, ok := tc.Decode[t]; ok {
+		return true
+	}
+	_, ok := tc.Encode[t]
+	return ok || tc.Types.codecOf(t) != nil
+}
+
+// writeJSON of a Go value
+func writeJSON(w *bufio.Writer, v interface{}) (err error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	_, err = w.Write(b)
+	return
+}
+
+// leaf reads a value of t by the Decoder
+func leaf(d *Decoder, t reflect.Type) (v reflect.Value, err error) {
+	v = reflect.New(t).Elem()
+	err = d.InternalDecode(v)
+	return
+}
+
+func (tc *Transcoder) toJSON(w *bufio.Writer, d *Decoder, t reflect.Type) (err error) {
+	br := d.byteReader()
+	if _, ok := d.Extend[t]; ok && t.Kind() == reflect.Struct {
+		v, err := leaf(d, t)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, v.Interface())
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		switch c := tc.Types.codecOf(t).(type) {
+		case *enumCodec:
+			v, err := leaf(d, t)
+			if err != nil {
+				return err
+			}
+			nm, _ := tc.Types.Member(v)
+			return writeJSON(w, nm)
+		case *unionCodec:
+			var u uint64
+			if u, err = binary.ReadUvarint(br); err != nil {
+				return
+			}
+			if u == 0 {
+				_, err = w.WriteString("null")
+				return
+			}
+			if u > uint64(len(c.types)) {
+				return fmt.Errorf("variant %d out of range of union: %s", u-1, c.name)
+			}
+			return tc.typedToJSON(w, d, c.names[u-1], c.types[u-1])
+		}
+		w.WriteByte('{')
+		ss := tc.slots(t, nil, -1)
+		absent := make([]bool, len(ss)) // of nil embedded pointers
+		first := true
+		for i, s := range ss {
+			if s.owner >= 0 && absent[s.owner] {
+				absent[i] = true
+				continue
+			}
+			if s.embed {
+				var c byte
+				if c, err = br.ReadByte(); err != nil {
+					return
+				}
+				absent[i] = c == 0
+				continue
+			}
+			if !first {
+				w.WriteByte(',')
+			}
+			first = false
+			if err = writeJSON(w, s.name); err != nil {
+				return
+			}
+			w.WriteByte(':')
+			if err = tc.toJSON(w, d, s.t); err != nil {
+				return
+			}
+		}
+		return w.WriteByte('}')
+	case reflect.Slice, reflect.Array, reflect.Map:
+		var n int64
+		if t.Kind() == reflect.Array {
+			n = int64(t.Len())
+		} else {
+			switch t.Elem().Kind() {
+			case reflect.Int8, reflect.Uint8, reflect.Bool:
+				if t.Kind() == reflect.Slice {
+					v, err := leaf(d, t)
+					if err != nil {
+						return err
+					}
+					if v.Len() == 0 {
+						_, err = w.WriteString("[]")
+						return err
+					}
+					return writeJSON(w, v.Interface())
+				}
+			}
+			if n, err = binary.ReadVarint(br); err != nil {
+				return
+			}
+		}
+		open, close := byte('['), byte(']')
+		if t.Kind() == reflect.Map {
+			open, close = '{', '}'
+		}
+		w.WriteByte(open)
+		for x := int64(0); x < n; x++ {
+			if x > 0 {
+				w.WriteByte(',')
+			}
+			if t.Kind() == reflect.Map {
+				k, err := leaf(d, t.Key())
+				if err != nil {
+					return err
+				}
+				ks, err := tc.Types.keyString(k)
+				if err != nil {
+					return err
+				}
+				if err = writeJSON(w, ks); err != nil {
+					return err
+				}
+				w.WriteByte(':')
+			}
+			if err = tc.toJSON(w, d, t.Elem()); err != nil {
+				return
+			}
+		}
+		return w.WriteByte(close)
+	case reflect.Ptr:
+		var c byte
+		if c, err = br.ReadByte(); err != nil {
+			return
+		}
+		if c == 0 {
+			_, err = w.WriteString("null")
+			return
+		}
+		return tc.toJSON(w, d, t.Elem())
+	case reflect.Interface:
+		var nm string
+		if err = d.InternalDecode(reflect.ValueOf(&nm).Elem()); err != nil {
+			return
+		}
+		if nm == "" {
+			_, err = w.WriteString("null")
+			return
+		}
+		var tp reflect.Type
+		if tp, err = tc.Types.CreateType(nm); err != nil {
+			return
+		}
+		return tc.typedToJSON(w, d, nm, tp)
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return fmt.Errorf("unexpected kind: %v", t.Kind())
+	}
+	v, err := leaf(d, t)
+	if err != nil {
+		return
+	}
+	return writeJSON(w, v.Interface())
+}
+
+func (tc *Transcoder) typedToJSON(w *bufio.Writer, d *Decoder, name string, t reflect.Type) (err error) {
+	w.WriteString(`{"` + TypeKey + `":`)
+	if err = writeJSON(w, name); err != nil {
+		return
+	}
+	w.WriteString(`,"` + ValueKey + `":`)
+	if err = tc.toJSON(w, d, t); err != nil {
+		return
+	}
+	return w.WriteByte('}')
+}
+
+// expect the token to be the delimiter
+func expect(tk json.Token, want json.Delim) error {
+	if d, ok := tk.(json.Delim); !ok || d != want {
+		return fmt.Errorf("expected %s, found %v", want, tk)
+	}
+	return nil
+}
+
+// key reads an object key, ok is false at the end of the object
+func key(jd *json.Decoder) (k string, ok bool, err error) {
+	tk, err := jd.Token()
+	if err != nil {
+		return
+	}
+	if tk == json.Delim('}') {
+		return
+	}
+	if k, ok = tk.(string); !ok {
+		return "", false, fmt.Errorf("expected key, found %v", tk)
+	}
+	return
+}
+
+// capture the JSON value starting with the token
+func capture(jd *json.Decoder, tk json.Token) (raw json.RawMessage, err error) {
+	if _, ok := tk.(json.Delim); !ok {
+		return json.Marshal(tk)
+	}
+	type level struct {
+		object bool
+		items  int
+	}
+	b := &bytes.Buffer{}
+	var stack []level
+	for {
+		if d, ok := tk.(json.Delim); ok && (d == '}' || d == ']') {
+			stack = stack[:len(stack)-1]
+			b.WriteByte(byte(d))
+		} else {
+			if n := len(stack); n > 0 {
+				l := &stack[n-1]
+				if l.items > 0 {
+					if l.object && l.items%2 == 1 {
+						b.WriteByte(':')
+					} else {
+						b.WriteByte(',')
+					}
+				}
+				l.items++
+			}
+			if d, ok := tk.(json.Delim); ok {
+				stack = append(stack, level{object: d == '{'})
+				b.WriteByte(byte(d))
+			} else {
+				var v []byte
+				if v, err = json.Marshal(tk); err != nil {
+					return
+				}
+				b.Write(v)
+			}
+		}
+		if len(stack) == 0 {
+			return b.Bytes(), nil
+		}
+		if tk, err = jd.Token(); err != nil {
+			return
+		}
+	}
+}
+
+// next value of the JSON stream as t
+func (tc *Transcoder) next(e *Encoder, jd *json.Decoder, t reflect.Type) (err error) {
+	tk, err := jd.Token()
+	if err != nil {
+		return
+	}
+	return tc.fromJSON(e, jd, t, tk)
+}
+
+// fromJSON a value starting with the token
+func (tc *Transcoder) fromJSON(e *Encoder, jd *json.Decoder, t reflect.Type, tk json.Token) (err error) {
+	if _, ok := e.Extend[t]; ok && t.Kind() == reflect.Struct {
+		return tc.leafFromJSON(e, jd, t, tk)
+	}
+	var buf [16]byte
+	switch t.Kind() {
+	case reflect.Struct:
+		switch c := tc.Types.codecOf(t).(type) {
+		case *enumCodec:
+			nm, ok := tk.(string)
+			if !ok {
+				return fmt.Errorf("expected member of enum %s, found %v", c.name, tk)
+			}
+			v := reflect.New(t).Elem()
+			if err = tc.Types.SetMember(v, nm); err != nil {
+				return
+			}
+			return e.InternalEncode(v)
+		case *unionCodec:
+			if tk == nil {
+				_, err = e.Writer.Write([]byte{0})
+				return
+			}
+			if err = expect(tk, '{'); err != nil {
+				return
+			}
+			return tc.typedFromJSON(e, jd, func(nm string) (reflect.Type, error) {
+				for i, n := range c.names {
+					if n == nm {
+						l := binary.PutUvarint(buf[:], uint64(i+1))
+						_, err := e.Writer.Write(buf[:l])
+						return c.types[i], err
+					}
+				}
+				return nil, fmt.Errorf("unknown variant of union %s: %s", c.name, nm)
+			})
+		}
+		if err = expect(tk, '{'); err != nil {
+			return
+		}
+		return tc.structFromJSON(e, jd, tc.slots(t, nil, -1))
+	case reflect.Slice, reflect.Map:
+		if tk == nil {
+			_, err = e.Writer.Write([]byte{0})
+			return
+		}
+		if _, ok := tk.(string); ok && t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return tc.leafFromJSON(e, jd, t, tk) // base64
+		}
+		open := json.Delim('[')
+		if t.Kind() == reflect.Map {
+			open = '{'
+		}
+		if err = expect(tk, open); err != nil {
+			return
+		}
+		b := &bytes.Buffer{}
+		be := tc.encoder(b)
+		var n int64
+		for ; jd.More(); n++ {
+			if t.Kind() == reflect.Map {
+				ks, _, err := key(jd)
+				if err != nil {
+					return err
+				}
+				k, err := tc.Types.parseKey(strconv.Quote(ks), t.Key())
+				if err != nil {
+					return err
+				}
+				if err = be.InternalEncode(k); err != nil {
+					return err
+				}
+			}
+			if err = tc.next(be, jd, t.Elem()); err != nil {
+				return
+			}
+		}
+		if _, err = jd.Token(); err != nil {
+			return
+		}
+		l := binary.PutVarint(buf[:], n)
+		if _, err = e.Writer.Write(buf[:l]); err != nil {
+			return
+		}
+		_, err = b.WriteTo(e.Writer)
+		return
+	case reflect.Array:
+		if err = expect(tk, '['); err != nil {
+			return
+		}
+		x := 0
+		for ; jd.More(); x++ {
+			if x >= t.Len() {
+				return fmt.Errorf("too many elements for %s", t)
+			}
+			if err = tc.next(e, jd, t.Elem()); err != nil {
+				return
+			}
+		}
+		for ; x < t.Len(); x++ {
+			if err = e.encodeDefault(t.Elem()); err != nil {
+				return
+			}
+		}
+		_, err = jd.Token()
+		return
+	case reflect.Ptr:
+		if tk == nil {
+			_, err = e.Writer.Write([]byte{0})
+			return
+		}
+		if _, err = e.Writer.Write([]byte{1}); err != nil {
+			return
+		}
+		return tc.fromJSON(e, jd, t.Elem(), tk)
+	case reflect.Interface:
+		if tk == nil {
+			return e.InternalEncode(reflect.ValueOf(new(string)).Elem())
+		}
+		if err = expect(tk, '{'); err != nil {
+			return
+		}
+		return tc.typedFromJSON(e, jd, func(nm string) (reflect.Type, error) {
+			tp, err := tc.Types.CreateType(nm)
+			if err != nil {
+				return nil, err
+			}
+			return tp, e.InternalEncode(reflect.ValueOf(&nm).Elem())
+		})
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return fmt.Errorf("unexpected kind: %v", t.Kind())
+	}
+	return tc.leafFromJSON(e, jd, t, tk)
+}
+
+func (tc *Transcoder) leafFromJSON(e *Encoder, jd *json.Decoder, t reflect.Type, tk json.Token) (err error) {
+	raw, err := capture(jd, tk)
+	if err != nil {
+		return
+	}
+	v := reflect.New(t)
+	if err = json.Unmarshal(raw, v.Interface()); err != nil {
+		return
+	}
+	return e.InternalEncode(v.Elem())
+}
+
+// structFromJSON writes the fields in the order of the slots, an embedded
+// pointer is nil unless a field promoted by it is present
+func (tc *Transcoder) structFromJSON(e *Encoder, jd *json.Decoder, ss []slot) (err error) {
+	index := make(map[string]int, len(ss))
+	for i, s := range ss {
+		if !s.embed {
+			index[s.name] = i
+		}
+	}
+	fo := newFieldOrder(e)
+	present := make([]bool, len(ss))
+	var mark func(o int) error // writes the presence of an embedded pointer
+	mark = func(o int) error {
+		if o < 0 || present[o] {
+			return nil
+		}
+		if err := mark(ss[o].owner); err != nil {
+			return err
+		}
+		present[o] = true
+		return fo.write(o, func(e *Encoder) error {
+			_, err := e.Writer.Write([]byte{1})
+			return err
+		})
+	}
+	for {
+		k, ok, err := key(jd)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		i, ok := index[k]
+		if !ok {
+			return fmt.Errorf("unknown field: %s", k)
+		}
+		if err = mark(ss[i].owner); err != nil {
+			return err
+		}
+		if err = fo.write(i, func(e *Encoder) error { return tc.next(e, jd, ss[i].t) }); err != nil {
+			return fmt.Errorf("%s: %v", k, err)
+		}
+	}
+	return fo.finish(len(ss), func(e *Encoder, i int) (err error) {
+		switch s := ss[i]; {
+		case s.owner >= 0 && !present[s.owner]:
+		case s.embed:
+			_, err = e.Writer.Write([]byte{0})
+		default:
+			err = e.encodeDefault(s.t)
+		}
+		return
+	})
+}
+
+// fieldOrder writes the fields of a struct in order, the fields out of order
+// are buffered until the previous ones are written
+type fieldOrder struct {
+	e       *Encoder
+	next    int
+	pending map[int]*bytes.Buffer
+}
+
+func newFieldOrder(e *Encoder) *fieldOrder {
+	return &fieldOrder{e: e, pending: make(map[int]*bytes.Buffer)}
+}
+
+// write the field i by fn
+func (fo *fieldOrder) write(i int, fn func(*Encoder) error) (err error) {
+	if _, dup := fo.pending[i]; dup || i < fo.next {
+		return fmt.Errorf("duplicate field")
+	}
+	if i > fo.next {
+		b := &bytes.Buffer{}
+		if err = fn(&Encoder{Writer: b, Extend: fo.e.Extend, Types: fo.e.Types}); err != nil {
+			return
+		}
+		fo.pending[i] = b
+		return
+	}
+	if err = fn(fo.e); err != nil {
+		return
+	}
+	for fo.next++; fo.pending[fo.next] != nil; fo.next++ {
+		if _, err = fo.pending[fo.next].WriteTo(fo.e.Writer); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// finish the n fields, the missing ones are written by missing
+func (fo *fieldOrder) finish(n int, missing func(*Encoder, int) error) (err error) {
+	for ; fo.next < n; fo.next++ {
+		if b := fo.pending[fo.next]; b != nil {
+			_, err = b.WriteTo(fo.e.Writer)
+		} else {
+			err = missing(fo.e, fo.next)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// typedFromJSON reads the keys of an object of TypeKey and ValueKey, set
+// writes the binary before the value for the type name
+func (tc *Transcoder) typedFromJSON(e *Encoder, jd *json.Decoder, set func(string) (reflect.Type, error)) (err error) {
+	var t reflect.Type
+	var raw json.RawMessage
+	done := false
+	for {
+		k, ok, err := key(jd)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		switch {
+		case k == TypeKey && t == nil:
+			var nm string
+			if err = jd.Decode(&nm); err != nil {
+				return err
+			}
+			if t, err = set(nm); err != nil {
+				return err
+			}
+			if raw != nil {
+				rd := json.NewDecoder(bytes.NewReader(raw))
+				rd.UseNumber()
+				if err = tc.next(e, rd, t); err != nil {
+					return err
+				}
+				done = true
+			}
+		case k == ValueKey && !done && raw == nil:
+			if t == nil { // value before type
+				if err = jd.Decode(&raw); err != nil {
+					return err
+				}
+				continue
+			}
+			if err = tc.next(e, jd, t); err != nil {
+				return err
+			}
+			done = true
+		default:
+			return fmt.Errorf("unexpected key of typed value: %s", k)
+		}
+	}
+	if t == nil {
+		return fmt.Errorf("missing %s", TypeKey)
+	}
+	if !done {
+		return e.encodeDefault(t)
+	}
+	return
+}
@@ -0,0 +1,144 @@
+package schema_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/fengyoulin/schema"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTranscoder(t *testing.T) {
+	ts := newTypes(t, testMapDef, testMapAdded...)
+	v, err := schema.FromMap(ts, "Canvas", map[string]interface{}{
+		"title":  "t",
+		"color":  "Blue",
+		"origin": map[string]interface{}{"x": 1, "y": -2},
+		"points": []interface{}{map[string]interface{}{"x": 2}, map[string]interface{}{"y": 3}},
+		"scale":  map[string]interface{}{"1": 0.5, "2": 1.5},
+		"data":   "AQID",
+		"any":    map[string]interface{}{"$type": "Point", "value": map[string]interface{}{"x": 4}},
+		"shape":  map[string]interface{}{"$type": "Label", "value": "s"},
+		"at":     "2021-05-09T11:39:05Z",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &bytes.Buffer{}
+	if err = (&schema.Encoder{Writer: b, Extend: testEnc, Types: ts}).Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	tc := &schema.Transcoder{Types: ts, Encode: testEnc, Decode: testDec}
+	j := &bytes.Buffer{}
+	if err = tc.ToJSON(j, b, "Canvas"); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`"color":"Blue"`, `"data":"AQID"`, `"shape":{"$type":"Label","value":"s"}`, `"Secret":""`} {
+		if !strings.Contains(j.String(), s) {
+			t.Errorf("missing %s in %s", s, j)
+		}
+	}
+	b.Reset()
+	if err = tc.FromJSON(b, j, "Canvas"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := ts.New("Canvas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = (&schema.Decoder{Reader: b, Extend: testDec, Types: ts}).Decode(r.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	at, _ := r.Get("At")
+	if err = r.Set("At", at.(time.Time).UTC()); err != nil {
+		t.Fatal(err)
+	}
+	b1, _ := json.Marshal(r.Interface())
+	b2, _ := json.Marshal(v)
+	if !bytes.Equal(b1, b2) {
+		t.Errorf("%s != %s", b1, b2)
+	}
+}
+
+func TestTranscoder_FromJSON(t *testing.T) {
+	ts := newTypes(t, testMapDef, testMapAdded...)
+	tc := &schema.Transcoder{Types: ts, Encode: testEnc, Decode: testDec}
+	doc := `{"shape":{"value":{"y":7},"$type":"Point"},"title":"x","origin":null,
+"any":{"$type":"Point","value":{"y":1,"x":2}},"points":[{"y":5}],"scale":{"9":2}}`
+	b := &bytes.Buffer{}
+	if err := tc.FromJSON(b, strings.NewReader(doc), "Canvas"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := ts.New("Canvas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = (&schema.Decoder{Reader: b, Extend: testDec, Types: ts}).Decode(r.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	checks := map[string]int64{"Shape.Value.Y": 7, "Any.X": 2, "Any.Y": 1, "Points[0].Y": 5, "Scale[9]": 2}
+	for p, exp := range checks {
+		if f, err := r.Float(p); err != nil || int64(f) != exp {
+			t.Errorf("%s: %v != %d, error: %v", p, f, exp, err)
+		}
+	}
+	if s, _ := r.String("Color"); s != "Red" {
+		t.Errorf("unexpected default color: %s", s)
+	}
+	for _, doc := range []string{`{"unknown":1}`, `{"color":"Green"}`, `{"title":"a","title":"b"}`, `{"any":{"value":1}}`, `{"points":[{"x":70000}]}`} {
+		if err := tc.FromJSON(&bytes.Buffer{}, strings.NewReader(doc), "Canvas"); err == nil {
+			t.Errorf("%s: expected error", doc)
+		}
+	}
+	var m map[string]interface{}
+	j := &bytes.Buffer{}
+	if err = tc.ToJSON(j, bytes.NewReader([]byte{0}), "Canvas"); err != nil || j.String() != "null" {
+		t.Errorf("unexpected null: %s, error: %v", j, err)
+	}
+	if err = json.Unmarshal(j.Bytes(), &m); err != nil || m != nil {
+		t.Errorf("unexpected map: %v, error: %v", m, err)
+	}
+}
+
+func TestTranscoder_Embedded(t *testing.T) {
+	ts := schema.New()
+	for _, s := range []schema.Schema{
+		{Name: "Audit", Fields: []schema.Field{{Name: "CreatedAt", Type: "int64", Tags: map[string]string{"json": "created_at"}}}},
+		{Name: "Base", Fields: []schema.Field{{Name: "ID", Type: "int", Tags: map[string]string{"json": "id"}}}},
+		{Name: "Doc", Fields: []schema.Field{{Type: "Base", Embedded: true}, {Type: "*Audit", Embedded: true},
+			{Name: "Name", Type: "string", Tags: map[string]string{"json": "name"}}}},
+	} {
+		if _, err := ts.CreateSchema(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tc := &schema.Transcoder{Types: ts}
+	for _, doc := range []string{`{"id":1,"name":"a"}`, `{"id":1,"created_at":5,"name":"a"}`} {
+		r, err := ts.New("Doc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = json.Unmarshal([]byte(doc), r.Interface()); err != nil {
+			t.Fatal(err)
+		}
+		b := &bytes.Buffer{}
+		if err = (&schema.Encoder{Writer: b, Types: ts}).Encode(r.Interface()); err != nil {
+			t.Fatal(err)
+		}
+		src := append([]byte(nil), b.Bytes()...)
+		j := &bytes.Buffer{}
+		if err = tc.ToJSON(j, b, "Doc"); err != nil {
+			t.Fatal(err)
+		}
+		if j.String() != doc {
+			t.Errorf("%s != %s", j, doc)
+		}
+		if err = tc.FromJSON(b, j, "Doc"); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b.Bytes(), src) {
+			t.Errorf("% x != % x", b.Bytes(), src)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package schema
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"regexp"
@@ -10,23 +11,47 @@ import (
 	"sync"
 )
 
-// Schema for a go struct
+// Schema for a go struct, or an enum if Members is not empty, or a union if Variants is not empty
 type Schema struct {
-	Name   string  `json:"name,omitempty"`
-	Fields []Field `json:"fields,omitempty"`
+	Name     string    `json:"name,omitempty"`
+	Extends  []string  `json:"extends,omitempty"` // schemas whose fields come first
+	Fields   []Field   `json:"fields,omitempty"`
+	Type     string    `json:"type,omitempty"` // underlying integer or string type of enum
+	Members  []Member  `json:"members,omitempty"`
+	Variants []Variant `json:"variants,omitempty"`
+	Rules    []string  `json:"rules,omitempty"` // bool expressions checked by Validate, see Expr
 }
 
 // Field of a struct
 type Field struct {
-	Name string            `json:"name,omitempty"`
-	Type string            `json:"type,omitempty"` // T := basic, schema, []T, map[string]T, map[T]T, [n]T, *T
+	Name string            `json:"name,omitempty"` // mapped to a Go identifier if not one, e.g. open_id to OpenID
+	Type string            `json:"type,omitempty"` // T := basic, schema, []T, map[string]T, map[T]T, [n]T, *T, struct{Name T "tag"; ...}
 	Tags map[string]string `json:"tags,omitempty"`
+	// Fields of an inline struct, which replaces the trailing "struct" of Type, e.g. "[]*struct"
+	Fields []Field `json:"fields,omitempty"`
+	// Ident overrides the Go identifier of a Name from outside Go, which is kept in schema and json tags
+	Ident string `json:"ident,omitempty"`
+	// Embedded (anonymous) field of a schema type T or *T, Name defaults to T
+	Embedded bool `json:"embedded,omitempty"`
+	// Default is a JSON literal of the field type, or a member name of enum, applied by NewValue,
+	// enum fields default to the first member
+	Default json.RawMessage `json:"default,omitempty"`
+	// Constraints checked by Validate
+	Constraints *Constraints `json:"constraints,omitempty"`
 }
 
 // Types contains the basic types and schema types
 type Types struct {
 	tm map[string]reflect.Type
 	tn map[reflect.Type]string
+	df map[reflect.Type][]defaultValue
+	vr map[reflect.Type][]fieldRule
+	fd map[reflect.Type]string // defaults and constraints of created structs
+	sm map[string]Schema
+	cd map[reflect.Type]codec
+	dv map[string]derivation
+	xr map[reflect.Type][]*Expr
+	pl map[reflect.Type]*plan // compiled for Codec
 	lk sync.RWMutex
 	os options
 }
@@ -83,6 +108,14 @@ func New(opts ...Option) *Types {
 	ts := &Types{
 		tm: tm,
 		tn: tn,
+		df: make(map[reflect.Type][]defaultValue),
+		vr: make(map[reflect.Type][]fieldRule),
+		fd: make(map[reflect.Type]string),
+		sm: make(map[string]Schema),
+		cd: make(map[reflect.Type]codec),
+		dv: make(map[string]derivation),
+		xr: make(map[reflect.Type][]*Expr),
+		pl: make(map[reflect.Type]*plan),
 	}
 	tm["bool"] = reflect.TypeOf(true)
 	tm["int"] = reflect.TypeOf(0)
@@ -106,6 +139,8 @@ func New(opts ...Option) *Types {
 	for n, t := range tm {
 		tn[t] = n
 	}
+	tn[tm["byte"]] = "uint8" // canonical names of the aliases
+	tn[tm["rune"]] = "int32"
 	for _, o := range opts {
 		o(&ts.os)
 	}
@@ -128,25 +163,234 @@ func (ts *Types) NameByType(t reflect.Type) (name string, ok bool) {
 	return
 }
 
-// AddType defined by source code
+// SchemaOf a named type, derived from the fields if it was not created by a schema
+func (ts *Types) SchemaOf(name string) (s Schema, err error) {
+	ts.lk.RLock()
+	defer ts.lk.RUnlock()
+	return ts.schemaOf(name)
+}
+
+func (ts *Types) schemaOf(name string) (s Schema, err error) {
+	if s, ok := ts.sm[name]; ok {
+		return s, nil
+	}
+	t, ok := ts.tm[name]
+	if !ok {
+		return s, fmt.Errorf("unknown type: %s", name)
+	}
+	if t.Kind() != reflect.Struct {
+		return s, fmt.Errorf("not a struct type: %s", name)
+	}
+	s.Name = name
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			return Schema{}, fmt.Errorf("unexported field: %s.%s", name, sf.Name)
+		}
+		typ, err := ts.typeString(sf.Type)
+		if err != nil {
+			return Schema{}, err
+		}
+		f := Field{
+			Name:     sf.Name,
+			Type:     typ,
+			Tags:     parseTags(sf.Tag),
+			Embedded: sf.Anonymous,
+		}
+		if nm, ok := f.Tags["schema"]; ok && nm != sf.Name {
+			f.Name, f.Ident = nm, sf.Name
+		}
+		s.Fields = append(s.Fields, f)
+	}
+	return
+}
+
+// TypeString returns the canonical definition of a type
+func (ts *Types) TypeString(t reflect.Type) (typ string, err error) {
+	ts.lk.RLock()
+	defer ts.lk.RUnlock()
+	return ts.typeString(t)
+}
+
+// Names of the registered types, sorted
+func (ts *Types) Names() (ns []string) {
+	ts.lk.RLock()
+	defer ts.lk.RUnlock()
+	for nm := range ts.tm {
+		ns = append(ns, nm)
+	}
+	sort.Strings(ns)
+	return
+}
+
+// Definition of a named type, the canonical definition of its underlying type,
+// e.g. struct{ID int; Name string}, or the kind of a basic type
+func (ts *Types) Definition(name string) (typ string, err error) {
+	ts.lk.RLock()
+	defer ts.lk.RUnlock()
+	t, ok := ts.tm[name]
+	if !ok {
+		return "", fmt.Errorf("unknown type: %s", name)
+	}
+	switch {
+	case t.Kind() <= reflect.Complex128 || t.Kind() == reflect.String:
+		return t.Kind().String(), nil
+	case t.Kind() == reflect.Interface && t.NumMethod() == 0:
+		return "interface{}", nil
+	}
+	return ts.literalString(t)
+}
+
+func (ts *Types) typeString(t reflect.Type) (typ string, err error) {
+	if nm, ok := ts.tn[t]; ok {
+		return nm, nil
+	}
+	return ts.literalString(t)
+}
+
+// literalString of a type, not by its name
+func (ts *Types) literalString(t reflect.Type) (typ string, err error) {
+	var e string
+	switch t.Kind() {
+	case reflect.Slice:
+		if e, err = ts.typeString(t.Elem()); err == nil {
+			typ = "[]" + e
+		}
+	case reflect.Array:
+		if e, err = ts.typeString(t.Elem()); err == nil {
+			typ = "[" + strconv.Itoa(t.Len()) + "]" + e
+		}
+	case reflect.Ptr:
+		if e, err = ts.typeString(t.Elem()); err == nil {
+			typ = "*" + e
+		}
+	case reflect.Struct:
+		ds := make([]string, t.NumField())
+		for i := range ds {
+			sf := t.Field(i)
+			if sf.PkgPath != "" {
+				return "", fmt.Errorf("unexported field: %s", sf.Name)
+			}
+			if e, err = ts.typeString(sf.Type); err != nil {
+				return
+			}
+			if sf.Anonymous && sf.Name == strings.TrimPrefix(e, "*") {
+				ds[i] = e
+			} else {
+				ds[i] = sf.Name + " " + e
+			}
+			if sf.Tag != "" {
+				ds[i] += " " + strconv.Quote(string(sf.Tag))
+			}
+		}
+		typ = "struct{" + strings.Join(ds, "; ") + "}"
+	case reflect.Map:
+		var k string
+		if k, err = ts.typeString(t.Key()); err != nil {
+			return
+		}
+		if e, err = ts.typeString(t.Elem()); err == nil {
+			typ = "map[" + k + "]" + e
+		}
+	default:
+		err = fmt.Errorf("unknown type: %s", t)
+	}
+	return
+}
+
+// parseTags of a struct field in the conventional format
+func parseTags(tag reflect.StructTag) (tags map[string]string) {
+	s := string(tag)
+	for s != "" {
+		s = strings.TrimLeft(s, " ")
+		i := strings.Index(s, `:"`)
+		if i <= 0 {
+			break
+		}
+		k := s[:i]
+		s = s[i+1:]
+		j := 1
+		for j < len(s) && s[j] != '"' {
+			if s[j] == '\\' {
+				j++
+			}
+			j++
+		}
+		if j >= len(s) {
+			break
+		}
+		v, err := strconv.Unquote(s[:j+1])
+		if err != nil {
+			break
+		}
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		tags[k] = v
+		s = s[j+1:]
+	}
+	return
+}
+
+// AddType defined by source code, a type generated for a created schema
+// replaces it, with its defaults, constraints, rules and codec
 func (ts *Types) AddType(t reflect.Type) (err error) {
 	nm := t.Name()
 	if !ir.MatchString(nm) {
 		return fmt.Errorf("invalid type name: %s", nm)
 	}
 	ts.lk.RLock()
-	_, ok := ts.tm[nm]
+	o, ok := ts.tm[nm]
 	ts.lk.RUnlock()
-	if ok {
+	if ok && (o == t || o.Name() != "" || !sameStruct(o, t)) {
 		return
 	}
 	ts.lk.Lock()
 	defer ts.lk.Unlock()
+	if o, ok = ts.tm[nm]; ok {
+		if o == t || o.Name() != "" || !sameStruct(o, t) {
+			return
+		}
+		ts.rebind(o, t)
+	}
 	ts.tm[nm] = t
 	ts.tn[t] = nm
 	return
 }
 
+// sameStruct checks o created by a schema is the underlying type of t
+func sameStruct(o, t reflect.Type) bool {
+	if o.Kind() != reflect.Struct || t.Kind() != reflect.Struct || o.NumField() != t.NumField() {
+		return false
+	}
+	fs := make([]reflect.StructField, t.NumField())
+	for i := range fs {
+		if fs[i] = t.Field(i); fs[i].PkgPath != "" {
+			return false
+		}
+		fs[i].Index, fs[i].Offset = nil, 0
+	}
+	u, err := structOf(fs)
+	return err == nil && u == o
+}
+
+// rebind what is registered for o to t
+func (ts *Types) rebind(o, t reflect.Type) {
+	if dv, ok := ts.df[o]; ok {
+		ts.df[t] = dv
+	}
+	if fr, ok := ts.vr[o]; ok {
+		ts.vr[t] = fr
+	}
+	if xs, ok := ts.xr[o]; ok {
+		ts.xr[t] = xs
+	}
+	if c, ok := ts.cd[o]; ok {
+		ts.cd[t] = c
+		ts.pl = make(map[reflect.Type]*plan) // compiled without the codec
+	}
+}
+
 // CreateSchema a schema from definition
 func (ts *Types) CreateSchema(s Schema) (t reflect.Type, err error) {
 	ts.lk.RLock()
@@ -180,29 +424,189 @@ func (ts *Types) createSchema(s Schema) (t reflect.Type, err error) {
 	if !ir.MatchString(s.Name) {
 		return nil, fmt.Errorf("invalid schema name: %s", s.Name)
 	}
-	fs := make([]reflect.StructField, len(s.Fields))
-	for i, f := range s.Fields {
-		if !ir.MatchString(f.Name) {
+	if len(s.Members) > 0 {
+		return ts.createEnum(s)
+	}
+	if len(s.Variants) > 0 {
+		return ts.createUnion(s)
+	}
+	if s.Type != "" {
+		return nil, fmt.Errorf("enum without members: %s", s.Name)
+	}
+	fields := s.Fields
+	if len(s.Extends) > 0 {
+		fields = nil
+		for _, b := range s.Extends {
+			if _, err = ts.createType(b); err != nil {
+				return nil, err
+			}
+			bs, err := ts.schemaOf(b)
+			if err != nil {
+				return nil, err
+			}
+			if len(bs.Fields) == 0 && (len(bs.Members) > 0 || len(bs.Variants) > 0) {
+				return nil, fmt.Errorf("extends non-struct schema: %s", b)
+			}
+			fs, err := ts.fieldsOf(b) // with the fields of its extends
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, fs...)
+		}
+		fields = append(fields, s.Fields...)
+	}
+	t, err = ts.createStruct(fields)
+	if err != nil {
+		return nil, err
+	}
+	var xs []*Expr
+	for _, r := range s.Rules {
+		e, err := ts.compileExpr(t, r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule of schema: %s, error: %v", s.Name, err)
+		}
+		if e.typ != exprBool && e.typ != exprAny {
+			return nil, fmt.Errorf("invalid rule of schema: %s, %s type: %s", s.Name, e.typ, r)
+		}
+		xs = append(xs, e)
+	}
+	if len(xs) > 0 {
+		ts.xr[t] = xs
+	}
+	ts.tm[s.Name] = t
+	ts.tn[t] = s.Name
+	ts.sm[s.Name] = s
+	return
+}
+
+// fieldsOf a struct schema with the fields of extends in place
+func (ts *Types) fieldsOf(name string) (fs []Field, err error) {
+	s, err := ts.schemaOf(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Members) > 0 || len(s.Variants) > 0 {
+		return nil, fmt.Errorf("not a struct schema: %s", name)
+	}
+	for _, b := range s.Extends {
+		bs, err := ts.fieldsOf(b)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, bs...)
+	}
+	return append(fs, s.Fields...), nil
+}
+
+// createStruct type from fields, with defaults and constraints registered
+func (ts *Types) createStruct(fields []Field) (t reflect.Type, err error) {
+	fs := make([]reflect.StructField, len(fields))
+	var dv []defaultValue
+	fr := make([]fieldRule, len(fields))
+	var sig strings.Builder // of defaults and constraints
+	seen := make(map[string]string, len(fields))
+	for i, f := range fields {
+		if f.Embedded {
+			if len(f.Fields) > 0 || !ir.MatchString(strings.TrimPrefix(f.Type, "*")) {
+				return nil, fmt.Errorf("invalid embedded type: %s", f.Type)
+			}
+			if f.Name == "" {
+				f.Name = strings.TrimPrefix(f.Type, "*")
+			}
+		}
+		ident := f.Ident
+		if ident == "" {
+			ident = f.Name
+			if !ir.MatchString(ident) {
+				ident = mangle(ident)
+			}
+		}
+		if !ir.MatchString(ident) {
 			return nil, fmt.Errorf("invalid field name: %s", f.Name)
 		}
-		t, err := ts.createType(f.Type)
+		if n, ok := seen[ident]; ok {
+			return nil, fmt.Errorf("field name collision: %s and %s both map to %s", n, f.Name, ident)
+		}
+		seen[ident] = f.Name
+		tagm := f.Tags
+		if ident != f.Name && !f.Embedded { // external name
+			tagm = make(map[string]string, len(f.Tags)+2)
+			for k, v := range f.Tags {
+				tagm[k] = v
+			}
+			tagm["schema"] = f.Name
+			if _, ok := tagm["json"]; !ok {
+				tagm["json"] = f.Name
+			}
+		}
+		typ := f.Type
+		if len(f.Fields) > 0 { // inline struct
+			if typ == "" {
+				typ = "struct"
+			}
+			if !strings.HasSuffix(typ, "struct") {
+				return nil, fmt.Errorf("inline fields without struct type: %s", f.Name)
+			}
+			st, err := ts.createStruct(f.Fields)
+			if err != nil {
+				return nil, err
+			}
+			nm, err := ts.typeString(st)
+			if err != nil {
+				return nil, err
+			}
+			ts.tm[nm] = st
+			if _, ok := ts.tn[st]; !ok {
+				ts.tn[st] = nm
+			}
+			typ = strings.TrimSuffix(typ, "struct") + nm
+		}
+		t, err := ts.createType(typ)
 		if err != nil {
 			return nil, err
 		}
-		tags := make([]string, 0, len(f.Tags))
-		for k, v := range f.Tags {
+		tags := make([]string, 0, len(tagm))
+		for k, v := range tagm {
 			tags = append(tags, k+`:"`+v+`"`)
 		}
 		sort.Strings(tags)
 		fs[i] = reflect.StructField{
-			Name: f.Name,
-			Type: t,
-			Tag:  reflect.StructTag(strings.Join(tags, " ")),
+			Name:      ident,
+			Type:      t,
+			Tag:       reflect.StructTag(strings.Join(tags, " ")),
+			Anonymous: f.Embedded,
+		}
+		def, err := ts.enumDefault(t, f.Default)
+		if err != nil {
+			return nil, fmt.Errorf("invalid default of field: %s, error: %v", f.Name, err)
+		}
+		if len(def) > 0 {
+			if err = json.Unmarshal(def, reflect.New(t).Interface()); err != nil {
+				return nil, fmt.Errorf("invalid default of field: %s, error: %v", f.Name, err)
+			}
+			dv = append(dv, defaultValue{index: i, value: def})
+		} else if _, ok := ts.df[t]; ok { // nested struct with defaults
+			dv = append(dv, defaultValue{index: i})
 		}
+		r, err := compileRule(f.Constraints, t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid constraints of field: %s, error: %v", f.Name, err)
+		}
+		fr[i] = fieldRule{index: i, name: f.Name, rule: r, embedded: f.Embedded}
+		c, _ := json.Marshal(f.Constraints)
+		fmt.Fprintf(&sig, "%d:%s:%s;", i, def, c)
 	}
-	t = reflect.StructOf(fs)
-	ts.tm[s.Name] = t
-	ts.tn[t] = s.Name
+	if t, err = structOf(fs); err != nil {
+		return nil, err
+	}
+	if s, ok := ts.fd[t]; ok && s != sig.String() {
+		return nil, fmt.Errorf("defaults or constraints conflicting with an identical struct: %s", t)
+	}
+	ts.fd[t] = sig.String()
+	if len(dv) > 0 {
+		ts.df[t] = dv
+	}
+	ts.vr[t] = fr
 	return
 }
 
@@ -217,6 +621,14 @@ func (ts *Types) createType(typ string) (t reflect.Type, err error) {
 			return nil, err
 		}
 		t = reflect.SliceOf(e)
+	} else if strings.HasPrefix(typ, "struct{") { // struct{Name T "tag"; ...}
+		fs, err := parseStruct(typ)
+		if err != nil {
+			return nil, err
+		}
+		if t, err = ts.createStruct(fs); err != nil {
+			return nil, err
+		}
 	} else if strings.HasPrefix(typ, "map[string]") { // map[string]T
 		e, err := ts.createType(typ[11:])
 		if err != nil {
@@ -264,6 +676,131 @@ func (ts *Types) createType(typ string) (t reflect.Type, err error) {
 		return nil, fmt.Errorf("unknown type: %s", typ)
 	}
 	ts.tm[typ] = t
-	ts.tn[t] = typ
+	if _, ok := ts.tn[t]; !ok {
+		ts.tn[t] = typ
+	}
 	return
 }
+
+// mangle a name from outside Go to an exported identifier, e.g. open_id to OpenID
+func mangle(name string) string {
+	var b strings.Builder
+	up := true
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z':
+			if up {
+				r -= 'a' - 'A'
+			}
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		default:
+			up = true
+			continue
+		}
+		if b.Len() == 0 && r >= '0' && r <= '9' {
+			b.WriteByte('X')
+		}
+		b.WriteRune(r)
+		up = false
+	}
+	s := b.String()
+	for _, w := range initialisms {
+		if strings.HasSuffix(s, w[:1]+strings.ToLower(w[1:])) {
+			s = s[:len(s)-len(w)] + w
+		}
+	}
+	return s
+}
+
+// initialisms kept upper case at the end of a mangled name
+var initialisms = []string{"ID", "URL", "UUID", "API", "HTTP", "JSON"}
+
+// structOf returns the panic of reflect.StructOf as error, e.g. for duplicate fields
+func structOf(fs []reflect.StructField) (t reflect.Type, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return reflect.StructOf(fs), nil
+}
+
+// parseStruct definition in the form of struct{Name T "tag"; ...}
+func parseStruct(typ string) (fs []Field, err error) {
+	if !strings.HasSuffix(typ, "}") {
+		return nil, fmt.Errorf("invalid struct type: %s", typ)
+	}
+	for _, d := range splitTop(typ[7:len(typ)-1], ';') {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+		i := strings.IndexByte(d, ' ')
+		if i < 0 {
+			i = len(d)
+		}
+		f := Field{Name: d[:i]}
+		rest := strings.TrimSpace(d[i:])
+		if rest == "" || rest[0] == '"' || rest[0] == '`' { // embedded
+			f.Name, f.Type, f.Embedded = "", f.Name, true
+		}
+		if j := indexTop(rest, '"', '`'); j >= 0 {
+			tag, err := strconv.Unquote(rest[j:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid struct tag: %s", rest[j:])
+			}
+			f.Tags = parseTags(reflect.StructTag(tag))
+			rest = strings.TrimSpace(rest[:j])
+		}
+		if !f.Embedded {
+			f.Type = rest
+		}
+		fs = append(fs, f)
+	}
+	return
+}
+
+// splitTop splits s by sep outside brackets and quotes
+func splitTop(s string, sep byte) (ss []string) {
+	for {
+		i := indexTop(s, sep)
+		if i < 0 {
+			return append(ss, s)
+		}
+		ss = append(ss, s[:i])
+		s = s[i+1:]
+	}
+}
+
+// indexTop of the first of cs outside brackets and quotes
+func indexTop(s string, cs ...byte) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		if depth == 0 {
+			for _, x := range cs {
+				if c == x {
+					return i
+				}
+			}
+		}
+		switch c {
+		case '"', '`':
+			quote = c
+		case '{', '[', '(':
+			depth++
+		case '}', ']', ')':
+			depth--
+		}
+	}
+	return -1
+}
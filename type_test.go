@@ -1,6 +1,7 @@
 package schema_test
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
 	"github.com/fengyoulin/schema"
@@ -32,6 +33,31 @@ func init() {
 	testTypes = schema.New()
 }
 
+// newTypes of the schemas defined in JSON, after adding the Go types
+func newTypes(t testing.TB, def string, added ...reflect.Type) *schema.Types {
+	var ss []schema.Schema
+	if err := json.Unmarshal([]byte(def), &ss); err != nil {
+		t.Fatal(err)
+	}
+	return createTypes(t, ss, added...)
+}
+
+// createTypes of the schemas, after adding the Go types
+func createTypes(t testing.TB, ss []schema.Schema, added ...reflect.Type) *schema.Types {
+	ts := schema.New()
+	for _, a := range added {
+		if err := ts.AddType(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, s := range ss {
+		if _, err := ts.CreateSchema(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ts
+}
+
 func TestTypes_AddType(t *testing.T) {
 	tp := reflect.TypeOf(time.Time{})
 	if err := testTypes.AddType(tp); err != nil {
@@ -84,3 +110,205 @@ func TestTypes_NameByType(t *testing.T) {
 		t.Errorf("unexpected name: %s", nm)
 	}
 }
+
+func TestTypes_CreateSchemaInline(t *testing.T) {
+	const def = `{"name":"Person","fields":[
+{"name":"Name","type":"string"},
+{"name":"Addresses","type":"[]*struct","tags":{"json":"addresses"},"fields":[
+{"name":"City","type":"string","tags":{"json":"city"}},
+{"name":"Zip","type":"uint32","default":100000}
+]},
+{"name":"Phones","type":"map[string]struct{Number string \"json:\\\"number\\\"\"; Ext []uint16}"}
+]}`
+	var s schema.Schema
+	if err := json.Unmarshal([]byte(def), &s); err != nil {
+		t.Fatal(err)
+	}
+	ts := schema.New()
+	tp, err := ts.CreateSchema(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := tp.Field(1).Type.Elem().Elem()
+	if at.Kind() != reflect.Struct || at.Name() != "" || at.Field(0).Tag.Get("json") != "city" {
+		t.Errorf("unexpected type: %v", at)
+	}
+	nm, ok := ts.NameByType(at)
+	if exp := `struct{City string "json:\"city\""; Zip uint32}`; !ok || nm != exp {
+		t.Errorf("%s != %s", nm, exp)
+	}
+	if ct, err := ts.CreateType(nm); err != nil || ct != at {
+		t.Errorf("unexpected type: %v, error: %v", ct, err)
+	}
+	pt := tp.Field(2).Type.Elem()
+	if pt.Field(0).Tag.Get("json") != "number" || pt.Field(1).Type != reflect.TypeOf([]uint16{}) {
+		t.Errorf("unexpected type: %v", pt)
+	}
+	v, err := ts.NewValue("Person")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal([]byte(`{"addresses":[{"city":"x"}]}`), v.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	if av, err := ts.NewValue(nm); err != nil {
+		t.Fatal(err)
+	} else if z := av.Elem().Field(1).Uint(); z != 100000 {
+		t.Errorf("unexpected default: %d", z)
+	}
+	if _, err = ts.CreateType("struct{Bad}"); err == nil {
+		t.Error("expected error")
+	}
+	// an identical inline struct is shared, unless with other defaults or constraints
+	for _, c := range []struct {
+		name, zip string
+		ok        bool
+	}{
+		{"Same", `"default":100000`, true},
+		{"OtherDefault", `"default":1`, false},
+		{"OtherConstraints", `"default":100000,"constraints":{"max":5}`, false},
+	} {
+		def := `{"name":"` + c.name + `","fields":[{"name":"Address","type":"struct","fields":[` +
+			`{"name":"City","type":"string","tags":{"json":"city"}},{"name":"Zip","type":"uint32",` + c.zip + `}]}]}`
+		if err = json.Unmarshal([]byte(def), &s); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = ts.CreateSchema(s); (err == nil) != c.ok {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		}
+	}
+}
+
+func TestTypes_CreateSchemaEmbedded(t *testing.T) {
+	const def = `[{"name":"Audit","fields":[
+{"name":"CreatedAt","type":"int64","tags":{"json":"created_at"}},
+{"name":"UpdatedAt","type":"int64","tags":{"json":"updated_at"},"constraints":{"min":1}},
+{"name":"DeletedAt","type":"*int64","tags":{"json":"deleted_at,omitempty"}}
+]},
+{"name":"User","fields":[
+{"type":"Audit","embedded":true},
+{"name":"Name","type":"string","tags":{"json":"name"}}
+]},
+{"name":"Group","extends":["Audit"],"fields":[
+{"name":"Name","type":"string","tags":{"json":"name"}}
+]}]`
+	var ss []schema.Schema
+	if err := json.Unmarshal([]byte(def), &ss); err != nil {
+		t.Fatal(err)
+	}
+	ts := schema.New()
+	for _, s := range ss {
+		if _, err := ts.CreateSchema(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const doc = `{"created_at":1,"updated_at":0,"name":"x"}`
+	var bs [][]byte
+	for _, nm := range []string{"User", "Group"} {
+		v, err := ts.NewValue(nm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = json.Unmarshal([]byte(doc), v.Interface()); err != nil {
+			t.Fatal(err)
+		}
+		if b, err := json.Marshal(v.Interface()); err != nil || string(b) != doc {
+			t.Errorf("%s != %s, error: %v", b, doc, err)
+		}
+		es, _ := ts.Validate(v.Interface()).(schema.FieldErrors)
+		if len(es) != 1 || es[0].Path != "UpdatedAt" {
+			t.Errorf("unexpected errors: %v", es)
+		}
+		b := &bytes.Buffer{}
+		if err = (&schema.Encoder{Writer: b}).Encode(v.Interface()); err != nil {
+			t.Fatal(err)
+		}
+		bs = append(bs, b.Bytes())
+	}
+	if !bytes.Equal(bs[0], bs[1]) {
+		t.Errorf("%v != %v", bs[0], bs[1])
+	}
+	ut, _ := ts.TypeByName("User")
+	st, err := ts.TypeString(reflect.StructOf([]reflect.StructField{ut.Field(0), {Name: "Size", Type: reflect.TypeOf(0)}}))
+	if exp := `struct{Audit; Size int}`; err != nil || st != exp {
+		t.Errorf("%s != %s, error: %v", st, exp, err)
+	}
+	if _, err = ts.CreateType(st); err != nil {
+		t.Error(err)
+	}
+	dup := schema.Schema{Name: "Dup", Extends: []string{"Audit"}, Fields: []schema.Field{{Name: "CreatedAt", Type: "string"}}}
+	if _, err = ts.CreateSchema(dup); err == nil {
+		t.Error("expected duplicate field error")
+	}
+	// extends of extends are flattened as by Pick and Converter
+	for _, s := range []schema.Schema{
+		{Name: "A", Fields: []schema.Field{{Name: "X", Type: "int"}}},
+		{Name: "B", Extends: []string{"A"}, Fields: []schema.Field{{Name: "Y", Type: "int"}}},
+		{Name: "C", Extends: []string{"B"}, Fields: []schema.Field{{Name: "Z", Type: "int"}}},
+	} {
+		if _, err = ts.CreateSchema(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ct, _ := ts.TypeByName("C")
+	if st := ct.String(); st != "struct { X int; Y int; Z int }" {
+		t.Errorf("unexpected type: %s", st)
+	}
+	if _, err = ts.Pick("C", "CZ", "Z"); err != nil {
+		t.Fatal(err)
+	}
+	cv, err := ts.Converter("C", "CZ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zt, _ := ts.TypeByName("CZ")
+	src, dst := reflect.New(ct).Elem(), reflect.New(zt).Elem()
+	src.Field(2).SetInt(3)
+	cv(dst, src)
+	if z := dst.Field(0).Int(); z != 3 {
+		t.Errorf("unexpected Z: %d", z)
+	}
+}
+
+func TestTypes_CreateSchemaExternalNames(t *testing.T) {
+	const def = `{"name":"Imported","fields":[
+{"name":"open_id","type":"string"},
+{"name":"userName","type":"string","tags":{"json":"user_name,omitempty"}},
+{"name":"x-trace-url","type":"string"},
+{"name":"2fa","type":"bool"},
+{"name":"kind","ident":"Type","type":"uint8"}
+]}`
+	var s schema.Schema
+	if err := json.Unmarshal([]byte(def), &s); err != nil {
+		t.Fatal(err)
+	}
+	ts := schema.New()
+	tp, err := ts.CreateSchema(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []struct{ name, json string }{
+		{"OpenID", "open_id"},
+		{"UserName", "user_name,omitempty"},
+		{"XTraceURL", "x-trace-url"},
+		{"X2fa", "2fa"},
+		{"Type", "kind"},
+	}
+	for i, e := range exp {
+		f := tp.Field(i)
+		if f.Name != e.name || f.Tag.Get("json") != e.json || f.Tag.Get("schema") != s.Fields[i].Name {
+			t.Errorf("unexpected field: %s %s", f.Name, f.Tag)
+		}
+	}
+	v := reflect.New(tp)
+	if err = json.Unmarshal([]byte(`{"open_id":"a","2fa":true,"kind":3}`), v.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	if v.Elem().Field(0).String() != "a" || !v.Elem().Field(3).Bool() || v.Elem().Field(4).Uint() != 3 {
+		t.Errorf("unexpected value: %v", v.Elem())
+	}
+	bad := schema.Schema{Name: "Bad", Fields: []schema.Field{{Name: "open_id", Type: "int"}, {Name: "openId", Type: "int"}}}
+	if _, err = ts.CreateSchema(bad); err == nil {
+		t.Error("expected collision error")
+	}
+}
@@ -0,0 +1,142 @@
+package schema
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+)
+
+// Variant of a union schema
+type Variant struct {
+	Name string `json:"name,omitempty"`
+	Type string `json:"type,omitempty"`
+}
+
+type unionCodec struct {
+	name  string
+	names []string
+	types []reflect.Type
+}
+
+// variant index of a union value, -1 for empty
+func (c *unionCodec) variant(rv reflect.Value) (i int, err error) {
+	nm := rv.Field(0).String()
+	val := rv.Field(1)
+	if nm == "" {
+		if val.IsNil() {
+			return -1, nil
+		}
+		i = -1
+		for x, t := range c.types {
+			if t == val.Elem().Type() {
+				if i >= 0 {
+					return 0, fmt.Errorf("ambiguous variant of union %s: %s", c.name, t)
+				}
+				i = x
+			}
+		}
+		if i < 0 {
+			return 0, fmt.Errorf("invalid type of union %s: %s", c.name, val.Elem().Type())
+		}
+		return
+	}
+	for x, n := range c.names {
+		if n == nm {
+			if val.IsNil() || val.Elem().Type() != c.types[x] {
+				return 0, fmt.Errorf("invalid value of variant %s.%s", c.name, nm)
+			}
+			return x, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown variant of union %s: %s", c.name, nm)
+}
+
+func (c *unionCodec) encode(rv reflect.Value, e *Encoder) (err error) {
+	i, err := c.variant(rv)
+	if err != nil {
+		return
+	}
+	var buf [16]byte
+	n := binary.PutUvarint(buf[:], uint64(i+1))
+	if _, err = e.Writer.Write(buf[:n]); err != nil || i < 0 {
+		return
+	}
+	return e.InternalEncode(rv.Field(1).Elem())
+}
+
+func (c *unionCodec) decode(rv reflect.Value, d *Decoder) (err error) {
+	u, err := binary.ReadUvarint(d.byteReader())
+	if err != nil {
+		return
+	}
+	if u == 0 {
+		rv.Set(reflect.Zero(rv.Type()))
+		return
+	}
+	if u > uint64(len(c.types)) {
+		return fmt.Errorf("variant %d out of range of union: %s", u-1, c.name)
+	}
+	val := reflect.New(c.types[u-1]).Elem()
+	if err = d.InternalDecode(val); err != nil {
+		return
+	}
+	rv.Field(0).SetString(c.names[u-1])
+	rv.Field(1).Set(val)
+	return
+}
+
+// SetVariant of a union value, the value must be of the declared variant type
+func (ts *Types) SetVariant(v reflect.Value, name string, value interface{}) error {
+	c, _ := ts.codecOf(v.Type()).(*unionCodec)
+	if c == nil {
+		return fmt.Errorf("%s is not union", v.Type())
+	}
+	for i, n := range c.names {
+		if n != name {
+			continue
+		}
+		if reflect.TypeOf(value) != c.types[i] {
+			return fmt.Errorf("invalid type of variant %s.%s: %T", c.name, name, value)
+		}
+		v.Field(0).SetString(name)
+		v.Field(1).Set(reflect.ValueOf(value))
+		return nil
+	}
+	return fmt.Errorf("unknown variant of union %s: %s", c.name, name)
+}
+
+func (ts *Types) createUnion(s Schema) (t reflect.Type, err error) {
+	if len(s.Fields) > 0 || len(s.Members) > 0 {
+		return nil, fmt.Errorf("union with fields or members: %s", s.Name)
+	}
+	c := &unionCodec{name: s.Name}
+	for _, v := range s.Variants {
+		if !ir.MatchString(v.Name) {
+			return nil, fmt.Errorf("invalid variant name: %s", v.Name)
+		}
+		for _, n := range c.names {
+			if n == v.Name {
+				return nil, fmt.Errorf("duplicate variant of union %s: %s", s.Name, v.Name)
+			}
+		}
+		vt, err := ts.createType(v.Type)
+		if err != nil {
+			return nil, err
+		}
+		c.names = append(c.names, v.Name)
+		c.types = append(c.types, vt)
+	}
+	t = reflect.StructOf([]reflect.StructField{{
+		Name: "Variant",
+		Type: reflect.TypeOf(""),
+		Tag:  reflect.StructTag(`union:"` + s.Name + `"`),
+	}, {
+		Name: "Value",
+		Type: reflect.TypeOf((*interface{})(nil)).Elem(),
+	}})
+	ts.tm[s.Name] = t
+	ts.tn[t] = s.Name
+	ts.sm[s.Name] = s
+	ts.cd[t] = c
+	return
+}
@@ -0,0 +1,65 @@
+package schema_test
+
+import (
+	"bytes"
+	"github.com/fengyoulin/schema"
+	"reflect"
+	"testing"
+)
+
+const testUnionDef = `
+[{"name":"Click","fields":[{"name":"X","type":"int"},{"name":"Y","type":"int"}]},
+{"name":"Key","fields":[{"name":"Code","type":"uint16"}]},
+{"name":"Event","variants":[{"name":"Click","type":"Click"},{"name":"Key","type":"Key"},{"name":"Text","type":"string"}]},
+{"name":"Log","fields":[{"name":"Seq","type":"uint"},{"name":"Events","type":"[]Event"}]}]
+`
+
+func TestTypes_CreateUnion(t *testing.T) {
+	ts := newTypes(t, testUnionDef)
+	v, err := ts.NewValue("Log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	et, _ := ts.TypeByName("Event")
+	kt, _ := ts.TypeByName("Key")
+	key := reflect.New(kt).Elem()
+	key.Field(0).SetUint(13)
+	es := reflect.MakeSlice(reflect.SliceOf(et), 3, 3)
+	if err = ts.SetVariant(es.Index(0), "Key", key.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	if err = ts.SetVariant(es.Index(1), "Text", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if err = ts.SetVariant(es.Index(2), "Click", "hi"); err == nil {
+		t.Error("expected invalid type error")
+	}
+	v.Elem().Field(0).SetUint(1)
+	v.Elem().Field(1).Set(es)
+	b := &bytes.Buffer{}
+	if err = (&schema.Encoder{Writer: b, Types: ts}).Encode(v.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	exp := []byte{1, 1, 6, 2, 13, 3, 4, 'h', 'i', 0}
+	if !bytes.Equal(b.Bytes(), exp) {
+		t.Errorf("%v != %v", b.Bytes(), exp)
+	}
+	o, _ := ts.NewValue("Log")
+	if err = (&schema.Decoder{Reader: bytes.NewReader(exp), Types: ts}).Decode(o.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(o.Interface(), v.Interface()) {
+		t.Errorf("%v != %v", o.Interface(), v.Interface())
+	}
+	bad, _ := ts.NewValue("Log")
+	if err = (&schema.Decoder{Reader: bytes.NewReader([]byte{1, 1, 2, 4}), Types: ts}).Decode(bad.Interface()); err == nil {
+		t.Error("expected out of range error")
+	}
+	o.Elem().Field(1).Index(1).Field(1).Set(reflect.ValueOf(3.14))
+	if err = (&schema.Encoder{Writer: b, Types: ts}).Encode(o.Interface()); err == nil {
+		t.Error("expected invalid value error")
+	}
+	if err = ts.Validate(o.Interface()); err == nil {
+		t.Error("expected validation error")
+	}
+}
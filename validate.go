@@ -0,0 +1,290 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Constraints on the value of a field, checked by Validate
+type Constraints struct {
+	Required bool              `json:"required,omitempty"` // not a zero value
+	Min      *float64          `json:"min,omitempty"`      // for numbers
+	Max      *float64          `json:"max,omitempty"`      // for numbers
+	MinLen   *int              `json:"min_len,omitempty"`  // for string, slice, array and map
+	MaxLen   *int              `json:"max_len,omitempty"`  // for string, slice, array and map
+	Pattern  string            `json:"pattern,omitempty"`  // for string
+	Enum     []json.RawMessage `json:"enum,omitempty"`     // allowed values
+	Key      *Constraints      `json:"key,omitempty"`      // for keys of map
+	Elem     *Constraints      `json:"elem,omitempty"`     // for elements of slice, array and map
+}
+
+// FieldError describes a problem with the value at a path
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// FieldErrors collected from a value
+type FieldErrors []FieldError
+
+func (es FieldErrors) Error() string {
+	ss := make([]string, len(es))
+	for i, e := range es {
+		ss[i] = e.Error()
+	}
+	return strings.Join(ss, "; ")
+}
+
+type rule struct {
+	c    *Constraints
+	re   *regexp.Regexp
+	enum []reflect.Value
+	key  *rule
+	elem *rule
+}
+
+type fieldRule struct {
+	index    int
+	name     string
+	rule     *rule // nil if no constraints
+	embedded bool  // fields are promoted
+}
+
+// compileRule checks the constraints for type t
+func compileRule(c *Constraints, t reflect.Type) (r *rule, err error) {
+	if c == nil {
+		return
+	}
+	r = &rule{c: c}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if c.Min != nil || c.Max != nil {
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64:
+		default:
+			return nil, fmt.Errorf("min/max on non-numeric type: %s", t)
+		}
+		if c.Min != nil && c.Max != nil && *c.Min > *c.Max {
+			return nil, fmt.Errorf("min %v greater than max %v", *c.Min, *c.Max)
+		}
+	}
+	if c.MinLen != nil || c.MaxLen != nil {
+		switch t.Kind() {
+		case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		default:
+			return nil, fmt.Errorf("length on type without length: %s", t)
+		}
+		if c.MinLen != nil && *c.MinLen < 0 || c.MaxLen != nil && *c.MaxLen < 0 {
+			return nil, fmt.Errorf("negative length bound")
+		}
+		if c.MinLen != nil && c.MaxLen != nil && *c.MinLen > *c.MaxLen {
+			return nil, fmt.Errorf("min_len %d greater than max_len %d", *c.MinLen, *c.MaxLen)
+		}
+	}
+	if c.Pattern != "" {
+		if t.Kind() != reflect.String {
+			return nil, fmt.Errorf("pattern on non-string type: %s", t)
+		}
+		if r.re, err = regexp.Compile(c.Pattern); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range c.Enum {
+		v := reflect.New(t)
+		if err = json.Unmarshal(e, v.Interface()); err != nil {
+			return nil, fmt.Errorf("invalid enum value: %s, error: %v", e, err)
+		}
+		r.enum = append(r.enum, v.Elem())
+	}
+	if c.Key != nil {
+		if t.Kind() != reflect.Map {
+			return nil, fmt.Errorf("key constraints on non-map type: %s", t)
+		}
+		if r.key, err = compileRule(c.Key, t.Key()); err != nil {
+			return nil, fmt.Errorf("key: %v", err)
+		}
+	}
+	if c.Elem != nil {
+		switch t.Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map:
+		default:
+			return nil, fmt.Errorf("elem constraints on type without elements: %s", t)
+		}
+		if r.elem, err = compileRule(c.Elem, t.Elem()); err != nil {
+			return nil, fmt.Errorf("elem: %v", err)
+		}
+	}
+	return
+}
+
+// Validate a value against the constraints of its type, returns FieldErrors if any
+func (ts *Types) Validate(v interface{}) error {
+	var es FieldErrors
+	ts.validate(reflect.ValueOf(v), nil, "", &es)
+	if len(es) > 0 {
+		return es
+	}
+	return nil
+}
+
+func (ts *Types) validate(rv reflect.Value, r *rule, path string, es *FieldErrors) {
+	if !rv.IsValid() {
+		return
+	}
+	if r != nil {
+		if r.c.Required && rv.IsZero() {
+			*es = append(*es, FieldError{path, "required"})
+			return
+		}
+		ts.check(rv, r, path, es)
+	}
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !rv.IsNil() {
+			ts.validate(rv.Elem(), nil, path, es)
+		}
+	case reflect.Slice, reflect.Array:
+		var er *rule
+		if r != nil {
+			er = r.elem
+		}
+		if er == nil && !mayContainRule(rv.Type().Elem()) {
+			return
+		}
+		for x := 0; x < rv.Len(); x++ {
+			ts.validate(rv.Index(x), er, fmt.Sprintf("%s[%d]", path, x), es)
+		}
+	case reflect.Map:
+		var kr, er *rule
+		if r != nil {
+			kr, er = r.key, r.elem
+		}
+		if kr == nil && er == nil && !mayContainRule(rv.Type().Elem()) {
+			return
+		}
+		it := rv.MapRange()
+		for it.Next() {
+			p := fmt.Sprintf("%s[%#v]", path, it.Key().Interface())
+			ts.validate(it.Key(), kr, p, es)
+			ts.validate(it.Value(), er, p, es)
+		}
+	case reflect.Struct:
+		if c, ok := ts.codecOf(rv.Type()).(*enumCodec); ok {
+			if _, ok = c.ordinal(rv); !ok {
+				*es = append(*es, FieldError{path, fmt.Sprintf("invalid value of enum %s: %v", c.name, rv.Field(0).Interface())})
+			}
+			return
+		}
+		if c, ok := ts.codecOf(rv.Type()).(*unionCodec); ok {
+			if _, err := c.variant(rv); err != nil {
+				*es = append(*es, FieldError{path, err.Error()})
+			} else if !rv.Field(1).IsNil() {
+				ts.validate(rv.Field(1).Elem(), nil, path, es)
+			}
+			return
+		}
+		ts.lk.RLock()
+		fr, ok := ts.vr[rv.Type()]
+		xs := ts.xr[rv.Type()]
+		ts.lk.RUnlock()
+		if !ok {
+			return
+		}
+		for _, x := range xs {
+			if r, err := x.fn(rv); err != nil {
+				*es = append(*es, FieldError{path, fmt.Sprintf("rule %s: %v", x.src, err)})
+			} else if r != true {
+				*es = append(*es, FieldError{path, "rule failed: " + x.src})
+			}
+		}
+		for _, f := range fr {
+			p := f.name
+			if f.embedded {
+				p = path
+			} else if path != "" {
+				p = path + "." + p
+			}
+			ts.validate(rv.Field(f.index), f.rule, p, es)
+		}
+	}
+}
+
+// check the rule on a non-zero or optional value
+func (ts *Types) check(rv reflect.Value, r *rule, path string, es *FieldErrors) {
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+	c := r.c
+	if c.Min != nil || c.Max != nil {
+		var f float64
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			f = float64(rv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			f = float64(rv.Uint())
+		default:
+			f = rv.Float()
+		}
+		if c.Min != nil && f < *c.Min {
+			*es = append(*es, FieldError{path, fmt.Sprintf("%v less than min %v", f, *c.Min)})
+		}
+		if c.Max != nil && f > *c.Max {
+			*es = append(*es, FieldError{path, fmt.Sprintf("%v greater than max %v", f, *c.Max)})
+		}
+	}
+	if c.MinLen != nil || c.MaxLen != nil {
+		var l int
+		if rv.Kind() == reflect.String {
+			l = utf8.RuneCountInString(rv.String())
+		} else {
+			l = rv.Len()
+		}
+		if c.MinLen != nil && l < *c.MinLen {
+			*es = append(*es, FieldError{path, fmt.Sprintf("length %d less than min_len %d", l, *c.MinLen)})
+		}
+		if c.MaxLen != nil && l > *c.MaxLen {
+			*es = append(*es, FieldError{path, fmt.Sprintf("length %d greater than max_len %d", l, *c.MaxLen)})
+		}
+	}
+	if r.re != nil && !r.re.MatchString(rv.String()) {
+		*es = append(*es, FieldError{path, fmt.Sprintf("%q does not match pattern %s", rv.String(), c.Pattern)})
+	}
+	if len(r.enum) > 0 {
+		found := false
+		for _, e := range r.enum {
+			if reflect.DeepEqual(rv.Interface(), e.Interface()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			*es = append(*es, FieldError{path, fmt.Sprintf("%v is not an allowed value", rv.Interface())})
+		}
+	}
+}
+
+// mayContainRule reports whether values of t may hold constrained structs
+func mayContainRule(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package schema_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/fengyoulin/schema"
+	"reflect"
+	"testing"
+)
+
+const testValidateDef = `
+[{"name":"Item","fields":[
+{"name":"Name","type":"string","constraints":{"required":true,"pattern":"^[a-z]+$"}},
+{"name":"Level","type":"int","constraints":{"min":1,"max":5}}
+]},
+{"name":"Order","fields":[
+{"name":"Code","type":"string","constraints":{"min_len":2,"max_len":4}},
+{"name":"State","type":"string","constraints":{"enum":["new","done"]}},
+{"name":"Items","type":"[]Item","constraints":{"max_len":3}},
+{"name":"Scores","type":"map[string]float64","constraints":{"key":{"min_len":1},"elem":{"max":100}}},
+{"name":"Note","type":"*string","constraints":{"max_len":3}}
+]}]
+`
+
+func TestTypes_Validate(t *testing.T) {
+	ts := newTypes(t, testValidateDef)
+	v, err := ts.NewValue("Order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := `{"Code":"ABCDE","State":"lost","Items":[{"Name":"ok","Level":1},{"Name":"","Level":2},{"Name":"B","Level":9}],
+"Scores":{"":101,"a":1},"Note":"long"}`
+	if err = json.Unmarshal([]byte(src), v.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	err = ts.Validate(v.Interface())
+	es, ok := err.(schema.FieldErrors)
+	if !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var paths []string
+	for _, e := range es {
+		paths = append(paths, e.Path)
+	}
+	exp := []string{"Code", "State", "Items[1].Name", "Items[2].Name", "Items[2].Level", `Scores[""]`, `Scores[""]`, "Note"}
+	if !reflect.DeepEqual(paths, exp) {
+		t.Errorf("%v != %v", paths, exp)
+	}
+	if v, err = ts.NewValue("Order"); err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal([]byte(`{"Code":"AB","State":"new","Items":[],"Scores":{},"Note":null}`), v.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	if err = ts.Validate(v.Interface()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTypes_CreateSchemaInvalidConstraints(t *testing.T) {
+	min, max := 5.0, 1.0
+	bad := []schema.Constraints{
+		{Min: &min, Max: &max},
+		{Pattern: "a"},
+		{Elem: &schema.Constraints{Required: true}},
+	}
+	for i, c := range bad {
+		c := c
+		s := schema.Schema{Name: "Bad", Fields: []schema.Field{{Name: "Count", Type: "int", Constraints: &c}}}
+		if _, err := schema.New().CreateSchema(s); err == nil {
+			t.Errorf("%d: expected error", i)
+		}
+	}
+}
+
+func TestDecoder_DecodeValidate(t *testing.T) {
+	ts := newTypes(t, testValidateDef)
+	v, err := ts.NewValue("Item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &schema.Decoder{
+		Reader:   bytes.NewReader([]byte{1, 2, 'X', 2}),
+		Types:    ts,
+		Validate: true,
+	}
+	err = d.Decode(v.Interface())
+	if es, ok := err.(schema.FieldErrors); !ok || len(es) != 1 || es[0].Path != "Name" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
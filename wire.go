@@ -0,0 +1,623 @@
+package schema
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// wire types of the protobuf wire format
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// protoWire type of a proto scalar type
+func protoWire(pt string) int {
+	switch pt {
+	case "double", "fixed64", "sfixed64":
+		return wireFixed64
+	case "float", "fixed32", "sfixed32":
+		return wireFixed32
+	case "string", "bytes":
+		return wireBytes
+	}
+	return wireVarint
+}
+
+// wireField of a struct, the index, the number and the proto type of ProtoTag
+type wireField struct {
+	index int
+	num   int
+	typ   string
+}
+
+// wireFields of a struct sorted by the numbers
+func wireFields(t reflect.Type) ([]wireField, error) {
+	fs := make([]wireField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		num, typ, err := protoTag(t.Field(i))
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, wireField{index: i, num: num, typ: typ})
+	}
+	sort.Slice(fs, func(i, j int) bool { return fs[i].num < fs[j].num })
+	for i := 1; i < len(fs); i++ {
+		if fs[i].num == fs[i-1].num {
+			return nil, fmt.Errorf("field %s and %s of the same number: %d",
+				t.Field(fs[i-1].index).Name, t.Field(fs[i].index).Name, fs[i].num)
+		}
+	}
+	return fs, nil
+}
+
+// protoPacked reports whether the repeated elements of t are packed, the ones
+// of numeric scalars and enums
+func (ts *Types) protoPacked(t reflect.Type, typ string) bool {
+	if t.Kind() == reflect.Struct {
+		_, ok := ts.protoCodec(t).(*enumCodec)
+		return ok
+	}
+	pt, err := protoScalar(t, typ)
+	return err == nil && protoWire(pt) != wireBytes
+}
+
+// protoCodec of a struct type, nil without Types
+func (ts *Types) protoCodec(t reflect.Type) codec {
+	if ts == nil {
+		return nil
+	}
+	return ts.codecOf(t)
+}
+
+// protoWriter appends a message in the protobuf wire format
+type protoWriter struct {
+	ts *Types
+	b  []byte
+}
+
+func (w *protoWriter) uvarint(u uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], u)
+	w.b = append(w.b, buf[:n]...)
+}
+
+func (w *protoWriter) fixed32(u uint32) {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], u)
+	w.b = append(w.b, buf[:]...)
+}
+
+func (w *protoWriter) fixed64(u uint64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], u)
+	w.b = append(w.b, buf[:]...)
+}
+
+func (w *protoWriter) tag(num, wt int) {
+	w.uvarint(uint64(num)<<3 | uint64(wt))
+}
+
+func (w *protoWriter) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.b = append(w.b, b...)
+}
+
+// message of the fields of a struct in the order of the numbers
+func (w *protoWriter) message(rv reflect.Value) error {
+	fs, err := wireFields(rv.Type())
+	if err != nil {
+		return err
+	}
+	for _, f := range fs {
+		if err = w.field(f.num, rv.Field(f.index), f.typ); err != nil {
+			return fmt.Errorf("%s: %v", rv.Type().Field(f.index).Name, err)
+		}
+	}
+	return nil
+}
+
+// field of a number, the zero values of scalars and nil pointers are omitted
+func (w *protoWriter) field(num int, v reflect.Value, typ string) error {
+	switch t := v.Type(); {
+	case t.Kind() == reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return w.value(num, v.Elem(), typ, true)
+	case t.Kind() == reflect.Map:
+		return w.entries(num, v, typ)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8, t.Kind() == reflect.Array:
+		return w.repeated(num, v, typ)
+	}
+	return w.value(num, v, typ, false)
+}
+
+// repeated elements, packed if numeric
+func (w *protoWriter) repeated(num int, v reflect.Value, typ string) error {
+	if v.Len() == 0 {
+		return nil
+	}
+	et := v.Type().Elem()
+	if w.ts.protoPacked(et, typ) {
+		p := &protoWriter{ts: w.ts}
+		for i := 0; i < v.Len(); i++ {
+			if err := p.scalar(v.Index(i), typ); err != nil {
+				return err
+			}
+		}
+		w.tag(num, wireBytes)
+		w.bytes(p.b)
+		return nil
+	}
+	for i := 0; i < v.Len(); i++ {
+		e := v.Index(i)
+		if e.Kind() == reflect.Ptr {
+			if e.IsNil() {
+				return fmt.Errorf("nil element: %d", i)
+			}
+			e = e.Elem()
+		}
+		if err := w.value(num, e, typ, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entries of a map as messages of the key 1 and the value 2, sorted by keys
+func (w *protoWriter) entries(num int, v reflect.Value, typ string) error {
+	kt, vt, err := protoMapTag(v.Type(), typ)
+	if err != nil {
+		return err
+	}
+	for _, k := range sortedKeys(v) {
+		p := &protoWriter{ts: w.ts}
+		if err = p.value(1, k, kt, true); err != nil {
+			return err
+		}
+		if e := v.MapIndex(k); e.Kind() != reflect.Ptr {
+			err = p.value(2, e, vt, true)
+		} else if !e.IsNil() {
+			err = p.value(2, e.Elem(), vt, true)
+		}
+		if err != nil {
+			return err
+		}
+		w.tag(num, wireBytes)
+		w.bytes(p.b)
+	}
+	return nil
+}
+
+// value of a field, a zero value is omitted unless force
+func (w *protoWriter) value(num int, v reflect.Value, typ string, force bool) error {
+	if v.Kind() == reflect.Struct {
+		switch c := w.ts.protoCodec(v.Type()).(type) {
+		case *enumCodec:
+			i, ok := c.ordinal(v)
+			if !ok {
+				return fmt.Errorf("invalid value of enum %s: %v", c.name, v.Field(0).Interface())
+			}
+			if n := c.protoNumber(i); n != 0 || force {
+				w.tag(num, wireVarint)
+				w.uvarint(uint64(n))
+			}
+			return nil
+		case *unionCodec:
+			return fmt.Errorf("union is not supported: %s", c.name)
+		}
+		if typ != "" {
+			return fmt.Errorf("proto type %s of %s", typ, v.Type())
+		}
+		p := &protoWriter{ts: w.ts}
+		if err := p.message(v); err != nil {
+			return err
+		}
+		if len(p.b) > 0 || force {
+			w.tag(num, wireBytes)
+			w.bytes(p.b)
+		}
+		return nil
+	}
+	pt, err := protoScalar(v.Type(), typ)
+	if err != nil {
+		return err
+	}
+	if !force && isEmpty(v) {
+		return nil
+	}
+	w.tag(num, protoWire(pt))
+	return w.scalar(v, pt)
+}
+
+// scalar value without the tag, an enum by the number
+func (w *protoWriter) scalar(v reflect.Value, typ string) error {
+	if v.Kind() == reflect.Struct {
+		c := w.ts.protoCodec(v.Type()).(*enumCodec)
+		i, ok := c.ordinal(v)
+		if !ok {
+			return fmt.Errorf("invalid value of enum %s: %v", c.name, v.Field(0).Interface())
+		}
+		w.uvarint(uint64(c.protoNumber(i)))
+		return nil
+	}
+	pt, err := protoScalar(v.Type(), typ)
+	if err != nil {
+		return err
+	}
+	switch pt {
+	case "bool":
+		var u uint64
+		if v.Bool() {
+			u = 1
+		}
+		w.uvarint(u)
+	case "int32", "int64":
+		w.uvarint(uint64(v.Int()))
+	case "uint32", "uint64":
+		w.uvarint(v.Uint())
+	case "sint32", "sint64":
+		x := v.Int()
+		w.uvarint(uint64(x<<1 ^ x>>63))
+	case "fixed32":
+		w.fixed32(uint32(v.Uint()))
+	case "sfixed32":
+		w.fixed32(uint32(v.Int()))
+	case "float":
+		w.fixed32(math.Float32bits(float32(v.Float())))
+	case "fixed64":
+		w.fixed64(v.Uint())
+	case "sfixed64":
+		w.fixed64(uint64(v.Int()))
+	case "double":
+		w.fixed64(math.Float64bits(v.Float()))
+	case "string":
+		w.uvarint(uint64(v.Len()))
+		w.b = append(w.b, v.String()...)
+	case "bytes":
+		w.bytes(v.Bytes())
+	}
+	return nil
+}
+
+// protoReader of a message in the protobuf wire format
+type protoReader struct {
+	ts *Types
+	b  []byte
+}
+
+var errProtoTruncated = fmt.Errorf("truncated proto message")
+
+func (r *protoReader) uvarint() (uint64, error) {
+	u, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		return 0, errProtoTruncated
+	}
+	r.b = r.b[n:]
+	return u, nil
+}
+
+func (r *protoReader) fixed(n int) (u uint64, err error) {
+	if len(r.b) < n {
+		return 0, errProtoTruncated
+	}
+	if n == 4 {
+		u = uint64(binary.LittleEndian.Uint32(r.b))
+	} else {
+		u = binary.LittleEndian.Uint64(r.b)
+	}
+	r.b = r.b[n:]
+	return
+}
+
+func (r *protoReader) bytes() ([]byte, error) {
+	l, err := r.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if l > uint64(len(r.b)) {
+		return nil, errProtoTruncated
+	}
+	b := r.b[:l]
+	r.b = r.b[l:]
+	return b, nil
+}
+
+// skip an unknown field of the wire type
+func (r *protoReader) skip(wt int) (err error) {
+	switch wt {
+	case wireVarint:
+		_, err = r.uvarint()
+	case wireFixed64:
+		_, err = r.fixed(8)
+	case wireBytes:
+		_, err = r.bytes()
+	case wireFixed32:
+		_, err = r.fixed(4)
+	default:
+		err = fmt.Errorf("unsupported wire type: %d", wt)
+	}
+	return
+}
+
+// message into a struct, merged with the values it has, unknown fields are
+// skipped
+func (r *protoReader) message(rv reflect.Value) error {
+	fs, err := wireFields(rv.Type())
+	if err != nil {
+		return err
+	}
+	nums := make(map[int]int, len(fs))
+	for i, f := range fs {
+		nums[f.num] = i
+	}
+	counts := make([]int, len(fs)) // elements of arrays
+	for len(r.b) > 0 {
+		k, err := r.uvarint()
+		if err != nil {
+			return err
+		}
+		i, ok := nums[int(k>>3)]
+		if !ok {
+			if err = r.skip(int(k & 7)); err != nil {
+				return err
+			}
+			continue
+		}
+		f := fs[i]
+		if err = r.field(rv.Field(f.index), int(k&7), f.typ, &counts[i]); err != nil {
+			return fmt.Errorf("%s: %v", rv.Type().Field(f.index).Name, err)
+		}
+	}
+	return nil
+}
+
+// field of the wire type, n counts the elements of an array
+func (r *protoReader) field(v reflect.Value, wt int, typ string, n *int) error {
+	switch t := v.Type(); {
+	case t.Kind() == reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return r.value(v.Elem(), wt, typ)
+	case t.Kind() == reflect.Map:
+		return r.entry(v, wt, typ)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8, t.Kind() == reflect.Array:
+		return r.repeated(v, wt, typ, n)
+	}
+	return r.value(v, wt, typ)
+}
+
+// repeated elements, packed or one of the wire type
+func (r *protoReader) repeated(v reflect.Value, wt int, typ string, n *int) error {
+	et := v.Type().Elem()
+	add := func(e reflect.Value) error {
+		if v.Kind() == reflect.Slice {
+			v.Set(reflect.Append(v, e))
+			return nil
+		}
+		if *n >= v.Len() {
+			return fmt.Errorf("more than %d elements", v.Len())
+		}
+		v.Index(*n).Set(e)
+		*n++
+		return nil
+	}
+	if wt == wireBytes && r.ts.protoPacked(et, typ) {
+		b, err := r.bytes()
+		if err != nil {
+			return err
+		}
+		p := &protoReader{ts: r.ts, b: b}
+		for len(p.b) > 0 {
+			e := reflect.New(et).Elem()
+			if err = p.scalar(e, typ); err != nil {
+				return err
+			}
+			if err = add(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	e := reflect.New(et).Elem()
+	if err := r.element(e, wt, typ); err != nil {
+		return err
+	}
+	return add(e)
+}
+
+// element of a repeated field or a map, a pointer is allocated
+func (r *protoReader) element(v reflect.Value, wt int, typ string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return r.value(v, wt, typ)
+}
+
+// entry of a map, the missing key or value is zero
+func (r *protoReader) entry(v reflect.Value, wt int, typ string) error {
+	if wt != wireBytes {
+		return fmt.Errorf("wire type %d of map", wt)
+	}
+	kt, vt, err := protoMapTag(v.Type(), typ)
+	if err != nil {
+		return err
+	}
+	b, err := r.bytes()
+	if err != nil {
+		return err
+	}
+	k, e := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+	p := &protoReader{ts: r.ts, b: b}
+	for len(p.b) > 0 {
+		u, err := p.uvarint()
+		if err != nil {
+			return err
+		}
+		switch u >> 3 {
+		case 1:
+			err = p.value(k, int(u&7), kt)
+		case 2:
+			err = p.element(e, int(u&7), vt)
+		default:
+			err = p.skip(int(u & 7))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if e.Kind() == reflect.Ptr && e.IsNil() {
+		e.Set(reflect.New(e.Type().Elem()))
+	}
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(v.Type()))
+	}
+	v.SetMapIndex(k, e)
+	return nil
+}
+
+// value of the wire type, a message is merged
+func (r *protoReader) value(v reflect.Value, wt int, typ string) error {
+	if v.Kind() == reflect.Struct {
+		switch c := r.ts.protoCodec(v.Type()).(type) {
+		case *enumCodec:
+			if wt != wireVarint {
+				return fmt.Errorf("wire type %d of enum %s", wt, c.name)
+			}
+			return r.scalar(v, typ)
+		case *unionCodec:
+			return fmt.Errorf("union is not supported: %s", c.name)
+		}
+		if wt != wireBytes {
+			return fmt.Errorf("wire type %d of message %s", wt, v.Type())
+		}
+		b, err := r.bytes()
+		if err != nil {
+			return err
+		}
+		return (&protoReader{ts: r.ts, b: b}).message(v)
+	}
+	pt, err := protoScalar(v.Type(), typ)
+	if err != nil {
+		return err
+	}
+	if wt != protoWire(pt) {
+		return fmt.Errorf("wire type %d of %s", wt, pt)
+	}
+	return r.scalar(v, typ)
+}
+
+// scalar value without the tag, an enum by the number
+func (r *protoReader) scalar(v reflect.Value, typ string) error {
+	if v.Kind() == reflect.Struct {
+		c := r.ts.protoCodec(v.Type()).(*enumCodec)
+		u, err := r.uvarint()
+		if err != nil {
+			return err
+		}
+		for i := range c.values {
+			if c.protoNumber(i) == int64(int32(u)) {
+				v.Field(0).Set(c.values[i])
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown number of enum %s: %d", c.name, int32(u))
+	}
+	pt, err := protoScalar(v.Type(), typ)
+	if err != nil {
+		return err
+	}
+	var u uint64
+	switch protoWire(pt) {
+	case wireVarint:
+		u, err = r.uvarint()
+	case wireFixed32:
+		u, err = r.fixed(4)
+	case wireFixed64:
+		u, err = r.fixed(8)
+	default:
+		var b []byte
+		if b, err = r.bytes(); err != nil {
+			return err
+		}
+		if pt == "string" {
+			v.SetString(string(b))
+		} else {
+			v.SetBytes(append([]byte(nil), b...))
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var x int64
+	switch pt {
+	case "bool":
+		v.SetBool(u != 0)
+		return nil
+	case "float":
+		v.SetFloat(float64(math.Float32frombits(uint32(u))))
+		return nil
+	case "double":
+		v.SetFloat(math.Float64frombits(u))
+		return nil
+	case "uint32", "fixed32", "uint64", "fixed64":
+		if pt == "uint32" {
+			u = uint64(uint32(u))
+		}
+		if v.OverflowUint(u) {
+			return fmt.Errorf("%d overflows %s", u, v.Type())
+		}
+		v.SetUint(u)
+		return nil
+	case "int32", "sfixed32":
+		x = int64(int32(u))
+	case "int64", "sfixed64":
+		x = int64(u)
+	case "sint32":
+		x = int64(int32(uint32(u)>>1) ^ -int32(u&1))
+	case "sint64":
+		x = int64(u>>1) ^ -int64(u&1)
+	}
+	if v.OverflowInt(x) {
+		return fmt.Errorf("%d overflows %s", x, v.Type())
+	}
+	v.SetInt(x)
+	return nil
+}
+
+// encodeProto of a struct as a message
+func (e *Encoder) encodeProto(rv reflect.Value) (err error) {
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("%s is not struct", rv.Type())
+	}
+	w := &protoWriter{ts: e.Types}
+	if err = w.message(rv); err != nil {
+		return
+	}
+	_, err = e.Writer.Write(w.b)
+	return
+}
+
+// decodeProto of the rest of Reader into a struct
+func (d *Decoder) decodeProto(rv reflect.Value) error {
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("%s is not struct", rv.Type())
+	}
+	b, err := io.ReadAll(d.Reader)
+	if err != nil {
+		return err
+	}
+	return (&protoReader{ts: d.Types, b: b}).message(rv)
+}
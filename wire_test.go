@@ -0,0 +1,138 @@
+package schema_test
+
+import (
+	"bytes"
+	"github.com/fengyoulin/schema"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+var testWireFS = fstest.MapFS{"sample.proto": {Data: []byte(`syntax = "proto3";
+message Sample {
+  repeated int32 nums = 1;
+  double ratio = 2;
+  float f = 3;
+  bool ok = 4;
+  int32 neg = 5;
+  sfixed64 s = 6;
+  repeated string tags = 7;
+  repeated Kind kinds = 8;
+}
+
+enum Kind {
+  KIND_NONE = 0;
+  KIND_A = 1;
+  KIND_B = 2;
+}
+`)}}
+
+// newWireValue of the named schema imported from the files, set by JSON
+func newWireValue(t *testing.T, fsys fstest.MapFS, file, name, data string) (*schema.Types, interface{}) {
+	ss, err := schema.ImportProto(fsys, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := createTypes(t, ss)
+	tp, ok := ts.TypeByName(name)
+	if !ok {
+		t.Fatalf("no type: %s", name)
+	}
+	v := reflect.New(tp).Interface()
+	if err = schema.JSONUnmarshal(ts, []byte(data), v); err != nil {
+		t.Fatal(err)
+	}
+	return ts, v
+}
+
+func TestEncoder_Proto(t *testing.T) {
+	for _, c := range []struct {
+		fsys       fstest.MapFS
+		file, name string
+		data       string
+		exp        []byte
+	}{
+		{testProtoFS, "shop/order.proto", "Order",
+			`{"id":150,"status":"STATUS_PAID","lines":[{"sku":"a","qty":1},{"sku":"","qty":0}],` +
+				`"counts":{"y":0,"x":-1},"note":"","total":{"currency":"USD"}}`,
+			[]byte{0x08, 0x96, 0x01, 0x10, 0x01,
+				0x1a, 0x08, 0x0a, 0x01, 'a', 0x15, 0x01, 0x00, 0x00, 0x00, 0x1a, 0x00,
+				0x22, 0x05, 0x0a, 0x01, 'x', 0x10, 0x01, 0x22, 0x05, 0x0a, 0x01, 'y', 0x10, 0x00,
+				0x2a, 0x00, 0x32, 0x05, 0x0a, 0x03, 'U', 'S', 'D'}},
+		{testWireFS, "sample.proto", "Sample",
+			`{"nums":[1,2,300],"ratio":1.5,"f":0,"ok":true,"neg":-1,"s":-2,"tags":["a","b"],"kinds":["KIND_B","KIND_NONE"]}`,
+			[]byte{0x0a, 0x04, 0x01, 0x02, 0xac, 0x02,
+				0x11, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf8, 0x3f,
+				0x20, 0x01, 0x28, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01,
+				0x31, 0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+				0x3a, 0x01, 'a', 0x3a, 0x01, 'b', 0x42, 0x02, 0x02, 0x00}},
+	} {
+		ts, v := newWireValue(t, c.fsys, c.file, c.name, c.data)
+		b := &bytes.Buffer{}
+		if err := (&schema.Encoder{Writer: b, Types: ts, Proto: true}).Encode(v); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b.Bytes(), c.exp) {
+			t.Errorf("%s: % x != % x", c.name, b.Bytes(), c.exp)
+		}
+		r := reflect.New(reflect.TypeOf(v).Elem()).Interface()
+		if err := (&schema.Decoder{Reader: b, Types: ts, Proto: true}).Decode(r); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(r, v) {
+			t.Errorf("%s: %+v != %+v", c.name, r, v)
+		}
+	}
+}
+
+func TestDecoder_Proto(t *testing.T) {
+	ts, exp := newWireValue(t, testWireFS, "sample.proto", "Sample", `{"nums":[1,2,3],"neg":5,"kinds":["KIND_A"]}`)
+	// unpacked numbers, a repeated scalar, unknown fields and an unpacked enum
+	b := []byte{0x08, 0x01, 0x08, 0x02, 0x28, 0x07, 0x78, 0x05, 0x85, 0x01, 1, 2, 3, 4,
+		0x0a, 0x01, 0x03, 0x28, 0x05, 0x82, 0x01, 0x01, 0x00, 0x40, 0x01}
+	v := reflect.New(reflect.TypeOf(exp).Elem()).Interface()
+	d := &schema.Decoder{Reader: bytes.NewReader(b), Types: ts, Proto: true}
+	if err := d.Decode(v); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, exp) {
+		t.Errorf("%+v != %+v", v, exp)
+	}
+	for _, b := range [][]byte{
+		{0x08},                   // truncated varint
+		{0x0a, 0x05, 0x01},       // truncated packed
+		{0x10, 0x01},             // wire type of double
+		{0x40, 0x07},             // unknown enum number
+		{0x0b, 0x0c},             // group
+		{0x11, 0x00, 0x00, 0x00}, // truncated fixed64
+	} {
+		d.Reader = bytes.NewReader(b)
+		if err := d.Decode(reflect.New(reflect.TypeOf(exp).Elem()).Interface()); err == nil {
+			t.Errorf("% x: expected error", b)
+		}
+	}
+}
+
+func TestDecoder_ProtoArrays(t *testing.T) {
+	ts := schema.New()
+	// arrays in repeated fields and maps are not proto scalars
+	for _, c := range []struct {
+		v interface{}
+		b []byte
+	}{
+		{&struct {
+			A [][2]int32 `proto:"1"`
+		}{}, []byte{0x0a, 0x02, 0x01, 0x02}},
+		{&struct {
+			A map[string][2]int32 `proto:"1"`
+		}{}, []byte{0x0a, 0x05, 0x0a, 0x01, 'a', 0x10, 0x01}},
+		{&struct {
+			A map[string][2]int32 `proto:"1"`
+		}{}, []byte{0x0a, 0x07, 0x0a, 0x01, 'a', 0x12, 0x02, 0x01, 0x02}},
+	} {
+		d := &schema.Decoder{Reader: bytes.NewReader(c.b), Types: ts, Proto: true}
+		if err := d.Decode(c.v); err == nil {
+			t.Errorf("%T: % x: expected error", c.v, c.b)
+		}
+	}
+}